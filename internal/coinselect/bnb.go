@@ -0,0 +1,100 @@
+package coinselect
+
+import (
+	"sort"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// bnbDefaultMaxTries bounds the depth-first search, as in Bitcoin Core.
+const bnbDefaultMaxTries = 100_000
+
+// BranchAndBound searches for an input set whose effective value lands within
+// the cost of a change output above the target, so no change is needed
+// (Erhardt, "An Evaluation of Coin Selection Strategies"). Returns
+// errNoExactMatch when the search finds nothing; see Auto for the fallback.
+type BranchAndBound struct {
+	MaxTries int // default 100000
+}
+
+// Select implements Strategy.
+func (b BranchAndBound) Select(utxos []models.UTXO, req Request) (*Selection, error) {
+	req, err := req.validate()
+	if err != nil {
+		return nil, err
+	}
+	maxTries := b.MaxTries
+	if maxTries <= 0 {
+		maxTries = bnbDefaultMaxTries
+	}
+
+	var pool []candidate
+	var available int64
+	for _, c := range candidates(utxos, req.FeeRate) {
+		if c.effective > 0 {
+			pool = append(pool, c)
+			available += c.effective
+		}
+	}
+	sort.SliceStable(pool, func(i, j int) bool { return pool[i].effective > pool[j].effective })
+
+	target := req.Target + req.fixedCost()
+	upper := target + req.costOfChange()
+	if available < target {
+		return nil, ErrInsufficientFunds
+	}
+
+	var (
+		current   []bool // inclusion decision for pool[0:len(current)]
+		currValue int64
+		best      []bool
+		bestWaste int64 = -1
+	)
+
+	for try := 0; try < maxTries; try++ {
+		backtrack := false
+		switch {
+		case currValue+available < target || currValue > upper:
+			backtrack = true
+		case currValue >= target:
+			if waste := currValue - target; bestWaste < 0 || waste <= bestWaste {
+				best = append(best[:0], current...)
+				bestWaste = waste
+			}
+			backtrack = true
+		}
+
+		if backtrack {
+			// Walk back past trailing omissions to the last included output.
+			for len(current) > 0 && !current[len(current)-1] {
+				available += pool[len(current)-1].effective
+				current = current[:len(current)-1]
+			}
+			if len(current) == 0 {
+				break // search space exhausted
+			}
+			// Try the branch that omits it.
+			last := len(current) - 1
+			current[last] = false
+			currValue -= pool[last].effective
+			continue
+		}
+
+		// Try the branch that includes the next output.
+		next := len(current)
+		available -= pool[next].effective
+		current = append(current, true)
+		currValue += pool[next].effective
+	}
+
+	if best == nil {
+		return nil, errNoExactMatch
+	}
+	var selected []candidate
+	for i, inc := range best {
+		if inc {
+			selected = append(selected, pool[i])
+		}
+	}
+	return finalize(selected, req, false)
+}
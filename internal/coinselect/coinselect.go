@@ -0,0 +1,144 @@
+// Package coinselect chooses which unspent outputs fund a UTXO-model payment.
+//
+// All strategies share the same fee model: fee = estimated vsize × fee rate,
+// with a change output added only when the leftover is above the dust threshold.
+package coinselect
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// DefaultDustThreshold is the smallest change output worth creating, in satoshis
+// (the relay dust limit for a P2PKH output at 3 sat/vB).
+const DefaultDustThreshold = 546
+
+// ErrInsufficientFunds is returned when the available outputs cannot cover the payment and fee.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// errNoExactMatch is returned by branch-and-bound when no changeless solution exists.
+var errNoExactMatch = errors.New("no changeless input set")
+
+// Request describes a payment to fund.
+type Request struct {
+	Target        int64 // sum of payment outputs, satoshis
+	FeeRate       int64 // sat/vB
+	OutputsVSize  int   // combined vsize of the payment outputs
+	ChangeVSize   int   // vsize of the change output, if one is created
+	DustThreshold int64 // change below this is added to the fee instead (default DefaultDustThreshold)
+}
+
+// Selection is the outcome of coin selection.
+type Selection struct {
+	Inputs []models.UTXO
+	Fee    int64 // satoshis
+	Change int64 // satoshis; zero when no change output is needed
+	VSize  int   // estimated transaction vsize
+}
+
+// Strategy selects inputs covering a payment.
+type Strategy interface {
+	Select(utxos []models.UTXO, req Request) (*Selection, error)
+}
+
+// candidate is a UTXO with its precomputed spending cost.
+type candidate struct {
+	utxo      models.UTXO
+	value     int64
+	weight    int
+	effective int64 // value minus the fee to spend it
+}
+
+func candidates(utxos []models.UTXO, feeRate int64) []candidate {
+	out := make([]candidate, 0, len(utxos))
+	for _, u := range utxos {
+		if u.Amount == nil || !u.Amount.IsInt64() {
+			continue
+		}
+		w := InputWeight(u.ScriptPubKey)
+		v := u.Amount.Int64()
+		out = append(out, candidate{
+			utxo:      u,
+			value:     v,
+			weight:    w,
+			effective: v - feeRate*int64((w+3)/4),
+		})
+	}
+	return out
+}
+
+func (r Request) validate() (Request, error) {
+	if r.Target <= 0 {
+		return r, fmt.Errorf("invalid target %d", r.Target)
+	}
+	if r.FeeRate < 0 {
+		return r, fmt.Errorf("invalid fee rate %d", r.FeeRate)
+	}
+	if r.DustThreshold == 0 {
+		r.DustThreshold = DefaultDustThreshold
+	}
+	return r, nil
+}
+
+// costOfChange is the fee to create a change output now plus the fee to spend it later.
+func (r Request) costOfChange() int64 {
+	return r.FeeRate * int64(r.ChangeVSize+(weightP2WPKHInput+3)/4)
+}
+
+// fixedCost is the fee for everything except inputs and change. It assumes a
+// witness transaction, overestimating legacy spends by at most 1 vB.
+func (r Request) fixedCost() int64 {
+	return r.FeeRate * int64(estimateVSize(nil, true, r, false))
+}
+
+// finalize computes the fee and change for a chosen input set.
+// When allowChange is false, any excess is added to the fee.
+func finalize(selected []candidate, req Request, allowChange bool) (*Selection, error) {
+	var sum int64
+	weights := make([]int, 0, len(selected))
+	witness := false
+	inputs := make([]models.UTXO, 0, len(selected))
+	for _, c := range selected {
+		sum += c.value
+		weights = append(weights, c.weight)
+		witness = witness || isWitnessInput(c.utxo.ScriptPubKey)
+		inputs = append(inputs, c.utxo)
+	}
+
+	vsizeNoChange := estimateVSize(weights, witness, req, false)
+	feeNoChange := req.FeeRate * int64(vsizeNoChange)
+	if sum < req.Target+feeNoChange {
+		return nil, ErrInsufficientFunds
+	}
+
+	if allowChange {
+		vsize := estimateVSize(weights, witness, req, true)
+		fee := req.FeeRate * int64(vsize)
+		if change := sum - req.Target - fee; change >= req.DustThreshold {
+			return &Selection{Inputs: inputs, Fee: fee, Change: change, VSize: vsize}, nil
+		}
+	}
+
+	return &Selection{Inputs: inputs, Fee: sum - req.Target, VSize: vsizeNoChange}, nil
+}
+
+// Auto tries branch-and-bound for a changeless solution and falls back to
+// knapsack, mirroring Bitcoin Core's wallet.
+type Auto struct {
+	BnB      BranchAndBound
+	Knapsack Knapsack
+}
+
+// Select implements Strategy.
+func (a Auto) Select(utxos []models.UTXO, req Request) (*Selection, error) {
+	sel, err := a.BnB.Select(utxos, req)
+	if err == nil {
+		return sel, nil
+	}
+	if !errors.Is(err, errNoExactMatch) {
+		return nil, err
+	}
+	return a.Knapsack.Select(utxos, req)
+}
@@ -0,0 +1,199 @@
+package coinselect
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// p2wpkh is a placeholder P2WPKH scriptPubKey; only its shape matters for sizing.
+var p2wpkh = append([]byte{0x00, 20}, make([]byte, 20)...)
+
+func utxos(values ...int64) []models.UTXO {
+	out := make([]models.UTXO, len(values))
+	for i, v := range values {
+		out[i] = models.UTXO{
+			TxID:         fmt.Sprintf("%064x", i+1),
+			Amount:       big.NewInt(v),
+			ScriptPubKey: p2wpkh,
+		}
+	}
+	return out
+}
+
+func testRequest(target int64) Request {
+	return Request{
+		Target:       target,
+		FeeRate:      10,
+		OutputsVSize: vsizeP2WPKHOutput,
+		ChangeVSize:  vsizeP2WPKHOutput,
+	}
+}
+
+func sum(sel *Selection) int64 {
+	var total int64
+	for _, u := range sel.Inputs {
+		total += u.Amount.Int64()
+	}
+	return total
+}
+
+// checkBalanced verifies inputs = target + change + fee and fee = vsize × rate (or more, without change).
+func checkBalanced(t *testing.T, sel *Selection, req Request) {
+	t.Helper()
+	if got := req.Target + sel.Change + sel.Fee; got != sum(sel) {
+		t.Errorf("inputs %d != target %d + change %d + fee %d", sum(sel), req.Target, sel.Change, sel.Fee)
+	}
+	if sel.Fee < int64(sel.VSize)*req.FeeRate {
+		t.Errorf("fee %d below vsize %d × rate %d", sel.Fee, sel.VSize, req.FeeRate)
+	}
+	if sel.Change != 0 && sel.Change < DefaultDustThreshold {
+		t.Errorf("change %d is dust", sel.Change)
+	}
+}
+
+func TestEstimateVSize(t *testing.T) {
+	req := testRequest(1)
+	// 1-in 2-out P2WPKH: 10.5 + 68 + 2×31 = 140.5 → 141 vB
+	if got := estimateVSize([]int{weightP2WPKHInput}, true, req, true); got != 141 {
+		t.Errorf("P2WPKH 1-in 2-out vsize = %d, want 141", got)
+	}
+	// 1-in 2-out P2PKH: 10 + 148 + 2×34 = 226 vB
+	req.OutputsVSize, req.ChangeVSize = vsizeP2PKHOutput, vsizeP2PKHOutput
+	if got := estimateVSize([]int{weightP2PKHInput}, false, req, true); got != 226 {
+		t.Errorf("P2PKH 1-in 2-out vsize = %d, want 226", got)
+	}
+}
+
+func TestAddressOutputVSize(t *testing.T) {
+	tests := []struct {
+		addr string
+		want int
+	}{
+		{"1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", vsizeP2PKHOutput},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", vsizeP2SHOutput},
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", vsizeP2WPKHOutput},
+		{"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3", vsizeP2WSHOutput},
+		{"bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr", vsizeP2TROutput},
+	}
+	for _, tt := range tests {
+		if got := AddressOutputVSize(tt.addr); got != tt.want {
+			t.Errorf("AddressOutputVSize(%s) = %d, want %d", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestLargestFirst(t *testing.T) {
+	req := testRequest(150_000)
+	sel, err := LargestFirst{}.Select(utxos(10_000, 100_000, 80_000, 5_000), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel.Inputs) != 2 || sel.Inputs[0].Amount.Int64() != 100_000 || sel.Inputs[1].Amount.Int64() != 80_000 {
+		t.Errorf("expected the two largest inputs, got %v", sel.Inputs)
+	}
+	if sel.Change == 0 {
+		t.Error("expected a change output")
+	}
+	checkBalanced(t, sel, req)
+}
+
+func TestLargestFirst_DustChangeDropped(t *testing.T) {
+	req := testRequest(98_800)
+	// Without change: 110 vB × 10 = 1100 fee, leaving 100 excess.
+	// With change: 141 vB × 10 = 1410 fee, more than the 1200 available.
+	sel, err := LargestFirst{}.Select(utxos(100_000), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Change != 0 {
+		t.Errorf("expected no change, got %d", sel.Change)
+	}
+	if sel.Fee != 1_200 {
+		t.Errorf("expected excess as fee 1200, got %d", sel.Fee)
+	}
+	checkBalanced(t, sel, req)
+}
+
+func TestBranchAndBound_ExactMatch(t *testing.T) {
+	req := testRequest(50_000)
+	// Effective value = value - 68 vB × 10. A changeless 2-input tx costs
+	// 10.5 + 31 → 42 vB fixed, so inputs 30680 + 21100 give effective 50420 ≈ target + 420.
+	pool := utxos(100_000, 30_680, 21_100, 7_000, 3_000)
+	sel, err := BranchAndBound{}.Select(pool, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Change != 0 {
+		t.Errorf("BnB must not create change, got %d", sel.Change)
+	}
+	if len(sel.Inputs) != 2 {
+		t.Errorf("expected 2 inputs, got %d: %v", len(sel.Inputs), sel.Inputs)
+	}
+	checkBalanced(t, sel, req)
+}
+
+func TestBranchAndBound_NoMatch(t *testing.T) {
+	_, err := BranchAndBound{}.Select(utxos(1_000_000), testRequest(50_000))
+	if !errors.Is(err, errNoExactMatch) {
+		t.Errorf("expected errNoExactMatch, got %v", err)
+	}
+}
+
+func TestKnapsack(t *testing.T) {
+	req := testRequest(60_000)
+	pool := utxos(20_000, 25_000, 30_000, 45_000, 500_000)
+	sel, err := Knapsack{Rand: rand.New(rand.NewSource(1))}.Select(pool, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum(sel) >= 500_000 {
+		t.Errorf("expected a subset of small inputs, got %v", sel.Inputs)
+	}
+	checkBalanced(t, sel, req)
+}
+
+func TestKnapsack_SingleLargerCoin(t *testing.T) {
+	req := testRequest(60_000)
+	sel, err := Knapsack{Rand: rand.New(rand.NewSource(1))}.Select(utxos(1_000, 2_000, 90_000), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel.Inputs) != 1 || sel.Inputs[0].Amount.Int64() != 90_000 {
+		t.Errorf("expected the single larger coin, got %v", sel.Inputs)
+	}
+	checkBalanced(t, sel, req)
+}
+
+func TestAuto_FallsBackToKnapsack(t *testing.T) {
+	req := testRequest(50_000)
+	sel, err := Auto{Knapsack: Knapsack{Rand: rand.New(rand.NewSource(1))}}.Select(utxos(1_000_000), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Change == 0 {
+		t.Error("expected change from knapsack fallback")
+	}
+	checkBalanced(t, sel, req)
+}
+
+func TestStrategies_InsufficientFunds(t *testing.T) {
+	strategies := map[string]Strategy{
+		"largest-first": LargestFirst{},
+		"bnb":           BranchAndBound{},
+		"knapsack":      Knapsack{Rand: rand.New(rand.NewSource(1))},
+		"auto":          Auto{},
+	}
+	for name, s := range strategies {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.Select(utxos(10_000, 20_000), testRequest(30_000))
+			if !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("expected ErrInsufficientFunds, got %v", err)
+			}
+		})
+	}
+}
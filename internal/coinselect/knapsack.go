@@ -0,0 +1,139 @@
+package coinselect
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// knapsackIterations is the number of random passes in the subset approximation.
+const knapsackIterations = 1000
+
+// Knapsack is Bitcoin Core's pre-BnB stochastic selection: it looks for the
+// smallest subset of outputs covering the payment plus change, and compares it
+// with the smallest single output that covers it alone.
+type Knapsack struct {
+	// Rand drives the random subset search. Nil uses a time-seeded source.
+	Rand *rand.Rand
+}
+
+// Select implements Strategy.
+func (k Knapsack) Select(utxos []models.UTXO, req Request) (*Selection, error) {
+	req, err := req.validate()
+	if err != nil {
+		return nil, err
+	}
+	rng := k.Rand
+	if rng == nil {
+		rng = rand.New(rand.NewSource(rand.Int63())) //nolint:gosec // selection randomness is not security-sensitive
+	}
+
+	// Aim for enough to pay, create change and keep that change above dust.
+	target := req.Target + req.fixedCost() + req.FeeRate*int64(req.ChangeVSize) + req.DustThreshold
+
+	pool := candidates(utxos, req.FeeRate)
+	rng.Shuffle(len(pool), func(i, j int) { pool[i], pool[j] = pool[j], pool[i] })
+
+	var (
+		lower      []candidate
+		totalLower int64
+		larger     *candidate
+	)
+	for i := range pool {
+		c := pool[i]
+		switch {
+		case c.effective <= 0:
+			continue
+		case c.effective == target:
+			return finalize([]candidate{c}, req, true)
+		case c.effective < target+req.DustThreshold:
+			lower = append(lower, c)
+			totalLower += c.effective
+		case larger == nil || c.effective < larger.effective:
+			larger = &pool[i]
+		}
+	}
+
+	if totalLower == target {
+		return finalize(lower, req, true)
+	}
+	if totalLower < target {
+		if larger == nil {
+			return k.fallback(pool, req)
+		}
+		return finalize([]candidate{*larger}, req, true)
+	}
+
+	sort.SliceStable(lower, func(i, j int) bool { return lower[i].effective > lower[j].effective })
+	best, bestValue := approximateBestSubset(rng, lower, totalLower, target)
+	if larger != nil && bestValue != target && larger.effective <= bestValue {
+		return finalize([]candidate{*larger}, req, true)
+	}
+
+	var selected []candidate
+	for i, inc := range best {
+		if inc {
+			selected = append(selected, lower[i])
+		}
+	}
+	return finalize(selected, req, true)
+}
+
+// fallback spends everything when the change-inclusive target is out of reach
+// but the payment itself may still be affordable without change.
+func (k Knapsack) fallback(pool []candidate, req Request) (*Selection, error) {
+	var all []candidate
+	for _, c := range pool {
+		if c.effective > 0 {
+			all = append(all, c)
+		}
+	}
+	if len(all) == 0 {
+		return nil, ErrInsufficientFunds
+	}
+	return finalize(all, req, true)
+}
+
+// approximateBestSubset runs randomized passes over lower (sorted descending)
+// and returns the inclusion set with the smallest total at or above target.
+func approximateBestSubset(rng *rand.Rand, lower []candidate, total, target int64) ([]bool, int64) {
+	best := make([]bool, len(lower))
+	for i := range best {
+		best[i] = true
+	}
+	bestValue := total
+
+	included := make([]bool, len(lower))
+	for rep := 0; rep < knapsackIterations && bestValue != target; rep++ {
+		for i := range included {
+			included[i] = false
+		}
+		var sum int64
+		reached := false
+		for pass := 0; pass < 2 && !reached; pass++ {
+			for i := range lower {
+				// First pass: random inclusion. Second pass: add what the first skipped.
+				take := !included[i]
+				if pass == 0 {
+					take = rng.Intn(2) == 0
+				}
+				if !take {
+					continue
+				}
+				sum += lower[i].effective
+				included[i] = true
+				if sum >= target {
+					reached = true
+					if sum < bestValue {
+						bestValue = sum
+						copy(best, included)
+					}
+					sum -= lower[i].effective
+					included[i] = false
+				}
+			}
+		}
+	}
+	return best, bestValue
+}
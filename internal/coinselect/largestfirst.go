@@ -0,0 +1,28 @@
+package coinselect
+
+import (
+	"sort"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// LargestFirst spends the largest outputs first until the payment and fee are covered.
+// Simple and predictable; minimizes input count at the cost of privacy and UTXO consolidation.
+type LargestFirst struct{}
+
+// Select implements Strategy.
+func (LargestFirst) Select(utxos []models.UTXO, req Request) (*Selection, error) {
+	req, err := req.validate()
+	if err != nil {
+		return nil, err
+	}
+	cands := candidates(utxos, req.FeeRate)
+	sort.SliceStable(cands, func(i, j int) bool { return cands[i].value > cands[j].value })
+
+	for i := range cands {
+		if sel, err := finalize(cands[:i+1], req, true); err == nil {
+			return sel, nil
+		}
+	}
+	return nil, ErrInsufficientFunds
+}
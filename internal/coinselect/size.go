@@ -0,0 +1,82 @@
+package coinselect
+
+import "strings"
+
+// Transaction size estimates in weight units (WU); vsize = ceil(weight / 4).
+// Input weights assume a 72-byte DER signature and a compressed public key.
+const (
+	baseWeight    = 40 // version + locktime + input/output counts
+	witnessHeader = 2  // BIP-144 marker and flag
+
+	weightP2PKHInput      = 592 // 148 vB
+	weightP2SHP2WPKHInput = 364 // 91 vB
+	weightP2WPKHInput     = 272 // 68 vB
+	weightP2TRInput       = 230 // 57.5 vB
+
+	vsizeP2PKHOutput  = 34
+	vsizeP2SHOutput   = 32
+	vsizeP2WPKHOutput = 31
+	vsizeP2WSHOutput  = 43
+	vsizeP2TROutput   = 43
+)
+
+// InputWeight returns the estimated weight of an input spending scriptPubKey.
+// Unknown scripts are estimated as P2PKH, the most expensive standard type.
+func InputWeight(scriptPubKey []byte) int {
+	s := scriptPubKey
+	switch {
+	case len(s) == 22 && s[0] == 0x00 && s[1] == 20:
+		return weightP2WPKHInput
+	case len(s) == 34 && s[0] == 0x51 && s[1] == 32:
+		return weightP2TRInput
+	case len(s) == 23 && s[0] == 0xa9 && s[1] == 20 && s[22] == 0x87:
+		// Wallet-owned P2SH outputs are nested SegWit (BIP-49).
+		return weightP2SHP2WPKHInput
+	default:
+		return weightP2PKHInput
+	}
+}
+
+// isWitnessInput reports whether spending scriptPubKey requires witness data.
+func isWitnessInput(scriptPubKey []byte) bool {
+	return InputWeight(scriptPubKey) != weightP2PKHInput
+}
+
+// AddressOutputVSize returns the vsize of an output paying to address,
+// classified by its encoding (Base58Check version or bech32 witness program).
+func AddressOutputVSize(address string) int {
+	a := strings.ToLower(address)
+	for _, hrp := range []string{"bc1", "tb1", "bcrt1"} {
+		if !strings.HasPrefix(a, hrp) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(a[len(hrp):], "p"):
+			return vsizeP2TROutput
+		case len(a)-len(hrp) > 40: // 32-byte program
+			return vsizeP2WSHOutput
+		default:
+			return vsizeP2WPKHOutput
+		}
+	}
+	if strings.HasPrefix(address, "3") || strings.HasPrefix(address, "2") {
+		return vsizeP2SHOutput
+	}
+	return vsizeP2PKHOutput
+}
+
+// estimateVSize returns the vsize of a transaction spending inputs and paying
+// the request's outputs, plus a change output when withChange is set.
+func estimateVSize(inputs []int, witness bool, req Request, withChange bool) int {
+	weight := baseWeight + 4*req.OutputsVSize
+	if withChange {
+		weight += 4 * req.ChangeVSize
+	}
+	if witness {
+		weight += witnessHeader
+	}
+	for _, w := range inputs {
+		weight += w
+	}
+	return (weight + 3) / 4
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 	"os"
 	"strconv"
@@ -14,20 +16,91 @@ type Config struct {
 	BTCPollInterval time.Duration
 	TRXPollInterval time.Duration
 
+	// Node RPC endpoints used by block fetchers, and the per-request timeout
+	ETHRPCURL      string
+	ETHWSURL       string // WebSocket endpoint for the newHeads subscription
+	BTCRPCURL      string
+	BTCRPCUser     string
+	BTCRPCPassword string
+	TRXAPIURL      string
+	TRXAPIKey      string
+	TRXSolidityURL string // /walletsolidity endpoint; empty uses TRXAPIURL
+	RPCTimeout     time.Duration
+
+	// Confirmation policy per network
+	ETHConfirmations Confirmations
+	BTCConfirmations Confirmations
+	TRXConfirmations Confirmations
+
+	// PostgreSQL DSN for the nonce, transaction and watch stores; empty keeps
+	// them in memory only
+	DatabaseURL string
+
+	// Directory for listener checkpoints; empty keeps them in memory only
+	CheckpointDir string
+
+	// Concurrent block fetches while a listener catches up on a backlog
+	CatchUpWorkers int
+
+	// Report watched mempool transactions as pending events before they are mined
+	WatchMempool bool
+
+	// Event delivery: directory for the durable outbox (empty keeps it in
+	// memory only) and handler attempts before an event is dead-lettered
+	OutboxDir        string
+	EventMaxAttempts int
+
+	// Webhook notifier: requests per subscriber in one delivery of an event,
+	// and request timeout. A delivery that fails them all is retried with
+	// the event, up to EventMaxAttempts
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+
 	// Transaction builder
 	BroadcastMaxRetries int
 	ContextTimeout      time.Duration
 
-	// Fee defaults (used when on-chain estimation is unavailable)
+	// Fee defaults (used when on-chain estimation is unavailable). BTC fees
+	// are computed from BTCFeeRate instead.
 	ETHDefaultFee *big.Int
-	BTCDefaultFee *big.Int
 	TRXDefaultFee *big.Int
 
 	// ETH chain ID
 	ETHChainID int64
 
-	// BTC network
-	BTCMainnet bool
+	// ETH London hard fork (EIP-1559). When active, the builder sends
+	// type-2 transactions with the fee caps below instead of legacy ones.
+	ETHLondon               bool
+	ETHMaxFeePerGas         *big.Int
+	ETHMaxPriorityFeePerGas *big.Int
+
+	// ETH gas limit for ERC-20 token transfers
+	ETHTokenGasLimit uint64
+
+	// TRX fee_limit for TRC-20 token transfers, in sun
+	TRXFeeLimit int64
+
+	// BTC network: "mainnet", "testnet3", "signet" or "regtest"
+	BTCNetwork string
+
+	// BTC deposit address type: "p2pkh", "p2sh-p2wpkh", "p2wpkh" or "p2tr"
+	BTCAddressType string
+
+	// BTC fee rate in sat/vB, applied to the estimated virtual size of each send
+	BTCFeeRate int64
+}
+
+// Confirmations is the confirmation policy of one network's listener.
+type Confirmations struct {
+	// Depth is the number of blocks before an event is confirmed
+	Depth uint64
+	// Amounts at or above LargeAmount (base units) need LargeAmountDepth
+	// blocks instead; nil disables the tier
+	LargeAmount      *big.Int
+	LargeAmountDepth uint64
+	// Finality replaces depth with the node's finality: "finalized" or
+	// "safe" for ETH, "solidified" for TRX; empty for depth-based
+	Finality string
 }
 
 // Default returns a Config populated with default values.
@@ -37,56 +110,187 @@ func Default() Config {
 		BTCPollInterval: 2 * time.Second,
 		TRXPollInterval: 1 * time.Second,
 
+		ETHRPCURL:  "http://localhost:8545",
+		ETHWSURL:   "ws://localhost:8546",
+		BTCRPCURL:  "http://localhost:8332",
+		TRXAPIURL:  "http://localhost:8090",
+		RPCTimeout: 10 * time.Second,
+
+		ETHConfirmations: Confirmations{Depth: 12},
+		BTCConfirmations: Confirmations{
+			Depth:            1,
+			LargeAmount:      big.NewInt(1_000_000), // 0.01 BTC
+			LargeAmountDepth: 6,
+		},
+		TRXConfirmations: Confirmations{Depth: 19},
+
+		CatchUpWorkers: 8,
+
+		EventMaxAttempts: 5,
+
+		WebhookMaxAttempts: 3,
+		WebhookTimeout:     10 * time.Second,
+
 		BroadcastMaxRetries: 3,
 		ContextTimeout:      15 * time.Second,
 
 		ETHDefaultFee: big.NewInt(21_000 * 20_000_000_000), // 21000 gas * 20 gwei
-		BTCDefaultFee: big.NewInt(10_000),                   // 10000 satoshi
-		TRXDefaultFee: big.NewInt(1_000_000),                // 1 TRX bandwidth
+		TRXDefaultFee: big.NewInt(1_000_000),               // 1 TRX bandwidth
 
 		ETHChainID: 1,
-		BTCMainnet: true,
+
+		ETHTokenGasLimit: 100_000,
+		TRXFeeLimit:      100_000_000, // 100 TRX
+
+		BTCNetwork: "mainnet",
+		BTCFeeRate: 10,
+
+		BTCAddressType: "p2wpkh",
+
+		ETHLondon:               true,
+		ETHMaxFeePerGas:         big.NewInt(40_000_000_000), // 40 gwei
+		ETHMaxPriorityFeePerGas: big.NewInt(2_000_000_000),  // 2 gwei
 	}
 }
 
 // FromEnv returns a Config populated from environment variables,
-// falling back to defaults for unset values.
-func FromEnv() Config {
+// falling back to defaults for unset values. Malformed values are
+// reported together in the returned error.
+func FromEnv() (Config, error) {
 	cfg := Default()
+	var p envParser
 
-	if v := os.Getenv("ETH_POLL_INTERVAL"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			cfg.ETHPollInterval = d
-		}
+	p.readDuration("ETH_POLL_INTERVAL", &cfg.ETHPollInterval)
+	p.readDuration("BTC_POLL_INTERVAL", &cfg.BTCPollInterval)
+	p.readDuration("TRX_POLL_INTERVAL", &cfg.TRXPollInterval)
+	p.readString("DATABASE_URL", &cfg.DatabaseURL)
+	p.readString("CHECKPOINT_DIR", &cfg.CheckpointDir)
+	p.readInt("CATCHUP_WORKERS", &cfg.CatchUpWorkers)
+	p.readBool("WATCH_MEMPOOL", &cfg.WatchMempool)
+	p.readString("OUTBOX_DIR", &cfg.OutboxDir)
+	p.readInt("EVENT_MAX_ATTEMPTS", &cfg.EventMaxAttempts)
+	p.readInt("WEBHOOK_MAX_ATTEMPTS", &cfg.WebhookMaxAttempts)
+	p.readDuration("WEBHOOK_TIMEOUT", &cfg.WebhookTimeout)
+	p.readInt("BROADCAST_MAX_RETRIES", &cfg.BroadcastMaxRetries)
+	p.readDuration("CONTEXT_TIMEOUT", &cfg.ContextTimeout)
+	p.readString("ETH_RPC_URL", &cfg.ETHRPCURL)
+	p.readString("ETH_WS_URL", &cfg.ETHWSURL)
+	p.readString("BTC_RPC_URL", &cfg.BTCRPCURL)
+	p.readString("BTC_RPC_USER", &cfg.BTCRPCUser)
+	p.readString("BTC_RPC_PASSWORD", &cfg.BTCRPCPassword)
+	p.readString("TRX_API_URL", &cfg.TRXAPIURL)
+	p.readString("TRX_API_KEY", &cfg.TRXAPIKey)
+	p.readString("TRX_SOLIDITY_URL", &cfg.TRXSolidityURL)
+	p.readConfirmations("ETH", &cfg.ETHConfirmations)
+	p.readConfirmations("BTC", &cfg.BTCConfirmations)
+	p.readConfirmations("TRX", &cfg.TRXConfirmations)
+	p.readDuration("RPC_TIMEOUT", &cfg.RPCTimeout)
+	p.readInt64("ETH_CHAIN_ID", &cfg.ETHChainID)
+	p.readBool("ETH_LONDON", &cfg.ETHLondon)
+	p.readBigInt("ETH_MAX_FEE_PER_GAS", &cfg.ETHMaxFeePerGas)
+	p.readBigInt("ETH_MAX_PRIORITY_FEE_PER_GAS", &cfg.ETHMaxPriorityFeePerGas)
+	p.readUint64("ETH_TOKEN_GAS_LIMIT", &cfg.ETHTokenGasLimit)
+	p.readInt64("TRX_FEE_LIMIT", &cfg.TRXFeeLimit)
+	mainnet := true
+	p.readBool("BTC_MAINNET", &mainnet)
+	if !mainnet {
+		cfg.BTCNetwork = "testnet3"
 	}
-	if v := os.Getenv("BTC_POLL_INTERVAL"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			cfg.BTCPollInterval = d
-		}
+	p.readString("BTC_NETWORK", &cfg.BTCNetwork)
+	p.readString("BTC_ADDRESS_TYPE", &cfg.BTCAddressType)
+	p.readInt64("BTC_FEE_RATE", &cfg.BTCFeeRate)
+
+	return cfg, errors.Join(p.errs...)
+}
+
+// readConfirmations overrides c from <prefix>_CONFIRMATIONS,
+// <prefix>_LARGE_AMOUNT, <prefix>_LARGE_AMOUNT_CONFIRMATIONS and
+// <prefix>_FINALITY.
+func (p *envParser) readConfirmations(prefix string, c *Confirmations) {
+	p.readUint64(prefix+"_CONFIRMATIONS", &c.Depth)
+	p.readBigInt(prefix+"_LARGE_AMOUNT", &c.LargeAmount)
+	p.readUint64(prefix+"_LARGE_AMOUNT_CONFIRMATIONS", &c.LargeAmountDepth)
+	p.readString(prefix+"_FINALITY", &c.Finality)
+}
+
+// envParser reads set environment variables into typed fields, collecting
+// an error for each malformed value and leaving its field unchanged.
+type envParser struct {
+	errs []error
+}
+
+func (p *envParser) fail(name, value string, err error) {
+	p.errs = append(p.errs, fmt.Errorf("%s=%q: %w", name, value, err))
+}
+
+func (p *envParser) readString(name string, dst *string) {
+	if v := os.Getenv(name); v != "" {
+		*dst = v
 	}
-	if v := os.Getenv("TRX_POLL_INTERVAL"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			cfg.TRXPollInterval = d
+}
+
+func (p *envParser) readDuration(name string, dst *time.Duration) {
+	if v := os.Getenv(name); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			p.fail(name, v, err)
+			return
 		}
+		*dst = d
 	}
-	if v := os.Getenv("BROADCAST_MAX_RETRIES"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil {
-			cfg.BroadcastMaxRetries = n
+}
+
+func (p *envParser) readBool(name string, dst *bool) {
+	if v := os.Getenv(name); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			p.fail(name, v, err)
+			return
 		}
+		*dst = b
 	}
-	if v := os.Getenv("CONTEXT_TIMEOUT"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			cfg.ContextTimeout = d
+}
+
+func (p *envParser) readInt(name string, dst *int) {
+	if v := os.Getenv(name); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			p.fail(name, v, err)
+			return
 		}
+		*dst = n
 	}
-	if v := os.Getenv("ETH_CHAIN_ID"); v != "" {
-		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
-			cfg.ETHChainID = n
+}
+
+func (p *envParser) readInt64(name string, dst *int64) {
+	if v := os.Getenv(name); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			p.fail(name, v, err)
+			return
 		}
+		*dst = n
 	}
-	if v := os.Getenv("BTC_MAINNET"); v == "false" {
-		cfg.BTCMainnet = false
+}
+
+func (p *envParser) readUint64(name string, dst *uint64) {
+	if v := os.Getenv(name); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			p.fail(name, v, err)
+			return
+		}
+		*dst = n
 	}
+}
 
-	return cfg
+func (p *envParser) readBigInt(name string, dst **big.Int) {
+	if v := os.Getenv(name); v != "" {
+		n, ok := new(big.Int).SetString(v, 10)
+		if !ok {
+			p.fail(name, v, errors.New("not a base-10 integer"))
+			return
+		}
+		*dst = n
+	}
 }
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestFromEnv_Overrides(t *testing.T) {
+	t.Setenv("ETH_LONDON", "false")
+	t.Setenv("ETH_MAX_FEE_PER_GAS", "50000000000")
+	t.Setenv("BTC_CONFIRMATIONS", "3")
+	t.Setenv("BTC_MAINNET", "false")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.ETHLondon {
+		t.Error("ETHLondon should be false")
+	}
+	if cfg.ETHMaxFeePerGas.Cmp(big.NewInt(50_000_000_000)) != 0 {
+		t.Errorf("ETHMaxFeePerGas = %v, want 50000000000", cfg.ETHMaxFeePerGas)
+	}
+	if cfg.BTCConfirmations.Depth != 3 {
+		t.Errorf("BTCConfirmations.Depth = %d, want 3", cfg.BTCConfirmations.Depth)
+	}
+	if cfg.BTCNetwork != "testnet3" {
+		t.Errorf("BTCNetwork = %q, want testnet3", cfg.BTCNetwork)
+	}
+}
+
+func TestFromEnv_ReportsMalformedValues(t *testing.T) {
+	t.Setenv("ETH_MAX_FEE_PER_GAS", "40gwei")
+	t.Setenv("ETH_MAX_PRIORITY_FEE_PER_GAS", "-")
+	t.Setenv("RPC_TIMEOUT", "10")
+	t.Setenv("ETH_LONDON", "no")
+
+	cfg, err := FromEnv()
+	if err == nil {
+		t.Fatal("expected an error for malformed values")
+	}
+	for _, name := range []string{"ETH_MAX_FEE_PER_GAS", "ETH_MAX_PRIORITY_FEE_PER_GAS", "RPC_TIMEOUT", "ETH_LONDON"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not mention %s", err, name)
+		}
+	}
+	// Malformed values leave the defaults in place.
+	if def := Default(); cfg.ETHMaxFeePerGas.Cmp(def.ETHMaxFeePerGas) != 0 || cfg.RPCTimeout != def.RPCTimeout {
+		t.Errorf("malformed values changed the config: maxFee %v, rpc timeout %v", cfg.ETHMaxFeePerGas, cfg.RPCTimeout)
+	}
+}
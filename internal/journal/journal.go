@@ -0,0 +1,516 @@
+// Package journal records custody operations as double-entry accounting
+// entries for audit.
+//
+// The chart of accounts has, per network and asset:
+//
+//   - hot_wallet (asset): coins held in the wallet's addresses
+//   - user:<id> (liability): what the custody owes each user
+//   - fee_expense (expense): network fees paid on withdrawals
+//   - suspense (liability): transfers not attributable to a user, such as
+//     deposits to unassigned addresses, awaiting reconciliation
+//
+// Deposits come from listener events (Handle) and withdrawals from
+// tx.Builder results (RecordWithdrawal). Entries are immutable: a reorged
+// deposit or dropped withdrawal is undone by a reversal entry.
+package journal
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// AccountType is the accounting class of an account.
+type AccountType string
+
+// Account types. Asset and expense accounts have debit balances, liability
+// accounts credit balances.
+const (
+	TypeAsset     AccountType = "asset"
+	TypeLiability AccountType = "liability"
+	TypeExpense   AccountType = "expense"
+)
+
+// Account names.
+const (
+	HotWallet  = "hot_wallet"
+	FeeExpense = "fee_expense"
+	Suspense   = "suspense"
+)
+
+// Account is a ledger account for one asset. Asset is the token symbol, or
+// the network's native coin (e.g. "ETH").
+type Account struct {
+	Name    string
+	Network models.Network
+	Asset   string
+}
+
+// UserAccount returns the liability account of a user.
+func UserAccount(userID string, network models.Network, asset string) Account {
+	return Account{Name: "user:" + userID, Network: network, Asset: asset}
+}
+
+// Type returns the accounting class of the account.
+func (a Account) Type() AccountType {
+	switch a.Name {
+	case HotWallet:
+		return TypeAsset
+	case FeeExpense:
+		return TypeExpense
+	default:
+		return TypeLiability
+	}
+}
+
+func (a Account) String() string {
+	return a.Name + "/" + string(a.Network) + "/" + a.Asset
+}
+
+// Kind classifies entries.
+type Kind string
+
+// Entry kinds.
+const (
+	KindDeposit    Kind = "deposit"
+	KindWithdrawal Kind = "withdrawal"
+	KindReversal   Kind = "reversal"
+)
+
+// Posting is one line of an entry: an amount debited or credited to an
+// account.
+type Posting struct {
+	Account Account
+	Debit   bool
+	Amount  *big.Int
+}
+
+// Entry is a balanced journal entry: for every network and asset, debits
+// equal credits.
+type Entry struct {
+	ID   uint64
+	Time time.Time
+	Kind Kind
+	// Ref identifies the source: the event ID of a deposit or the tx hash
+	// of a withdrawal.
+	Ref         string
+	Description string
+	// Reverses is the ID of the entry a reversal undoes.
+	Reverses uint64
+	Postings []Posting
+}
+
+func (e Entry) copy() Entry {
+	e.Postings = append([]Posting(nil), e.Postings...)
+	for i := range e.Postings {
+		e.Postings[i].Amount = new(big.Int).Set(e.Postings[i].Amount)
+	}
+	return e
+}
+
+// Journal is an append-only double-entry journal. It is safe for concurrent
+// use.
+type Journal struct {
+	mu      sync.Mutex
+	entries []Entry
+	// users maps deposit addresses to user IDs; hot holds the other wallet
+	// addresses.
+	users map[string]string
+	hot   map[string]bool
+	// transfers maps transfers reported by the listener to the entry that
+	// booked them, while not reversed.
+	transfers map[string]uint64
+	// withdrawals holds the withdrawals recorded by tx hash.
+	withdrawals map[string]*withdrawal
+	now         func() time.Time
+	logger      *slog.Logger
+}
+
+// withdrawal is a withdrawal booked by RecordWithdrawal.
+type withdrawal struct {
+	entry    uint64
+	reversed bool
+}
+
+// New creates an empty journal.
+func New() *Journal {
+	return &Journal{
+		users:       make(map[string]string),
+		hot:         make(map[string]bool),
+		transfers:   make(map[string]uint64),
+		withdrawals: make(map[string]*withdrawal),
+		now:         time.Now,
+		logger:      slog.Default().With("component", "journal"),
+	}
+}
+
+func addressKey(network models.Network, address string) string {
+	if network == models.NetworkETH {
+		address = strings.ToLower(address) // EIP-55 checksums only change case
+	}
+	return string(network) + "/" + address
+}
+
+// AssignAddress records that deposits to address belong to userID.
+func (j *Journal) AssignAddress(network models.Network, address, userID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.users[addressKey(network, address)] = userID
+}
+
+// AddHotWallet registers a wallet address not assigned to a user, e.g. the
+// address withdrawals are paid from.
+func (j *Journal) AddHotWallet(network models.Network, address string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.hot[addressKey(network, address)] = true
+}
+
+func (j *Journal) owned(network models.Network, address string) bool {
+	key := addressKey(network, address)
+	_, user := j.users[key]
+	return user || j.hot[key]
+}
+
+// post validates and appends an entry, returning its ID.
+func (j *Journal) post(e Entry) (uint64, error) {
+	totals := make(map[string]*big.Int) // network/asset -> debits - credits
+	for _, p := range e.Postings {
+		if p.Amount == nil || p.Amount.Sign() < 0 {
+			return 0, fmt.Errorf("posting to %s: invalid amount %v", p.Account, p.Amount)
+		}
+		key := string(p.Account.Network) + "/" + p.Account.Asset
+		if totals[key] == nil {
+			totals[key] = new(big.Int)
+		}
+		if p.Debit {
+			totals[key].Add(totals[key], p.Amount)
+		} else {
+			totals[key].Sub(totals[key], p.Amount)
+		}
+	}
+	for key, total := range totals {
+		if total.Sign() != 0 {
+			return 0, fmt.Errorf("entry %s %s unbalanced for %s by %s", e.Kind, e.Ref, key, total)
+		}
+	}
+	e.ID = uint64(len(j.entries)) + 1
+	e.Time = j.now()
+	j.entries = append(j.entries, e.copy())
+	return e.ID, nil
+}
+
+// reverse posts a reversal of entry id.
+func (j *Journal) reverse(id uint64, reason string) error {
+	orig := j.entries[id-1]
+	rev := Entry{
+		Kind:        KindReversal,
+		Ref:         orig.Ref,
+		Description: fmt.Sprintf("reversal of entry %d: %s", id, reason),
+		Reverses:    id,
+	}
+	for _, p := range orig.Postings {
+		rev.Postings = append(rev.Postings, Posting{Account: p.Account, Debit: !p.Debit, Amount: p.Amount})
+	}
+	_, err := j.post(rev)
+	return err
+}
+
+func assetOf(ev models.BlockEvent) string {
+	if ev.IsToken() {
+		return ev.TokenSymbol
+	}
+	return string(ev.Network)
+}
+
+func transferKey(ev models.BlockEvent) string {
+	return fmt.Sprintf("%s/%s/%d/%d", ev.Network, ev.TxHash, ev.Vout, ev.LogIndex)
+}
+
+// Handle books listener events. It implements listener.EventHandler.
+//
+// A deposit to a wallet address is booked when it is mined, debiting the
+// hot wallet and crediting the user (or suspense for hot wallet addresses),
+// and reversed if it is reorged out. A recorded withdrawal is reversed when
+// its transaction is dropped from the mempool. Outgoing transfers not
+// recorded with RecordWithdrawal are booked against suspense. Transfers
+// between wallet addresses and other mempool events are not booked.
+func (j *Journal) Handle(ev models.BlockEvent) error {
+	if ev.Alert != "" || ev.Amount == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	toOwned, fromOwned := j.owned(ev.Network, ev.To), j.owned(ev.Network, ev.From)
+	if fromOwned {
+		if w, ok := j.withdrawals[txKey(ev.Network, ev.TxHash)]; ok {
+			if ev.Dropped && !w.reversed {
+				return j.reverseWithdrawal(w, "transaction dropped")
+			}
+			return nil // booked by RecordWithdrawal
+		}
+	}
+	if ev.Pending || ev.Dropped {
+		return nil
+	}
+	switch {
+	case toOwned && fromOwned:
+		return nil
+	case toOwned:
+		return j.handleTransfer(ev, KindDeposit)
+	case fromOwned:
+		return j.handleTransfer(ev, KindWithdrawal)
+	}
+	return nil
+}
+
+func txKey(network models.Network, txHash string) string {
+	return string(network) + "/" + txHash
+}
+
+// handleTransfer books or reverses a transfer reported by the listener.
+func (j *Journal) handleTransfer(ev models.BlockEvent, kind Kind) error {
+	key := transferKey(ev) + "/" + string(kind)
+	id, booked := j.transfers[key]
+	if ev.Reorged {
+		if !booked {
+			return nil
+		}
+		if err := j.reverse(id, "reorged"); err != nil {
+			return err
+		}
+		delete(j.transfers, key)
+		j.logger.Info("transfer reversed after reorg", "tx", ev.TxHash, "entry", id)
+		return nil
+	}
+	if booked {
+		return nil // progress, confirmation or redelivery
+	}
+
+	asset := assetOf(ev)
+	hot := Account{Name: HotWallet, Network: ev.Network, Asset: asset}
+	counter := Account{Name: Suspense, Network: ev.Network, Asset: asset}
+	entry := Entry{Kind: kind, Ref: ev.ID}
+	if kind == KindDeposit {
+		if user, ok := j.users[addressKey(ev.Network, ev.To)]; ok {
+			counter = UserAccount(user, ev.Network, asset)
+		}
+		entry.Description = fmt.Sprintf("deposit %s %s to %s in tx %s", ev.Amount, asset, ev.To, ev.TxHash)
+		entry.Postings = []Posting{
+			{Account: hot, Debit: true, Amount: ev.Amount},
+			{Account: counter, Amount: ev.Amount},
+		}
+	} else {
+		entry.Description = fmt.Sprintf("unrecorded withdrawal %s %s from %s in tx %s", ev.Amount, asset, ev.From, ev.TxHash)
+		entry.Postings = []Posting{
+			{Account: counter, Debit: true, Amount: ev.Amount},
+			{Account: hot, Amount: ev.Amount},
+		}
+	}
+	if entry.Ref == "" {
+		entry.Ref = ev.TxHash
+	}
+	id, err := j.post(entry)
+	if err != nil {
+		return err
+	}
+	j.transfers[key] = id
+	return nil
+}
+
+// RecordWithdrawal books a withdrawal sent for userID with tx.Builder: the
+// amount moves from the user's liability out of the hot wallet, and the fee
+// is booked as an expense in the native coin. Recording the same
+// transaction again has no effect.
+func (j *Journal) RecordWithdrawal(userID string, tx *models.Transaction) error {
+	if tx == nil || tx.TxHash == "" {
+		return fmt.Errorf("record withdrawal: transaction has no hash")
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key := txKey(tx.Network, tx.TxHash)
+	if _, ok := j.withdrawals[key]; ok {
+		return nil
+	}
+
+	asset, amount, to := string(tx.Network), tx.Amount, tx.To
+	if tx.Token != nil {
+		asset, amount, to = tx.Token.Symbol, tx.Token.Amount, tx.Token.Recipient
+	}
+	if amount == nil {
+		amount = new(big.Int)
+	}
+	entry := Entry{
+		Kind:        KindWithdrawal,
+		Ref:         tx.TxHash,
+		Description: fmt.Sprintf("withdrawal %s %s for user %s to %s", amount, asset, userID, to),
+		Postings: []Posting{
+			{Account: UserAccount(userID, tx.Network, asset), Debit: true, Amount: amount},
+			{Account: Account{Name: HotWallet, Network: tx.Network, Asset: asset}, Amount: amount},
+		},
+	}
+	if tx.Fee != nil && tx.Fee.Sign() > 0 {
+		native := string(tx.Network)
+		entry.Postings = append(entry.Postings,
+			Posting{Account: Account{Name: FeeExpense, Network: tx.Network, Asset: native}, Debit: true, Amount: tx.Fee},
+			Posting{Account: Account{Name: HotWallet, Network: tx.Network, Asset: native}, Amount: tx.Fee},
+		)
+	}
+	id, err := j.post(entry)
+	if err != nil {
+		return fmt.Errorf("record withdrawal: %w", err)
+	}
+	j.withdrawals[key] = &withdrawal{entry: id}
+	return nil
+}
+
+// ReverseWithdrawal reverses a recorded withdrawal whose transaction was
+// dropped or failed. It is a no-op if the withdrawal is unknown or already
+// reversed.
+func (j *Journal) ReverseWithdrawal(network models.Network, txHash, reason string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	w, ok := j.withdrawals[txKey(network, txHash)]
+	if !ok || w.reversed {
+		return nil
+	}
+	return j.reverseWithdrawal(w, reason)
+}
+
+// reverseWithdrawal reverses a withdrawal. The withdrawal stays recorded so
+// late listener events of its transaction are not booked as unrecorded.
+func (j *Journal) reverseWithdrawal(w *withdrawal, reason string) error {
+	if err := j.reverse(w.entry, reason); err != nil {
+		return err
+	}
+	w.reversed = true
+	j.logger.Warn("withdrawal reversed", "entry", w.entry, "reason", reason)
+	return nil
+}
+
+// Entries returns all entries in posting order.
+func (j *Journal) Entries() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	result := make([]Entry, len(j.entries))
+	for i, e := range j.entries {
+		result[i] = e.copy()
+	}
+	return result
+}
+
+// signed returns the posting amount in the account's normal balance
+// direction: positive for debits to asset and expense accounts and credits
+// to liability accounts.
+func signed(p Posting) *big.Int {
+	v := new(big.Int).Set(p.Amount)
+	if p.Debit == (p.Account.Type() == TypeLiability) {
+		v.Neg(v)
+	}
+	return v
+}
+
+// TrialBalanceLine is the total of one account.
+type TrialBalanceLine struct {
+	Account Account
+	Debits  *big.Int
+	Credits *big.Int
+	// Balance is in the account's normal direction (see AccountType).
+	Balance *big.Int
+}
+
+// TrialBalance returns the totals of every account, ordered by network,
+// asset and account name, and whether debits equal credits per asset.
+func (j *Journal) TrialBalance() ([]TrialBalanceLine, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	lines := make(map[Account]*TrialBalanceLine)
+	for _, e := range j.entries {
+		for _, p := range e.Postings {
+			line, ok := lines[p.Account]
+			if !ok {
+				line = &TrialBalanceLine{Account: p.Account, Debits: new(big.Int), Credits: new(big.Int), Balance: new(big.Int)}
+				lines[p.Account] = line
+			}
+			if p.Debit {
+				line.Debits.Add(line.Debits, p.Amount)
+			} else {
+				line.Credits.Add(line.Credits, p.Amount)
+			}
+			line.Balance.Add(line.Balance, signed(p))
+		}
+	}
+
+	result := make([]TrialBalanceLine, 0, len(lines))
+	net := make(map[string]*big.Int) // network/asset -> debits - credits
+	for _, line := range lines {
+		result = append(result, *line)
+		key := string(line.Account.Network) + "/" + line.Account.Asset
+		if net[key] == nil {
+			net[key] = new(big.Int)
+		}
+		net[key].Add(net[key], line.Debits)
+		net[key].Sub(net[key], line.Credits)
+	}
+	sort.Slice(result, func(i, k int) bool {
+		a, b := result[i].Account, result[k].Account
+		if a.Network != b.Network {
+			return a.Network < b.Network
+		}
+		if a.Asset != b.Asset {
+			return a.Asset < b.Asset
+		}
+		return a.Name < b.Name
+	})
+	balanced := true
+	for _, v := range net {
+		balanced = balanced && v.Sign() == 0
+	}
+	return result, balanced
+}
+
+// StatementLine is a posting to an account with the running balance.
+type StatementLine struct {
+	EntryID     uint64
+	Time        time.Time
+	Kind        Kind
+	Ref         string
+	Description string
+	Debit       bool
+	Amount      *big.Int
+	Balance     *big.Int
+}
+
+// Statement returns the postings to an account in entry order.
+func (j *Journal) Statement(account Account) []StatementLine {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var lines []StatementLine
+	balance := new(big.Int)
+	for _, e := range j.entries {
+		for _, p := range e.Postings {
+			if p.Account != account {
+				continue
+			}
+			balance.Add(balance, signed(p))
+			lines = append(lines, StatementLine{
+				EntryID:     e.ID,
+				Time:        e.Time,
+				Kind:        e.Kind,
+				Ref:         e.Ref,
+				Description: e.Description,
+				Debit:       p.Debit,
+				Amount:      new(big.Int).Set(p.Amount),
+				Balance:     new(big.Int).Set(balance),
+			})
+		}
+	}
+	return lines
+}
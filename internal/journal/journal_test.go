@@ -0,0 +1,187 @@
+package journal
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+const (
+	alice   = "0xA11ce00000000000000000000000000000000001"
+	hot     = "0x4070000000000000000000000000000000000002"
+	outside = "0x0075100000000000000000000000000000000003"
+	usdt    = "0xdac17f958d2ee523a2206206994597c13d831ec7"
+)
+
+func newTestJournal() *Journal {
+	j := New()
+	j.AssignAddress(models.NetworkETH, alice, "alice")
+	j.AddHotWallet(models.NetworkETH, hot)
+	return j
+}
+
+// balances returns the trial balance by account and fails if it does not
+// balance.
+func balances(t *testing.T, j *Journal) map[Account]int64 {
+	t.Helper()
+	lines, balanced := j.TrialBalance()
+	if !balanced {
+		t.Fatalf("trial balance does not balance: %+v", lines)
+	}
+	result := make(map[Account]int64)
+	for _, line := range lines {
+		result[line.Account] = line.Balance.Int64()
+	}
+	return result
+}
+
+func TestJournal_DepositAndReorgReversal(t *testing.T) {
+	j := newTestJournal()
+	dep := models.BlockEvent{ID: "ev1", Network: models.NetworkETH, BlockNumber: 100, TxHash: "0xd1", From: outside, To: alice, Amount: big.NewInt(1_000)}
+
+	pending := dep
+	pending.Pending, pending.BlockNumber = true, 0
+	for _, ev := range []models.BlockEvent{pending, dep, dep} {
+		if err := j.Handle(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reorged := dep
+	reorged.Reorged = true
+	if err := j.Handle(reorged); err != nil {
+		t.Fatal(err)
+	}
+	dep.BlockNumber = 101 // re-included on the new branch
+	confirmed := dep
+	confirmed.Confirmed = true
+	for _, ev := range []models.BlockEvent{dep, confirmed, confirmed} {
+		if err := j.Handle(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := j.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want deposit, reversal, deposit", len(entries))
+	}
+	if rev := entries[1]; rev.Kind != KindReversal || rev.Reverses != 1 || rev.Ref != "ev1" {
+		t.Errorf("reversal entry = %+v", rev)
+	}
+	for i, p := range entries[1].Postings {
+		if orig := entries[0].Postings[i]; p.Account != orig.Account || p.Debit == orig.Debit || p.Amount.Cmp(orig.Amount) != 0 {
+			t.Errorf("reversal posting %d = %+v, want the opposite of %+v", i, p, orig)
+		}
+	}
+
+	user := UserAccount("alice", models.NetworkETH, "ETH")
+	got := balances(t, j)
+	if got[Account{Name: HotWallet, Network: models.NetworkETH, Asset: "ETH"}] != 1_000 || got[user] != 1_000 {
+		t.Errorf("balances = %v", got)
+	}
+
+	statement := j.Statement(user)
+	want := []int64{1_000, 0, 1_000}
+	if len(statement) != len(want) {
+		t.Fatalf("statement = %+v", statement)
+	}
+	for i, line := range statement {
+		if line.Balance.Int64() != want[i] || line.EntryID != uint64(i+1) {
+			t.Errorf("statement line %d = %+v, want balance %d", i, line, want[i])
+		}
+	}
+
+	// Entries handed out are copies.
+	entries[0].Postings[0].Amount.SetInt64(1)
+	if j.Entries()[0].Postings[0].Amount.Int64() != 1_000 {
+		t.Error("entries are mutable through Entries")
+	}
+}
+
+func TestJournal_Withdrawals(t *testing.T) {
+	j := newTestJournal()
+	for _, ev := range []models.BlockEvent{
+		{ID: "ev1", Network: models.NetworkETH, TxHash: "0xd1", From: outside, To: alice, Amount: big.NewInt(10_000), Confirmed: true},
+		{ID: "ev2", Network: models.NetworkETH, TxHash: "0xd2", From: outside, To: alice, Amount: big.NewInt(500), Confirmed: true,
+			TokenContract: usdt, TokenSymbol: "USDT", LogIndex: 3},
+	} {
+		if err := j.Handle(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send := &models.Transaction{Network: models.NetworkETH, From: hot, To: outside, Amount: big.NewInt(3_000), Fee: big.NewInt(21), TxHash: "0xs1"}
+	tokenSend := &models.Transaction{Network: models.NetworkETH, From: hot, To: usdt, Amount: big.NewInt(0), Fee: big.NewInt(65), TxHash: "0xs2",
+		Token: &models.TokenTransfer{Contract: usdt, Symbol: "USDT", Recipient: outside, Amount: big.NewInt(200)}}
+	for _, tx := range []*models.Transaction{send, send, tokenSend} {
+		if err := j.RecordWithdrawal("alice", tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Listener events of recorded withdrawals are not booked again.
+	if err := j.Handle(models.BlockEvent{Network: models.NetworkETH, TxHash: "0xs1", From: hot, To: outside, Amount: big.NewInt(3_000), Confirmed: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	ethHot := Account{Name: HotWallet, Network: models.NetworkETH, Asset: "ETH"}
+	fees := Account{Name: FeeExpense, Network: models.NetworkETH, Asset: "ETH"}
+	aliceETH := UserAccount("alice", models.NetworkETH, "ETH")
+	aliceUSDT := UserAccount("alice", models.NetworkETH, "USDT")
+	got := balances(t, j)
+	if got[ethHot] != 10_000-3_000-21-65 || got[fees] != 86 || got[aliceETH] != 7_000 || got[aliceUSDT] != 300 {
+		t.Errorf("balances after withdrawals = %v", got)
+	}
+
+	// The token withdrawal is dropped: its amount and fee are reversed.
+	dropped := models.BlockEvent{Network: models.NetworkETH, TxHash: "0xs2", From: hot, To: outside, Amount: big.NewInt(200),
+		TokenContract: usdt, TokenSymbol: "USDT", Pending: true, Dropped: true}
+	for i := 0; i < 2; i++ {
+		if err := j.Handle(dropped); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got = balances(t, j)
+	if got[ethHot] != 10_000-3_000-21 || got[fees] != 21 || got[aliceUSDT] != 500 {
+		t.Errorf("balances after dropped withdrawal = %v", got)
+	}
+
+	// Transfers nobody recorded land in suspense for reconciliation.
+	if err := j.Handle(models.BlockEvent{ID: "ev3", Network: models.NetworkETH, TxHash: "0xe1", From: hot, To: outside, Amount: big.NewInt(100)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Handle(models.BlockEvent{ID: "ev4", Network: models.NetworkETH, TxHash: "0xe2", From: outside, To: hot, Amount: big.NewInt(40)}); err != nil {
+		t.Fatal(err)
+	}
+	// Sweeps between wallet addresses are not booked.
+	if err := j.Handle(models.BlockEvent{ID: "ev5", Network: models.NetworkETH, TxHash: "0xe3", From: alice, To: hot, Amount: big.NewInt(7_000)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := balances(t, j)[Account{Name: Suspense, Network: models.NetworkETH, Asset: "ETH"}]; got != -60 {
+		t.Errorf("suspense = %d, want -60", got)
+	}
+	if n := len(j.Entries()); n != 7 {
+		t.Errorf("got %d entries, want 7", n)
+	}
+}
+
+func TestJournal_RejectsUnbalancedEntry(t *testing.T) {
+	j := New()
+	_, err := j.post(Entry{Kind: KindDeposit, Postings: []Posting{
+		{Account: Account{Name: HotWallet, Network: models.NetworkBTC, Asset: "BTC"}, Debit: true, Amount: big.NewInt(10)},
+		{Account: UserAccount("bob", models.NetworkBTC, "BTC"), Amount: big.NewInt(9)},
+	}})
+	if err == nil {
+		t.Fatal("unbalanced entry accepted")
+	}
+	// Debits and credits must balance per asset, not in total.
+	_, err = j.post(Entry{Kind: KindDeposit, Postings: []Posting{
+		{Account: Account{Name: HotWallet, Network: models.NetworkETH, Asset: "ETH"}, Debit: true, Amount: big.NewInt(10)},
+		{Account: UserAccount("bob", models.NetworkETH, "USDT"), Amount: big.NewInt(10)},
+	}})
+	if err == nil {
+		t.Fatal("entry balanced across assets accepted")
+	}
+	if len(j.Entries()) != 0 {
+		t.Error("rejected entries were posted")
+	}
+}
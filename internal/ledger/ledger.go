@@ -0,0 +1,485 @@
+// Package ledger maintains per-address, per-asset balances of the wallet's
+// own addresses from listener events and sent transactions.
+//
+// A balance has three parts:
+//
+//   - Confirmed: confirmed incoming transfers minus confirmed outgoing
+//     transfers and fees
+//   - Pending: incoming transfers seen in the mempool or in blocks that are
+//     not yet confirmed
+//   - Locked: outgoing transfers not yet confirmed, including the fee of
+//     transactions sent through tx.Builder
+//
+// The available balance is Confirmed minus Locked. Events are applied
+// idempotently, so redelivered events do not change balances.
+package ledger
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// Balance is the balance of one asset on one address.
+type Balance struct {
+	Confirmed *big.Int `json:"confirmed"`
+	Pending   *big.Int `json:"pending"`
+	Locked    *big.Int `json:"locked"`
+}
+
+// Available returns the spendable amount: Confirmed minus Locked.
+func (b Balance) Available() *big.Int {
+	return new(big.Int).Sub(b.Confirmed, b.Locked)
+}
+
+func newBalance() *Balance {
+	return &Balance{Confirmed: new(big.Int), Pending: new(big.Int), Locked: new(big.Int)}
+}
+
+func (b *Balance) copy() Balance {
+	return Balance{
+		Confirmed: new(big.Int).Set(b.Confirmed),
+		Pending:   new(big.Int).Set(b.Pending),
+		Locked:    new(big.Int).Set(b.Locked),
+	}
+}
+
+// Asset returns the asset of an event: the token symbol for token
+// transfers, the network's native coin (e.g. "ETH") otherwise.
+func Asset(ev models.BlockEvent) string {
+	if ev.IsToken() {
+		return ev.TokenSymbol
+	}
+	return string(ev.Network)
+}
+
+// account identifies a balance.
+type account struct {
+	network models.Network
+	address string
+	asset   string
+}
+
+// posting is a transfer applied to a balance: a credit to Pending or
+// Confirmed, or a debit to Locked or Confirmed.
+type posting struct {
+	account   account
+	txKey     string
+	amount    *big.Int
+	credit    bool
+	confirmed bool
+	// mempool marks postings of pending (unmined) events; they are replaced
+	// by the postings of the mined transaction.
+	mempool bool
+}
+
+// sentTx is an outgoing transaction recorded from tx.Builder. Its amount
+// and fee stay locked until the transaction confirms or is dropped.
+type sentTx struct {
+	locks   map[account]*big.Int
+	fee     *big.Int
+	feeAcct account
+	settled bool
+}
+
+// Ledger tracks the balances of tracked addresses. It is safe for
+// concurrent use.
+type Ledger struct {
+	mu       sync.Mutex
+	owned    map[account]bool // network and address; asset is empty
+	balances map[account]*Balance
+	// postings holds applied transfers by event key; byTx indexes their
+	// keys by transaction.
+	postings map[string]*posting
+	byTx     map[string][]string
+	sent     map[string]*sentTx
+	logger   *slog.Logger
+}
+
+// New creates an empty ledger.
+func New() *Ledger {
+	return &Ledger{
+		owned:    make(map[account]bool),
+		balances: make(map[account]*Balance),
+		postings: make(map[string]*posting),
+		byTx:     make(map[string][]string),
+		sent:     make(map[string]*sentTx),
+		logger:   slog.Default().With("component", "ledger"),
+	}
+}
+
+// Track adds an address of the wallet. Only transfers to or from tracked
+// addresses change balances.
+func (l *Ledger) Track(network models.Network, address string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.owned[account{network: network, address: normalize(network, address)}] = true
+}
+
+// normalize returns the canonical form of an address for map keys. ETH
+// addresses are case-insensitive; the case is only an EIP-55 checksum.
+func normalize(network models.Network, address string) string {
+	if network == models.NetworkETH {
+		return strings.ToLower(address)
+	}
+	return address
+}
+
+func (l *Ledger) isOwned(network models.Network, address string) bool {
+	return l.owned[account{network: network, address: normalize(network, address)}]
+}
+
+func (l *Ledger) balance(acct account) *Balance {
+	b, ok := l.balances[acct]
+	if !ok {
+		b = newBalance()
+		l.balances[acct] = b
+	}
+	return b
+}
+
+// Balance returns the balance of asset on address; see Asset for asset
+// names. Unknown balances are zero.
+func (l *Ledger) Balance(network models.Network, address, asset string) Balance {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	acct := account{network: network, address: normalize(network, address), asset: asset}
+	if b, ok := l.balances[acct]; ok {
+		return b.copy()
+	}
+	return newBalance().copy()
+}
+
+// Balances returns the balances of every asset seen on address, by asset.
+func (l *Ledger) Balances(network models.Network, address string) map[string]Balance {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	address = normalize(network, address)
+	result := make(map[string]Balance)
+	for acct, b := range l.balances {
+		if acct.network == network && acct.address == address {
+			result[acct.asset] = b.copy()
+		}
+	}
+	return result
+}
+
+// Available returns the spendable amount of asset on address.
+func (l *Ledger) Available(network models.Network, address, asset string) *big.Int {
+	return l.Balance(network, address, asset).Available()
+}
+
+// Pending returns the unconfirmed incoming amount of asset on address.
+func (l *Ledger) Pending(network models.Network, address, asset string) *big.Int {
+	return l.Balance(network, address, asset).Pending
+}
+
+// Locked returns the unconfirmed outgoing amount of asset on address.
+func (l *Ledger) Locked(network models.Network, address, asset string) *big.Int {
+	return l.Balance(network, address, asset).Locked
+}
+
+// Addresses returns the tracked addresses of a network, sorted.
+func (l *Ledger) Addresses(network models.Network) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var result []string
+	for acct := range l.owned {
+		if acct.network == network {
+			result = append(result, acct.address)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func txKey(network models.Network, txHash string) string {
+	return string(network) + "/" + txHash
+}
+
+// eventKey identifies the transfer of an event, independent of its state.
+func eventKey(ev models.BlockEvent, credit bool) string {
+	dir := "out"
+	if credit {
+		dir = "in"
+	}
+	return fmt.Sprintf("%s/%s/%d/%d/%s", ev.Network, ev.TxHash, ev.Vout, ev.LogIndex, dir)
+}
+
+// Handle applies a listener event. It implements listener.EventHandler.
+func (l *Ledger) Handle(ev models.BlockEvent) error {
+	if ev.Alert != "" || ev.Amount == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !ev.Pending && !ev.Dropped {
+		// The mined transaction replaces its mempool postings; mempool and
+		// block events of token transfers need not share a log index.
+		l.releaseMempool(txKey(ev.Network, ev.TxHash))
+	}
+	if l.isOwned(ev.Network, ev.To) {
+		l.applyIncoming(ev)
+	}
+	if l.isOwned(ev.Network, ev.From) {
+		l.applyOutgoing(ev)
+	}
+	return nil
+}
+
+// applyIncoming credits Pending while the transfer is unconfirmed and moves
+// it to Confirmed once confirmed.
+func (l *Ledger) applyIncoming(ev models.BlockEvent) {
+	key := eventKey(ev, true)
+	p, exists := l.postings[key]
+	switch {
+	case ev.Dropped || ev.Reorged:
+		if exists {
+			l.reverse(key, p)
+			l.logger.Info("incoming transfer reversed",
+				"network", ev.Network,
+				"tx", ev.TxHash,
+				"to", ev.To,
+				"amount", ev.Amount,
+				"reorged", ev.Reorged,
+			)
+		}
+	case ev.Confirmed:
+		if exists && p.confirmed {
+			return
+		}
+		if exists {
+			l.balance(p.account).Pending.Sub(l.balance(p.account).Pending, p.amount)
+		} else {
+			p = l.add(key, ev, ev.To, true)
+		}
+		p.confirmed = true
+		b := l.balance(p.account)
+		b.Confirmed.Add(b.Confirmed, p.amount)
+	default:
+		if !exists {
+			p = l.add(key, ev, ev.To, true)
+			b := l.balance(p.account)
+			b.Pending.Add(b.Pending, p.amount)
+		}
+	}
+}
+
+// applyOutgoing locks unconfirmed outgoing transfers and debits Confirmed
+// once confirmed. Transactions recorded with RecordSent are already locked.
+func (l *Ledger) applyOutgoing(ev models.BlockEvent) {
+	tk := txKey(ev.Network, ev.TxHash)
+	if s, ok := l.sent[tk]; ok {
+		l.applySent(tk, s, ev)
+		return
+	}
+
+	key := eventKey(ev, false)
+	p, exists := l.postings[key]
+	switch {
+	case ev.Dropped || ev.Reorged:
+		if exists {
+			l.reverse(key, p)
+		}
+	case ev.Confirmed:
+		if exists && p.confirmed {
+			return
+		}
+		if exists {
+			l.balance(p.account).Locked.Sub(l.balance(p.account).Locked, p.amount)
+		} else {
+			p = l.add(key, ev, ev.From, false)
+		}
+		p.confirmed = true
+		b := l.balance(p.account)
+		b.Confirmed.Sub(b.Confirmed, p.amount)
+	default:
+		if !exists {
+			p = l.add(key, ev, ev.From, false)
+			b := l.balance(p.account)
+			b.Locked.Add(b.Locked, p.amount)
+		}
+	}
+}
+
+// applySent settles a transaction recorded with RecordSent: once it
+// confirms, its transfers and fee are debited and its locks released; if it
+// is dropped, the locks are released.
+func (l *Ledger) applySent(tk string, s *sentTx, ev models.BlockEvent) {
+	switch {
+	case ev.Dropped:
+		if !s.settled {
+			l.unlock(s)
+			delete(l.sent, tk)
+			l.logger.Warn("sent transaction dropped, funds unlocked",
+				"network", ev.Network,
+				"tx", ev.TxHash,
+				"replaced_by", ev.ReplacedBy,
+			)
+		}
+	case ev.Confirmed:
+		key := eventKey(ev, false)
+		if _, ok := l.postings[key]; ok {
+			return
+		}
+		p := l.add(key, ev, ev.From, false)
+		p.confirmed = true
+		b := l.balance(p.account)
+		b.Confirmed.Sub(b.Confirmed, p.amount)
+		if !s.settled {
+			l.settle(s)
+		}
+	}
+	// Detected, pending and reorged events leave the transaction locked:
+	// it may still be mined on the new branch.
+}
+
+// settle releases the locks of a sent transaction and debits its fee.
+func (l *Ledger) settle(s *sentTx) {
+	s.settled = true
+	l.unlock(s)
+	if s.fee.Sign() > 0 {
+		b := l.balance(s.feeAcct)
+		b.Confirmed.Sub(b.Confirmed, s.fee)
+	}
+}
+
+func (l *Ledger) unlock(s *sentTx) {
+	for acct, amount := range s.locks {
+		b := l.balance(acct)
+		b.Locked.Sub(b.Locked, amount)
+	}
+}
+
+// add records a posting for the event on address.
+func (l *Ledger) add(key string, ev models.BlockEvent, address string, credit bool) *posting {
+	tk := txKey(ev.Network, ev.TxHash)
+	p := &posting{
+		account: account{network: ev.Network, address: normalize(ev.Network, address), asset: Asset(ev)},
+		txKey:   tk,
+		amount:  new(big.Int).Set(ev.Amount),
+		credit:  credit,
+		mempool: ev.Pending,
+	}
+	l.postings[key] = p
+	l.byTx[tk] = append(l.byTx[tk], key)
+	return p
+}
+
+// reverse undoes a posting and forgets it.
+func (l *Ledger) reverse(key string, p *posting) {
+	b := l.balance(p.account)
+	switch {
+	case p.credit && p.confirmed:
+		b.Confirmed.Sub(b.Confirmed, p.amount)
+	case p.credit:
+		b.Pending.Sub(b.Pending, p.amount)
+	case p.confirmed:
+		b.Confirmed.Add(b.Confirmed, p.amount)
+	default:
+		b.Locked.Sub(b.Locked, p.amount)
+	}
+	delete(l.postings, key)
+	keys := l.byTx[p.txKey]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(l.byTx, p.txKey)
+	} else {
+		l.byTx[p.txKey] = keys
+	}
+}
+
+// releaseMempool reverses the mempool postings of a transaction.
+func (l *Ledger) releaseMempool(tk string) {
+	for _, key := range append([]string(nil), l.byTx[tk]...) {
+		if p := l.postings[key]; p.mempool {
+			l.reverse(key, p)
+		}
+	}
+}
+
+// RecordSent locks the amount and fee of a transaction returned by
+// tx.Builder.Send or SendToken until the listener reports it confirmed or
+// dropped. Recording the same transaction again has no effect.
+func (l *Ledger) RecordSent(tx *models.Transaction) error {
+	if tx == nil || tx.TxHash == "" {
+		return fmt.Errorf("record sent: transaction has no hash")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.isOwned(tx.Network, tx.From) {
+		return fmt.Errorf("record sent: %s address %s is not tracked", tx.Network, tx.From)
+	}
+	tk := txKey(tx.Network, tx.TxHash)
+	if _, ok := l.sent[tk]; ok {
+		return nil
+	}
+
+	from := normalize(tx.Network, tx.From)
+	native := account{network: tx.Network, address: from, asset: string(tx.Network)}
+	s := &sentTx{locks: make(map[account]*big.Int), fee: new(big.Int), feeAcct: native}
+	if tx.Fee != nil {
+		s.fee.Set(tx.Fee)
+	}
+	if tx.Token != nil {
+		tokenAcct := account{network: tx.Network, address: from, asset: tx.Token.Symbol}
+		s.locks[tokenAcct] = new(big.Int).Set(tx.Token.Amount)
+		s.locks[native] = new(big.Int).Set(s.fee)
+	} else {
+		// A UTXO send spends whole inputs: change is locked with the
+		// payment until it comes back as a confirmed incoming transfer.
+		spent := amountOrZero(tx.Amount)
+		if len(tx.Outputs) > 0 {
+			spent = new(big.Int)
+			for _, out := range tx.Outputs {
+				spent.Add(spent, out.Amount)
+			}
+		}
+		s.locks[native] = new(big.Int).Add(s.fee, spent)
+	}
+
+	// Outgoing transfers the listener reported before the transaction was
+	// recorded are superseded by its locks.
+	confirmed := false
+	for _, key := range append([]string(nil), l.byTx[tk]...) {
+		p := l.postings[key]
+		switch {
+		case p.credit:
+		case p.confirmed:
+			confirmed = true
+		default:
+			l.reverse(key, p)
+		}
+	}
+	l.sent[tk] = s
+	if confirmed {
+		// Already settled on chain: only the fee is left to debit.
+		s.settled = true
+		b := l.balance(native)
+		b.Confirmed.Sub(b.Confirmed, s.fee)
+		return nil
+	}
+	for acct, amount := range s.locks {
+		b := l.balance(acct)
+		b.Locked.Add(b.Locked, amount)
+	}
+	return nil
+}
+
+func amountOrZero(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return v
+}
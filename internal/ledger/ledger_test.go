@@ -0,0 +1,198 @@
+package ledger
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+const (
+	wallet   = "0xAbCdEf0000000000000000000000000000000001"
+	customer = "0x1111111111111111111111111111111111111111"
+)
+
+// checkBalance compares a balance with confirmed, pending and locked amounts.
+func checkBalance(t *testing.T, l *Ledger, network models.Network, address, asset string, confirmed, pending, locked int64) {
+	t.Helper()
+	b := l.Balance(network, address, asset)
+	if b.Confirmed.Int64() != confirmed || b.Pending.Int64() != pending || b.Locked.Int64() != locked {
+		t.Errorf("%s %s balance = confirmed %s, pending %s, locked %s; want %d, %d, %d",
+			address, asset, b.Confirmed, b.Pending, b.Locked, confirmed, pending, locked)
+	}
+}
+
+func ethEvent(txHash, from, to string, amount int64) models.BlockEvent {
+	return models.BlockEvent{
+		Network:     models.NetworkETH,
+		BlockNumber: 100,
+		TxHash:      txHash,
+		From:        from,
+		To:          to,
+		Amount:      big.NewInt(amount),
+	}
+}
+
+func TestLedger_IncomingLifecycle(t *testing.T) {
+	l := New()
+	l.Track(models.NetworkETH, wallet)
+
+	dep := ethEvent("0xd1", customer, wallet, 1_000)
+	pending := dep
+	pending.Pending, pending.BlockNumber = true, 0
+
+	l.Handle(pending)
+	l.Handle(pending) // redelivered
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 0, 1_000, 0)
+
+	l.Handle(dep) // mined: replaces the mempool credit
+	progress := dep
+	progress.Confirmations = 3
+	l.Handle(progress)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 0, 1_000, 0)
+
+	confirmed := dep
+	confirmed.Confirmed, confirmed.Confirmations = true, 12
+	l.Handle(confirmed)
+	l.Handle(confirmed)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 1_000, 0, 0)
+
+	// Addresses are matched case-insensitively on ETH.
+	if got := l.Available(models.NetworkETH, "0xabcdef0000000000000000000000000000000001", "ETH"); got.Int64() != 1_000 {
+		t.Errorf("Available = %s, want 1000", got)
+	}
+	// Transfers between foreign addresses are ignored.
+	l.Handle(ethEvent("0xd2", customer, "0xother", 5))
+	if got := l.Balances(models.NetworkETH, "0xother"); len(got) != 0 {
+		t.Errorf("foreign address balances = %v", got)
+	}
+}
+
+func TestLedger_ReorgAndDropReversal(t *testing.T) {
+	l := New()
+	l.Track(models.NetworkETH, wallet)
+
+	dep := ethEvent("0xd1", customer, wallet, 700)
+	usdt := ethEvent("0xd2", customer, wallet, 50_000_000)
+	usdt.TokenContract, usdt.TokenSymbol, usdt.LogIndex = "0xdac17f958d2ee523a2206206994597c13d831ec7", "USDT", 4
+	l.Handle(dep)
+	l.Handle(usdt)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 0, 700, 0)
+	checkBalance(t, l, models.NetworkETH, wallet, "USDT", 0, 50_000_000, 0)
+
+	reorged := dep
+	reorged.Reorged = true
+	l.Handle(reorged)
+	l.Handle(reorged)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 0, 0, 0)
+	checkBalance(t, l, models.NetworkETH, wallet, "USDT", 0, 50_000_000, 0)
+
+	// Re-included on the new branch at another height.
+	dep.BlockNumber = 101
+	l.Handle(dep)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 0, 700, 0)
+
+	mempool := ethEvent("0xd3", customer, wallet, 40)
+	mempool.Pending, mempool.BlockNumber = true, 0
+	l.Handle(mempool)
+	dropped := mempool
+	dropped.Dropped, dropped.ReplacedBy = true, "0xd4"
+	l.Handle(dropped)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 0, 700, 0)
+
+	if got := l.Balances(models.NetworkETH, wallet); len(got) != 2 || got["USDT"].Pending.Int64() != 50_000_000 {
+		t.Errorf("Balances = %v", got)
+	}
+}
+
+func TestLedger_SentTransactions(t *testing.T) {
+	l := New()
+	l.Track(models.NetworkETH, wallet)
+	l.Handle(models.BlockEvent{Network: models.NetworkETH, TxHash: "0xd0", From: customer, To: wallet, Amount: big.NewInt(10_000), Confirmed: true})
+	usdtDep := models.BlockEvent{Network: models.NetworkETH, TxHash: "0xd0", From: customer, To: wallet, Amount: big.NewInt(500), Confirmed: true,
+		TokenContract: "0xdac17f958d2ee523a2206206994597c13d831ec7", TokenSymbol: "USDT", LogIndex: 1}
+	l.Handle(usdtDep)
+
+	// A native send locks amount and fee until it confirms.
+	send := &models.Transaction{Network: models.NetworkETH, From: wallet, To: customer, Amount: big.NewInt(3_000), Fee: big.NewInt(21), TxHash: "0xs1"}
+	if err := l.RecordSent(send); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.RecordSent(send); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 10_000, 0, 3_021)
+	if got := l.Available(models.NetworkETH, wallet, "ETH"); got.Int64() != 6_979 {
+		t.Errorf("Available = %s, want 6979", got)
+	}
+	out := ethEvent("0xs1", wallet, customer, 3_000)
+	l.Handle(out)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 10_000, 0, 3_021)
+	out.Confirmed = true
+	l.Handle(out)
+	l.Handle(out)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 6_979, 0, 0)
+
+	// A token send locks the tokens and the fee in the native coin.
+	tokenSend := &models.Transaction{
+		Network: models.NetworkETH, From: wallet, To: usdtDep.TokenContract, Amount: big.NewInt(0), Fee: big.NewInt(65),
+		TxHash: "0xs2",
+		Token:  &models.TokenTransfer{Contract: usdtDep.TokenContract, Symbol: "USDT", Recipient: customer, Amount: big.NewInt(200)},
+	}
+	if err := l.RecordSent(tokenSend); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, l, models.NetworkETH, wallet, "USDT", 500, 0, 200)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 6_979, 0, 65)
+
+	// Dropped from the mempool: the funds are unlocked.
+	dropped := models.BlockEvent{Network: models.NetworkETH, TxHash: "0xs2", From: wallet, To: customer, Amount: big.NewInt(200),
+		TokenContract: usdtDep.TokenContract, TokenSymbol: "USDT", Pending: true, Dropped: true}
+	l.Handle(dropped)
+	checkBalance(t, l, models.NetworkETH, wallet, "USDT", 500, 0, 0)
+	checkBalance(t, l, models.NetworkETH, wallet, "ETH", 6_979, 0, 0)
+
+	if err := l.RecordSent(&models.Transaction{Network: models.NetworkETH, From: customer, TxHash: "0xs3"}); err == nil {
+		t.Error("RecordSent from an untracked address should fail")
+	}
+}
+
+func TestLedger_ExternalSpendAndBTCChange(t *testing.T) {
+	const (
+		deposit = "bc1qdeposit"
+		change  = "bc1qchange"
+	)
+	l := New()
+	l.Track(models.NetworkBTC, deposit)
+	l.Track(models.NetworkBTC, change)
+	l.Handle(models.BlockEvent{Network: models.NetworkBTC, TxHash: "f1", To: deposit, Amount: big.NewInt(100_000), Confirmed: true})
+
+	// A spend the wallet did not send through the builder (e.g. another
+	// signer) is locked while unconfirmed, then debited.
+	ext := models.BlockEvent{Network: models.NetworkBTC, BlockNumber: 10, TxHash: "e1", From: deposit, To: "bc1qexternal", Amount: big.NewInt(30_000)}
+	l.Handle(ext)
+	checkBalance(t, l, models.NetworkBTC, deposit, "BTC", 100_000, 0, 30_000)
+	ext.Reorged = true
+	l.Handle(ext)
+	checkBalance(t, l, models.NetworkBTC, deposit, "BTC", 100_000, 0, 0)
+	ext.Reorged, ext.Confirmed = false, true
+	l.Handle(ext)
+	checkBalance(t, l, models.NetworkBTC, deposit, "BTC", 70_000, 0, 0)
+
+	// A builder send pays one output and returns change to another wallet
+	// address; the listener reports one event per output.
+	send := &models.Transaction{Network: models.NetworkBTC, From: deposit, To: "bc1qmerchant", Amount: big.NewInt(50_000), Fee: big.NewInt(1_000), TxHash: "s1",
+		Outputs: []models.TxOutput{{Address: "bc1qmerchant", Amount: big.NewInt(50_000)}, {Address: change, Amount: big.NewInt(19_000)}}}
+	if err := l.RecordSent(send); err != nil {
+		t.Fatal(err)
+	}
+	// All inputs are locked, change included.
+	checkBalance(t, l, models.NetworkBTC, deposit, "BTC", 70_000, 0, 70_000)
+	for _, confirmed := range []bool{false, true} {
+		l.Handle(models.BlockEvent{Network: models.NetworkBTC, TxHash: "s1", Vout: 0, From: deposit, To: "bc1qmerchant", Amount: big.NewInt(50_000), Confirmed: confirmed})
+		l.Handle(models.BlockEvent{Network: models.NetworkBTC, TxHash: "s1", Vout: 1, From: deposit, To: change, Amount: big.NewInt(19_000), Confirmed: confirmed})
+	}
+	// The deposit address was emptied: 70000 - 50000 - 19000 - 1000 fee.
+	checkBalance(t, l, models.NetworkBTC, deposit, "BTC", 0, 0, 0)
+	checkBalance(t, l, models.NetworkBTC, change, "BTC", 19_000, 0, 0)
+}
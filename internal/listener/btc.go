@@ -0,0 +1,388 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RPC error codes returned for an unsupported getblock verbosity.
+const (
+	btcInvalidParameter  = -8     // Bitcoin Core RPC_INVALID_PARAMETER
+	jsonrpcInvalidParams = -32602 // JSON-RPC 2.0 invalid params
+)
+
+// BTCFetcherConfig configures a BTCFetcher.
+type BTCFetcherConfig struct {
+	Endpoint string        // bitcoind RPC URL, e.g. http://localhost:8332
+	User     string        // rpcuser
+	Password string        // rpcpassword
+	Timeout  time.Duration // per-request timeout (default 10s)
+	// HTTPClient overrides the default client (and Timeout) when set.
+	HTTPClient *http.Client
+}
+
+// BTCFetcher implements BlockFetcher over the Bitcoin Core RPC: getblockcount,
+// getblockhash and getblock with verbosity 3.
+//
+// A Bitcoin transaction has many inputs and outputs, so it is flattened into
+// one BlockTx per output that pays a decodable address, with Vout set to the
+// output index. Inputs are resolved to the addresses of the outputs they spend
+// (prevouts), so spends from watched addresses are detected as well. Bitcoin
+// Core 25+ returns prevouts inline with verbosity 3. For older nodes, which
+// return verbosity 2 data or reject verbosity 3, prevouts created in the same
+// block are resolved locally and the rest are fetched with a batched
+// getrawtransaction, which requires the node to run with -txindex.
+//
+// PendingTxs lists the mempool (getrawmempool) the same way. Transactions are
+// fetched once, when they first appear, and cached while they stay pending.
+type BTCFetcher struct {
+	rpc *rpcClient
+	// noPrevouts is set once the node rejects getblock verbosity 3.
+	noPrevouts atomic.Bool
+
+	mu      sync.Mutex
+	mempool map[string][]BlockTx // txid -> outputs, for the last mempool listing
+}
+
+// NewBTCFetcher returns a fetcher for the bitcoind at cfg.Endpoint.
+func NewBTCFetcher(cfg BTCFetcherConfig) *BTCFetcher {
+	rpc := newRPCClient(cfg.Endpoint, cfg.Timeout, cfg.HTTPClient)
+	rpc.user, rpc.password = cfg.User, cfg.Password
+	return &BTCFetcher{rpc: rpc, mempool: make(map[string][]BlockTx)}
+}
+
+// LatestBlockNumber returns the height of the node's best chain (getblockcount).
+func (f *BTCFetcher) LatestBlockNumber(ctx context.Context) (uint64, error) {
+	var n uint64
+	if err := f.rpc.Call(ctx, "getblockcount", &n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// GetBlock returns the block at height number with its flattened outputs.
+func (f *BTCFetcher) GetBlock(ctx context.Context, number uint64) (*BlockData, error) {
+	var hash string
+	if err := f.rpc.Call(ctx, "getblockhash", &hash, number); err != nil {
+		return nil, err
+	}
+	block, err := f.getBlock(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if block.Height != number {
+		return nil, fmt.Errorf("requested block %d, node returned %d", number, block.Height)
+	}
+
+	prevouts, err := f.resolvePrevouts(ctx, block.Tx)
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", number, err)
+	}
+
+	data := &BlockData{Number: block.Height, Hash: block.Hash, ParentHash: block.PreviousBlockHash}
+	for _, tx := range block.Tx {
+		txs, err := tx.blockTxs(prevouts)
+		if err != nil {
+			return nil, err
+		}
+		data.Txs = append(data.Txs, txs...)
+	}
+	return data, nil
+}
+
+// getBlock fetches a block with prevouts (verbosity 3), falling back to
+// verbosity 2 on nodes that reject it.
+func (f *BTCFetcher) getBlock(ctx context.Context, hash string) (*btcBlock, error) {
+	var block btcBlock
+	if !f.noPrevouts.Load() {
+		err := f.rpc.Call(ctx, "getblock", &block, hash, 3)
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || (rpcErr.Code != btcInvalidParameter && rpcErr.Code != jsonrpcInvalidParams) {
+			return &block, err
+		}
+		f.noPrevouts.Store(true)
+	}
+	if err := f.rpc.Call(ctx, "getblock", &block, hash, 2); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// PendingTxs returns the outputs of the transactions in the node's mempool.
+// It implements MempoolFetcher.
+func (f *BTCFetcher) PendingTxs(ctx context.Context) ([]BlockTx, error) {
+	var txids []string
+	if err := f.rpc.Call(ctx, "getrawmempool", &txids); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var missing []string
+	for _, txid := range txids {
+		if _, ok := f.mempool[txid]; !ok {
+			missing = append(missing, txid)
+		}
+	}
+	fetched, err := f.getMempoolTxs(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	mempool := make(map[string][]BlockTx, len(txids))
+	var out []BlockTx
+	for _, txid := range txids {
+		txs, ok := f.mempool[txid]
+		if !ok {
+			if txs, ok = fetched[txid]; !ok {
+				continue // left the mempool since getrawmempool
+			}
+		}
+		mempool[txid] = txs
+		out = append(out, txs...)
+	}
+	f.mempool = mempool
+	return out, nil
+}
+
+// getMempoolTxs fetches and flattens the given mempool transactions.
+func (f *BTCFetcher) getMempoolTxs(ctx context.Context, txids []string) (map[string][]BlockTx, error) {
+	if len(txids) == 0 {
+		return nil, nil
+	}
+	txs := make([]btcTx, len(txids))
+	calls := make([]*rpcCall, len(txids))
+	for i, txid := range txids {
+		// Verbosity 2 adds prevouts on Bitcoin Core 25+; older nodes
+		// treat it as verbose.
+		calls[i] = &rpcCall{Method: "getrawtransaction", Params: []any{txid, 2}, Result: &txs[i]}
+	}
+	if err := f.rpc.BatchCall(ctx, calls); err != nil {
+		return nil, err
+	}
+	found := txs[:0]
+	for i, call := range calls {
+		if call.Err == nil {
+			found = append(found, txs[i]) // the others were mined or evicted meanwhile
+		}
+	}
+
+	prevouts, err := f.resolvePrevouts(ctx, found)
+	if err != nil {
+		return nil, fmt.Errorf("mempool: %w", err)
+	}
+	out := make(map[string][]BlockTx, len(found))
+	for _, tx := range found {
+		blockTxs, err := tx.blockTxs(prevouts)
+		if err != nil {
+			return nil, err
+		}
+		out[tx.TxID] = blockTxs
+	}
+	return out, nil
+}
+
+// resolvePrevouts returns the script of every output spent by txs. Inline
+// prevouts are used as is; only inputs without one are looked up.
+func (f *BTCFetcher) resolvePrevouts(ctx context.Context, txs []btcTx) (map[outpoint]btcScriptPubKey, error) {
+	prevouts := make(map[outpoint]btcScriptPubKey)
+	local := make(map[string]*btcTx, len(txs))
+	for i := range txs {
+		local[txs[i].TxID] = &txs[i]
+	}
+
+	var missing []string
+	requested := make(map[string]bool)
+	for _, tx := range txs {
+		for _, in := range tx.Vin {
+			if in.Coinbase != "" {
+				continue
+			}
+			if in.Prevout != nil {
+				prevouts[outpoint{in.TxID, in.Vout}] = in.Prevout.ScriptPubKey
+				continue
+			}
+			if prev, ok := local[in.TxID]; ok {
+				if out, ok := prev.output(in.Vout); ok {
+					prevouts[outpoint{in.TxID, in.Vout}] = out.ScriptPubKey
+				}
+				continue
+			}
+			if !requested[in.TxID] {
+				requested[in.TxID] = true
+				missing = append(missing, in.TxID)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return prevouts, nil
+	}
+
+	prevTxs := make([]btcTx, len(missing))
+	calls := make([]*rpcCall, len(missing))
+	for i, txid := range missing {
+		calls[i] = &rpcCall{Method: "getrawtransaction", Params: []any{txid, true}, Result: &prevTxs[i]}
+	}
+	if err := f.rpc.BatchCall(ctx, calls); err != nil {
+		return nil, err
+	}
+	for i, call := range calls {
+		if call.Err != nil {
+			return nil, fmt.Errorf("prevout tx %s: %w", missing[i], call.Err)
+		}
+		for _, out := range prevTxs[i].Vout {
+			prevouts[outpoint{missing[i], out.N}] = out.ScriptPubKey
+		}
+	}
+
+	for _, tx := range txs {
+		for _, in := range tx.Vin {
+			if in.Coinbase == "" {
+				if _, ok := prevouts[outpoint{in.TxID, in.Vout}]; !ok {
+					return nil, fmt.Errorf("tx %s spends unknown output %s:%d", tx.TxID, in.TxID, in.Vout)
+				}
+			}
+		}
+	}
+	return prevouts, nil
+}
+
+type outpoint struct {
+	txid string
+	vout uint32
+}
+
+// btcBlock is the getblock verbosity=2 or 3 result.
+type btcBlock struct {
+	Hash              string  `json:"hash"`
+	PreviousBlockHash string  `json:"previousblockhash"` // absent for genesis
+	Height            uint64  `json:"height"`
+	Tx                []btcTx `json:"tx"`
+}
+
+type btcTx struct {
+	TxID string    `json:"txid"`
+	Vin  []btcVin  `json:"vin"`
+	Vout []btcVout `json:"vout"`
+}
+
+// blockTxs flattens tx into one BlockTx per output that pays an address.
+// The spent outpoints are its conflict keys: a transaction spending any of
+// them replaces it.
+func (tx *btcTx) blockTxs(prevouts map[outpoint]btcScriptPubKey) ([]BlockTx, error) {
+	var inputs, conflicts []string
+	seen := make(map[string]bool)
+	for _, in := range tx.Vin {
+		if in.Coinbase != "" {
+			continue
+		}
+		conflicts = append(conflicts, fmt.Sprintf("%s:%d", in.TxID, in.Vout))
+		addr := prevouts[outpoint{in.TxID, in.Vout}].address()
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			inputs = append(inputs, addr)
+		}
+	}
+	var from string
+	if len(inputs) > 0 {
+		from = inputs[0]
+	}
+
+	var out []BlockTx
+	for _, vout := range tx.Vout {
+		to := vout.ScriptPubKey.address()
+		if to == "" {
+			continue // OP_RETURN, bare multisig and other non-address scripts
+		}
+		amount, err := vout.Value.satoshis()
+		if err != nil {
+			return nil, fmt.Errorf("tx %s vout %d: %w", tx.TxID, vout.N, err)
+		}
+		out = append(out, BlockTx{
+			Hash:      tx.TxID,
+			Vout:      vout.N,
+			From:      from,
+			Inputs:    inputs,
+			To:        to,
+			Amount:    amount,
+			Conflicts: conflicts,
+		})
+	}
+	return out, nil
+}
+
+func (tx *btcTx) output(n uint32) (btcVout, bool) {
+	for _, out := range tx.Vout {
+		if out.N == n {
+			return out, true
+		}
+	}
+	return btcVout{}, false
+}
+
+type btcVin struct {
+	Coinbase string `json:"coinbase"` // set only for the coinbase input
+	TxID     string `json:"txid"`
+	Vout     uint32 `json:"vout"`
+	// Prevout is the spent output, returned by getblock verbosity 3 and
+	// getrawtransaction verbosity 2 on Bitcoin Core 25+.
+	Prevout *btcPrevout `json:"prevout"`
+}
+
+type btcPrevout struct {
+	ScriptPubKey btcScriptPubKey `json:"scriptPubKey"`
+}
+
+type btcVout struct {
+	Value        btcAmount       `json:"value"`
+	N            uint32          `json:"n"`
+	ScriptPubKey btcScriptPubKey `json:"scriptPubKey"`
+}
+
+type btcScriptPubKey struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	// Addresses is the pre-v22 form, still returned by older nodes.
+	Addresses []string `json:"addresses"`
+}
+
+// address returns the address the script pays, or "" if it has none.
+func (s btcScriptPubKey) address() string {
+	if s.Address != "" {
+		return s.Address
+	}
+	if len(s.Addresses) == 1 {
+		return s.Addresses[0]
+	}
+	return ""
+}
+
+// btcAmount is a BTC value as printed by bitcoind (a JSON number with up to
+// eight decimals). It is kept as text so no precision is lost to float64.
+type btcAmount string
+
+func (a *btcAmount) UnmarshalJSON(b []byte) error {
+	*a = btcAmount(b)
+	return nil
+}
+
+var satoshisPerBTC = big.NewRat(100_000_000, 1)
+
+// satoshis converts the amount to satoshis.
+func (a btcAmount) satoshis() (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(string(a))
+	if !ok {
+		return nil, fmt.Errorf("invalid BTC amount %q", string(a))
+	}
+	r.Mul(r, satoshisPerBTC)
+	if !r.IsInt() || r.Sign() < 0 {
+		return nil, fmt.Errorf("invalid BTC amount %q", string(a))
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
@@ -0,0 +1,321 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// Fixture transactions in testdata/btc/block_800000.json. The block holds a
+// coinbase, a deposit to btcTestWatched and a spend of that deposit; the
+// deposit's own input comes from btcTestPrevTx, served by getrawtransaction.
+const (
+	btcTestBlockHash = "00000000000000000002a7c4c1e48d76c5a37902165a270156b7a8d72728a054"
+	btcTestCoinbase  = "f80f21938e5248ec70b870ac1103d0dd01b7811550a7a5c971e1c3e85ea62492"
+	btcTestDeposit   = "c3b9fb78a452ce2fc90cff1608510235503e3b727683b71c7fefee54198bad63"
+	btcTestSpend     = "f64a33ff88c38111769d86b2679168f7cdabcaa7c9c20cbb51aa0a3a506a8717"
+	btcTestPrevTx    = "84fd9bac333ad79154348296204fa7f8c537a96e08983e5f73b3f5aca8e8edf7"
+
+	btcTestWatched = "bc1qxy2kgdygjrsqtzq2n0yrf2493p83kkfjhx0wlh"
+	btcTestFunder  = "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+	btcTestOther   = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+	btcTestPayee   = "bc1p5d7rjq7g6rdk2yhzks9smlaqtedr4dekq08ge8ztwac72sfr9rusxg3297"
+)
+
+// How a fake node answers getblock verbosity 3.
+const (
+	btcPrevoutsInline   = iota // Bitcoin Core 25+: prevouts in every input
+	btcPrevoutsIgnored         // older nodes: served as verbosity 2
+	btcPrevoutsRejected        // RPC_INVALID_PARAMETER
+)
+
+// newFakeBitcoind serves block 800000 from testdata/btc fixtures and checks
+// basic auth like bitcoind does. Its mempool holds the deposit and the spend
+// from that block, as they were before it was mined.
+func newFakeBitcoind(t *testing.T) *fakeRPCServer {
+	return newFakeBitcoindPrevouts(t, btcPrevoutsInline)
+}
+
+// newFakeBitcoindPrevouts is newFakeBitcoind answering getblock verbosity 3
+// as prevouts says.
+func newFakeBitcoindPrevouts(t *testing.T, prevouts int) *fakeRPCServer {
+	t.Helper()
+	fixture := func(name string) json.RawMessage {
+		b, err := os.ReadFile(filepath.Join("testdata", "btc", name))
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+
+	return newFakeRPCServer(t, func(method string, params []json.RawMessage) (any, *RPCError) {
+		switch method {
+		case "getblockcount":
+			return 800_000, nil
+		case "getblockhash":
+			var height uint64
+			_ = json.Unmarshal(params[0], &height)
+			if height != 800_000 {
+				return nil, &RPCError{Code: -8, Message: "Block height out of range"}
+			}
+			return btcTestBlockHash, nil
+		case "getblock":
+			var hash string
+			var verbosity int
+			_ = json.Unmarshal(params[0], &hash)
+			_ = json.Unmarshal(params[1], &verbosity)
+			if hash != btcTestBlockHash {
+				return nil, &RPCError{Code: -5, Message: "Block not found"}
+			}
+			switch {
+			case verbosity == 3 && prevouts == btcPrevoutsInline:
+				return fixture("block_800000_verbosity3.json"), nil
+			case verbosity == 3 && prevouts == btcPrevoutsRejected:
+				return nil, &RPCError{Code: -8, Message: "Verbosity must be in range 0..2"}
+			case verbosity == 2 || verbosity == 3:
+				return fixture("block_800000.json"), nil
+			}
+			return nil, &RPCError{Code: -8, Message: "fixtures only hold verbosity 2 and 3"}
+		case "getrawmempool":
+			return []string{btcTestDeposit, btcTestSpend}, nil
+		case "getrawtransaction":
+			var txid string
+			_ = json.Unmarshal(params[0], &txid)
+			if b := fixture("tx_" + txid + ".json"); b != nil {
+				return b, nil
+			}
+			var block struct {
+				Tx []json.RawMessage `json:"tx"`
+			}
+			_ = json.Unmarshal(fixture("block_800000.json"), &block)
+			for _, raw := range block.Tx {
+				var tx btcTx
+				if _ = json.Unmarshal(raw, &tx); tx.TxID == txid {
+					return raw, nil
+				}
+			}
+			return nil, &RPCError{Code: -5, Message: "No such mempool or blockchain transaction. Use gettransaction for wallet transactions."}
+		default:
+			return nil, &RPCError{Code: -32601, Message: "Method not found"}
+		}
+	})
+}
+
+func TestBTCFetcher_LatestBlockNumber(t *testing.T) {
+	node := newFakeBitcoind(t)
+	f := NewBTCFetcher(BTCFetcherConfig{Endpoint: node.URL, User: "rpcuser", Password: "rpcpass"})
+
+	n, err := f.LatestBlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 800_000 {
+		t.Errorf("latest = %d, want 800000", n)
+	}
+	if user, password := node.credentials(); user != "rpcuser" || password != "rpcpass" {
+		t.Errorf("basic auth = %q:%q", user, password)
+	}
+}
+
+func TestBTCFetcher_GetBlock(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		prevouts int
+		methods  []string
+	}{
+		{"inline prevouts", btcPrevoutsInline, []string{"getblockhash", "getblock"}},
+		// The external prevout tx is fetched in one batch.
+		{"verbosity 3 ignored", btcPrevoutsIgnored, []string{"getblockhash", "getblock", "getrawtransaction"}},
+		// Only the first block is retried with verbosity 2.
+		{"verbosity 3 rejected", btcPrevoutsRejected, []string{
+			"getblockhash", "getblock", "getblock", "getrawtransaction",
+			"getblockhash", "getblock", "getrawtransaction",
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeBitcoindPrevouts(t, tt.prevouts)
+			f := NewBTCFetcher(BTCFetcherConfig{Endpoint: node.URL})
+
+			block, err := f.GetBlock(context.Background(), 800_000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkBTCBlock(t, block)
+			if tt.prevouts == btcPrevoutsRejected {
+				if _, err := f.GetBlock(context.Background(), 800_000); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, methods := node.stats(); !slices.Equal(methods, tt.methods) {
+				t.Errorf("requests = %v, want %v", methods, tt.methods)
+			}
+		})
+	}
+}
+
+// checkBTCBlock checks block 800000 as flattened from the fixtures.
+func checkBTCBlock(t *testing.T, block *BlockData) {
+	t.Helper()
+	if block.Number != 800_000 || block.Hash != btcTestBlockHash {
+		t.Errorf("block = %d %s", block.Number, block.Hash)
+	}
+
+	// OP_RETURN outputs carry no address and are skipped.
+	want := []struct {
+		hash   string
+		vout   uint32
+		from   string
+		to     string
+		amount string
+	}{
+		{btcTestCoinbase, 0, "", "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq", "631250000"},
+		{btcTestDeposit, 0, btcTestFunder, btcTestWatched, "150000"},
+		{btcTestDeposit, 1, btcTestFunder, btcTestFunder, "74840000"},
+		{btcTestSpend, 0, btcTestOther, btcTestPayee, "20100000"},
+		{btcTestSpend, 1, btcTestOther, btcTestWatched, "45000"}, // pre-v22 "addresses" form
+	}
+	if len(block.Txs) != len(want) {
+		t.Fatalf("expected %d outputs, got %d", len(want), len(block.Txs))
+	}
+	for i, w := range want {
+		tx := block.Txs[i]
+		if tx.Hash != w.hash || tx.Vout != w.vout || tx.From != w.from || tx.To != w.to || tx.Amount.String() != w.amount {
+			t.Errorf("output %d = %s:%d %s -> %s %v, want %s:%d %s -> %s %s",
+				i, tx.Hash, tx.Vout, tx.From, tx.To, tx.Amount, w.hash, w.vout, w.from, w.to, w.amount)
+		}
+	}
+
+	// The spend's second input is the deposit output in the same block.
+	spend := block.Txs[3]
+	if len(spend.Inputs) != 2 || spend.Inputs[0] != btcTestOther || spend.Inputs[1] != btcTestWatched {
+		t.Errorf("spend inputs = %v", spend.Inputs)
+	}
+	if block.Txs[0].Inputs != nil {
+		t.Errorf("coinbase inputs = %v, want none", block.Txs[0].Inputs)
+	}
+}
+
+func TestBTCFetcher_Errors(t *testing.T) {
+	node := newFakeBitcoind(t)
+	f := NewBTCFetcher(BTCFetcherConfig{Endpoint: node.URL})
+
+	if _, err := f.GetBlock(context.Background(), 800_001); err == nil {
+		t.Error("expected error for a height beyond the tip")
+	}
+
+	// Without the prevout tx (no -txindex) the block cannot be flattened.
+	noIndex := newFakeRPCServer(t, func(method string, params []json.RawMessage) (any, *RPCError) {
+		if method == "getrawtransaction" {
+			return nil, &RPCError{Code: -5, Message: "No such mempool transaction. Use -txindex"}
+		}
+		b, _ := os.ReadFile(filepath.Join("testdata", "btc", "block_800000.json"))
+		if method == "getblockhash" {
+			return btcTestBlockHash, nil
+		}
+		return json.RawMessage(b), nil
+	})
+	if _, err := NewBTCFetcher(BTCFetcherConfig{Endpoint: noIndex.URL}).GetBlock(context.Background(), 800_000); err == nil {
+		t.Error("expected error when a prevout cannot be resolved")
+	}
+}
+
+func TestBTCAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0.00150000", "150000"},
+		{"6.31250000", "631250000"},
+		{"0", "0"},
+		{"20999999.97690000", "2099999997690000"},
+		{"1e-05", "1000"},
+	}
+	for _, tt := range tests {
+		var a btcAmount
+		if err := json.Unmarshal([]byte(tt.in), &a); err != nil {
+			t.Fatal(err)
+		}
+		got, err := a.satoshis()
+		if err != nil || got.String() != tt.want {
+			t.Errorf("%s = %v, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"0.000000001", "-1", `"abc"`} {
+		a := btcAmount(bad)
+		if _, err := a.satoshis(); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestBTCFetcher_WithPollingListener(t *testing.T) {
+	node := newFakeBitcoind(t)
+	ws := storage.NewMemoryWatchStore()
+	l := NewPollingListener(models.NetworkBTC, 0, ws, NewBTCFetcher(BTCFetcherConfig{Endpoint: node.URL}), PollingConfig{
+		ConfirmationDepth: 6,
+	})
+	l.lastBlock = 799_999
+	if err := l.WatchAddress(btcTestWatched); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	events := drainEvents(l)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events (deposit, spend payment, spend change), got %d: %+v", len(events), events)
+	}
+	deposit, payment, change := events[0], events[1], events[2]
+	if deposit.TxHash != btcTestDeposit || deposit.Vout != 0 || deposit.To != btcTestWatched || deposit.Amount.Int64() != 150_000 {
+		t.Errorf("deposit = %+v", deposit)
+	}
+	// The spend's first input belongs to someone else; the event names the
+	// watched input as sender.
+	if payment.TxHash != btcTestSpend || payment.Vout != 0 || payment.From != btcTestWatched || payment.To != btcTestPayee {
+		t.Errorf("payment = %+v", payment)
+	}
+	if change.TxHash != btcTestSpend || change.Vout != 1 || change.From != btcTestWatched || change.To != btcTestWatched {
+		t.Errorf("change = %+v", change)
+	}
+}
+
+func TestBTCFetcher_PendingTxs(t *testing.T) {
+	node := newFakeBitcoind(t)
+	f := NewBTCFetcher(BTCFetcherConfig{Endpoint: node.URL})
+
+	txs, err := f.PendingTxs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 4 {
+		t.Fatalf("expected 4 outputs, got %d", len(txs))
+	}
+	deposit := txs[0]
+	if deposit.Hash != btcTestDeposit || deposit.To != btcTestWatched || deposit.From != btcTestFunder {
+		t.Errorf("deposit = %+v", deposit)
+	}
+	if len(deposit.Conflicts) != 1 || deposit.Conflicts[0] != btcTestPrevTx+":0" {
+		t.Errorf("deposit conflicts = %v", deposit.Conflicts)
+	}
+	// The spend's input from the unconfirmed deposit is resolved too.
+	if spend := txs[3]; spend.Hash != btcTestSpend || len(spend.Inputs) != 2 || spend.Inputs[1] != btcTestWatched {
+		t.Errorf("spend = %+v", spend)
+	}
+
+	// Known transactions are not fetched again.
+	_, before := node.stats()
+	if _, err := f.PendingTxs(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, after := node.stats(); len(after) != len(before)+1 || after[len(after)-1] != "getrawmempool" {
+		t.Errorf("second listing called %v", after[len(before):])
+	}
+}
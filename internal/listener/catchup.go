@@ -0,0 +1,162 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCatchUpBatchSize = 10
+	// catchUpLogInterval throttles catch-up progress logs.
+	catchUpLogInterval = 10 * time.Second
+)
+
+// CatchUpProgress describes the state of a catch-up run.
+type CatchUpProgress struct {
+	From      uint64        // first block of the run
+	To        uint64        // last block the run will process
+	Processed uint64        // last block processed so far
+	Elapsed   time.Duration // time since the run started
+}
+
+// Remaining returns the number of blocks left to process.
+func (p CatchUpProgress) Remaining() uint64 {
+	return p.To - p.Processed
+}
+
+// fetchJob fetches blocks from..to; the result is delivered on result so the
+// consumer can read results in job order.
+type fetchJob struct {
+	from, to uint64
+	result   chan fetchResult
+}
+
+type fetchResult struct {
+	blocks []*BlockData
+	err    error
+}
+
+// catchUp processes blocks lastBlock+1..target with CatchUpWorkers concurrent
+// fetches. At most two jobs per worker are in flight, and blocks are applied
+// strictly in order, so reorg checks and checkpoints behave exactly as when
+// following the tip.
+func (t *blockTracker) catchUp(ctx context.Context, target uint64) error {
+	from := t.lastBlock + 1
+	if target < from {
+		return nil
+	}
+	workers := t.cfg.CatchUpWorkers
+	batch := uint64(1)
+	rangeFetcher, ok := t.fetcher.(BlockRangeFetcher)
+	if ok {
+		batch = uint64(t.cfg.CatchUpBatchSize)
+		if batch == 0 {
+			batch = defaultCatchUpBatchSize
+		}
+	}
+
+	t.logger.Info("catching up",
+		"from", from,
+		"to", target,
+		"workers", workers,
+		"batch", batch,
+	)
+
+	// On return, stop the producer and workers and wait for them, so the
+	// fetcher is no longer in use when catchUp returns.
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	jobs := make(chan fetchJob)
+	ordered := make(chan fetchJob, workers)
+	wg.Add(1 + workers)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		defer close(ordered)
+		for start := from; start <= target; start += batch {
+			job := fetchJob{from: start, to: min(start+batch-1, target), result: make(chan fetchResult, 1)}
+			select {
+			case ordered <- job:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				var res fetchResult
+				if rangeFetcher != nil {
+					res.blocks, res.err = rangeFetcher.GetBlocks(ctx, job.from, job.to)
+				} else {
+					var block *BlockData
+					block, res.err = t.fetcher.GetBlock(ctx, job.from)
+					res.blocks = []*BlockData{block}
+				}
+				job.result <- res
+			}
+		}()
+	}
+
+	started := time.Now()
+	lastLog := started
+	for job := range ordered {
+		var res fetchResult
+		select {
+		case res = <-job.result:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if res.err != nil {
+			return fmt.Errorf("catch up: get blocks %d..%d: %w", job.from, job.to, res.err)
+		}
+		if uint64(len(res.blocks)) != job.to-job.from+1 {
+			return fmt.Errorf("catch up: got %d blocks for %d..%d", len(res.blocks), job.from, job.to)
+		}
+		for i, block := range res.blocks {
+			number := job.from + uint64(i)
+			if err := t.applyBlock(ctx, number, block); err != nil {
+				return fmt.Errorf("process block %d: %w", number, err)
+			}
+			t.saveCheckpoint()
+			if t.lastBlock != number {
+				// Rolled back by a reorg: the prefetched blocks are stale.
+				// Tip-following resumes from the common ancestor.
+				return nil
+			}
+
+			progress := CatchUpProgress{From: from, To: target, Processed: number, Elapsed: time.Since(started)}
+			if t.cfg.OnCatchUpProgress != nil {
+				t.cfg.OnCatchUpProgress(progress)
+			}
+			if time.Since(lastLog) >= catchUpLogInterval {
+				lastLog = time.Now()
+				t.logger.Info("catch-up progress",
+					"block", number,
+					"remaining", progress.Remaining(),
+					"elapsed", progress.Elapsed.Round(time.Second),
+				)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t.logger.Info("caught up, following the tip",
+		"blocks", target-from+1,
+		"elapsed", time.Since(started).Round(time.Millisecond),
+	)
+	return nil
+}
@@ -0,0 +1,209 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// slowFetcher wraps mockFetcher with a per-block delay that makes later
+// blocks finish first, and records fetch concurrency.
+type slowFetcher struct {
+	*mockFetcher
+	failAt   uint64
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+	calls    atomic.Int32
+}
+
+func (f *slowFetcher) GetBlock(ctx context.Context, number uint64) (*BlockData, error) {
+	f.calls.Add(1)
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		max := f.maxSeen.Load()
+		if n <= max || f.maxSeen.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Duration(5-number%5) * time.Millisecond)
+	if number == f.failAt {
+		return nil, errors.New("node unavailable")
+	}
+	return f.mockFetcher.GetBlock(ctx, number)
+}
+
+// rangeFetcher adds GetBlocks to slowFetcher.
+type rangeFetcher struct {
+	*slowFetcher
+	rangeCalls atomic.Int32
+}
+
+func (f *rangeFetcher) GetBlocks(ctx context.Context, from, to uint64) ([]*BlockData, error) {
+	f.rangeCalls.Add(1)
+	var blocks []*BlockData
+	for n := from; n <= to; n++ {
+		b, err := f.mockFetcher.GetBlock(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// newCatchUpChain returns blocks 1..head with a deposit to 0xaddr every tenth block.
+func newCatchUpChain(head uint64) *mockFetcher {
+	f := newMockFetcher()
+	for n := uint64(1); n <= head; n++ {
+		b := &BlockData{Number: n, Hash: fmt.Sprintf("h%d", n)}
+		if n%10 == 0 {
+			b.Txs = []BlockTx{{Hash: fmt.Sprintf("tx%d", n), From: "0xsender", To: "0xaddr", Amount: big.NewInt(int64(n))}}
+		}
+		f.addBlock(b)
+	}
+	return f
+}
+
+func TestPollingListener_CatchUp(t *testing.T) {
+	fetcher := &slowFetcher{mockFetcher: newCatchUpChain(200)}
+	var mu sync.Mutex
+	var progress []CatchUpProgress
+	checkpoints := storage.NewMemoryCheckpointStore()
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), fetcher, PollingConfig{
+		ConfirmationDepth: 12,
+		CatchUpWorkers:    4,
+		Checkpoints:       checkpoints,
+		OnCatchUpProgress: func(p CatchUpProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress = append(progress, p)
+		},
+	})
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Consume events concurrently: 200 blocks produce more than the channel holds.
+	var events []models.BlockEvent
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range l.Events() {
+			events = append(events, ev)
+		}
+	}()
+
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(l.events)
+	<-done
+
+	if max := fetcher.maxSeen.Load(); max < 2 || max > 4 {
+		t.Errorf("max concurrent fetches = %d, want 2..4", max)
+	}
+	if l.lastBlock != 200 {
+		t.Errorf("lastBlock = %d, want 200", l.lastBlock)
+	}
+
+	// Detections arrive strictly in block order despite out-of-order fetches.
+	var detected []uint64
+	for _, ev := range events {
+		if !ev.Confirmed {
+			detected = append(detected, ev.BlockNumber)
+		}
+	}
+	if len(detected) != 20 {
+		t.Fatalf("expected 20 deposits, got %d", len(detected))
+	}
+	for i, n := range detected {
+		if n != uint64(i+1)*10 {
+			t.Fatalf("deposit %d in block %d, want block %d (out of order)", i, n, (i+1)*10)
+		}
+	}
+
+	// Catch-up covers blocks up to the confirmation window; the last 12 are
+	// processed in tip-following mode.
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress) != 188 || progress[0].Processed != 1 || progress[len(progress)-1].Processed != 188 {
+		t.Fatalf("progress reports = %d, first %+v", len(progress), progress[0])
+	}
+	if last := progress[len(progress)-1]; last.From != 1 || last.To != 188 || last.Remaining() != 0 {
+		t.Errorf("final progress = %+v", last)
+	}
+	if cp, _ := checkpoints.Load(models.NetworkETH); cp == nil || cp.LastBlock != 200 {
+		t.Errorf("checkpoint = %+v", cp)
+	}
+
+	// Back within the window: the next poll follows the tip without catch-up.
+	fetcher.addBlock(&BlockData{Number: 201, Hash: "h201"})
+	progress = nil
+	l.events = make(chan models.BlockEvent, 100)
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 0 || l.lastBlock != 201 {
+		t.Errorf("tip poll: progress %d, lastBlock %d", len(progress), l.lastBlock)
+	}
+}
+
+func TestPollingListener_CatchUpRangeFetcher(t *testing.T) {
+	fetcher := &rangeFetcher{slowFetcher: &slowFetcher{mockFetcher: newCatchUpChain(100)}}
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), fetcher, PollingConfig{
+		ConfirmationDepth: 10,
+		CatchUpWorkers:    3,
+		CatchUpBatchSize:  15,
+	})
+
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Blocks 1..90 in batches of 15, then 91..100 one by one at the tip.
+	if got := fetcher.rangeCalls.Load(); got != 6 {
+		t.Errorf("GetBlocks calls = %d, want 6", got)
+	}
+	if got := fetcher.calls.Load(); got != 10 {
+		t.Errorf("GetBlock calls = %d, want 10", got)
+	}
+	if l.lastBlock != 100 {
+		t.Errorf("lastBlock = %d", l.lastBlock)
+	}
+}
+
+func TestPollingListener_CatchUpError(t *testing.T) {
+	fetcher := &slowFetcher{mockFetcher: newCatchUpChain(100), failAt: 57}
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), fetcher, PollingConfig{
+		ConfirmationDepth: 10,
+		CatchUpWorkers:    8,
+	})
+
+	if err := l.poll(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	// Everything before the failed block is processed, nothing after it.
+	if l.lastBlock != 56 {
+		t.Errorf("lastBlock = %d, want 56", l.lastBlock)
+	}
+	if _, ok := l.blockHashes[58]; ok {
+		t.Error("blocks after the failure must not be applied")
+	}
+
+	// The next poll retries from block 57.
+	fetcher.failAt = 0
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if l.lastBlock != 100 {
+		t.Errorf("lastBlock after retry = %d", l.lastBlock)
+	}
+}
@@ -0,0 +1,173 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// FinalityMode selects how a listener decides that an event is confirmed.
+type FinalityMode string
+
+const (
+	// FinalityDepth confirms events at a fixed depth (ConfirmationDepth and
+	// ConfirmationTiers). It is the default.
+	FinalityDepth FinalityMode = ""
+	// FinalityFinalized confirms events once their block is at or below the
+	// ETH "finalized" block (Casper FFG finality, about two epochs).
+	FinalityFinalized FinalityMode = "finalized"
+	// FinalitySafe confirms events at or below the ETH "safe" block, which is
+	// justified but not yet finalized.
+	FinalitySafe FinalityMode = "safe"
+	// FinalitySolidified confirms events at or below the latest TRON
+	// solidified block (confirmed by 2/3 of the super representatives).
+	FinalitySolidified FinalityMode = "solidified"
+)
+
+// FinalityFetcher is implemented by fetchers whose chain reports finality.
+type FinalityFetcher interface {
+	// FinalizedBlockNumber returns the highest block that is final under mode.
+	FinalizedBlockNumber(ctx context.Context, mode FinalityMode) (uint64, error)
+}
+
+// ConfirmationTier raises the confirmation depth for large amounts, e.g. one
+// block for BTC deposits under 0.01 BTC and six above.
+type ConfirmationTier struct {
+	// TokenSymbol selects the asset: empty for the native coin, otherwise
+	// the symbol of a registered token.
+	TokenSymbol string
+	// MinAmount is the smallest amount, in base units, the tier applies to.
+	MinAmount *big.Int
+	// Depth is the confirmation depth for amounts from MinAmount up.
+	Depth uint64
+}
+
+// depthFor returns the confirmation depth for an event: the deepest tier the
+// event amount reaches, or ConfirmationDepth if that is deeper.
+func (c *PollingConfig) depthFor(ev models.BlockEvent) uint64 {
+	depth := c.ConfirmationDepth
+	if ev.Amount == nil {
+		return depth
+	}
+	for _, tier := range c.ConfirmationTiers {
+		if tier.TokenSymbol == ev.TokenSymbol && tier.MinAmount != nil && ev.Amount.Cmp(tier.MinAmount) >= 0 {
+			depth = max(depth, tier.Depth)
+		}
+	}
+	return depth
+}
+
+// window returns the number of recent blocks whose hashes are kept for reorg
+// detection: the deepest confirmation depth any event can require.
+func (c *PollingConfig) window() uint64 {
+	window := c.ConfirmationDepth
+	for _, tier := range c.ConfirmationTiers {
+		window = max(window, tier.Depth)
+	}
+	return window
+}
+
+// validate checks that the fetcher supports the configured finality mode
+// and mempool watching.
+func (t *blockTracker) validate() error {
+	if _, ok := t.fetcher.(FinalityFetcher); !ok && t.cfg.Finality != FinalityDepth {
+		return fmt.Errorf("finality %q: fetcher does not report finality", t.cfg.Finality)
+	}
+	if _, ok := t.fetcher.(MempoolFetcher); !ok && t.cfg.WatchMempool {
+		return fmt.Errorf("watch mempool: fetcher does not read the mempool")
+	}
+	return nil
+}
+
+// finalBlock returns the highest final block in finality mode. Hashes of
+// older blocks are no longer needed for reorg detection and are pruned.
+func (t *blockTracker) finalBlock(ctx context.Context) (uint64, error) {
+	ff, ok := t.fetcher.(FinalityFetcher)
+	if !ok {
+		return 0, fmt.Errorf("finality %q: fetcher does not report finality", t.cfg.Finality)
+	}
+	final, err := ff.FinalizedBlockNumber(ctx, t.cfg.Finality)
+	if err != nil {
+		return 0, fmt.Errorf("%s block: %w", t.cfg.Finality, err)
+	}
+	// Keep the final block itself as the anchor for walking back a reorg.
+	for n := range t.blockHashes {
+		if n < final {
+			delete(t.blockHashes, n)
+		}
+	}
+	return final, nil
+}
+
+// checkConfirmations promotes pending events to confirmed once their block
+// is final, or deep enough for the event amount in depth mode. With
+// ProgressEvents, events that stay pending are re-emitted with their depth.
+// Blocks above currentBlock, reported by a node lagging behind the one that
+// served them, stay pending.
+func (t *blockTracker) checkConfirmations(ctx context.Context, currentBlock uint64) error {
+	var final uint64
+	if t.cfg.Finality != FinalityDepth {
+		var err error
+		if final, err = t.finalBlock(ctx); err != nil {
+			return err
+		}
+	}
+	progress := t.cfg.ProgressEvents && time.Since(t.lastProgress) >= t.cfg.ProgressInterval
+
+	// Emit in block order, so consumers see older events confirm first.
+	blocks := make([]uint64, 0, len(t.pendingEvents))
+	for blockNum := range t.pendingEvents {
+		if blockNum <= currentBlock {
+			blocks = append(blocks, blockNum)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+
+	for _, blockNum := range blocks {
+		events := t.pendingEvents[blockNum]
+		depth := currentBlock - blockNum
+		var pending []models.BlockEvent
+		for i, ev := range events {
+			confirmed := blockNum <= final
+			if t.cfg.Finality == FinalityDepth {
+				confirmed = depth >= t.cfg.depthFor(ev)
+			}
+			switch {
+			case confirmed:
+				ev.Confirmed = true
+				ev.Confirmations = depth
+				t.logger.Info("transaction confirmed",
+					"block", ev.BlockNumber,
+					"tx", ev.TxHash,
+					"depth", depth,
+				)
+			case progress && depth >= ev.Confirmations+t.cfg.ProgressStep:
+				ev.Confirmations = depth
+				t.lastProgress = time.Now()
+			default:
+				pending = append(pending, ev)
+				continue
+			}
+			if err := t.emit(ctx, ev); err != nil {
+				// Keep the event as it was, so it is emitted next time.
+				pending = append(pending, events[i])
+				t.pendingEvents[blockNum] = append(pending, events[i+1:]...)
+				return err
+			}
+			if !confirmed {
+				// The stored event remembers the last reported depth.
+				pending = append(pending, ev)
+			}
+		}
+		if len(pending) == 0 {
+			delete(t.pendingEvents, blockNum)
+		} else {
+			t.pendingEvents[blockNum] = pending
+		}
+	}
+	return nil
+}
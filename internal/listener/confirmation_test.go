@@ -0,0 +1,280 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// finalityFetcher adds a settable finalized block to mockFetcher.
+type finalityFetcher struct {
+	*mockFetcher
+	final uint64
+}
+
+func (f *finalityFetcher) FinalizedBlockNumber(ctx context.Context, mode FinalityMode) (uint64, error) {
+	return f.final, nil
+}
+
+// confirmedTxs returns the hashes of confirmed events, in emission order.
+func confirmedTxs(events []models.BlockEvent) []string {
+	var txs []string
+	for _, ev := range events {
+		if ev.Confirmed {
+			txs = append(txs, ev.TxHash)
+		}
+	}
+	return txs
+}
+
+func TestPollingListener_ConfirmationTiers(t *testing.T) {
+	f := newMockFetcher()
+	l := NewPollingListener(models.NetworkBTC, time.Hour, storage.NewMemoryWatchStore(), f, PollingConfig{
+		ConfirmationDepth: 1,
+		ConfirmationTiers: []ConfirmationTier{{MinAmount: big.NewInt(1_000_000), Depth: 6}}, // 0.01 BTC
+	})
+	if err := l.WatchAddress("bc1qaddr"); err != nil {
+		t.Fatal(err)
+	}
+	if l.cfg.MaxReorgDepth != 6 {
+		t.Errorf("MaxReorgDepth = %d, want the deepest tier", l.cfg.MaxReorgDepth)
+	}
+
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "small", From: "bc1qsender", To: "bc1qaddr", Amount: big.NewInt(999_999)},
+		{Hash: "large", From: "bc1qsender", To: "bc1qaddr", Amount: big.NewInt(1_000_000)},
+	}})
+	f.addBlock(&BlockData{Number: 2, Hash: "h2"})
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmedTxs(drainEvents(l)); len(got) != 1 || got[0] != "small" {
+		t.Errorf("confirmed at depth 1 = %v, want [small]", got)
+	}
+
+	f.addBlock(&BlockData{Number: 6, Hash: "h6"})
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmedTxs(drainEvents(l)); len(got) != 0 {
+		t.Errorf("confirmed at depth 5 = %v", got)
+	}
+
+	f.addBlock(&BlockData{Number: 7, Hash: "h7"})
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmedTxs(drainEvents(l)); len(got) != 1 || got[0] != "large" {
+		t.Errorf("confirmed at depth 6 = %v, want [large]", got)
+	}
+	// The reorg window covers the deepest tier.
+	if _, ok := l.blockHashes[1]; !ok {
+		t.Error("block 1 hash pruned inside the window")
+	}
+}
+
+func TestPollingListener_HeadBelowPendingBlock(t *testing.T) {
+	f := newMockFetcher()
+	l := NewPollingListener(models.NetworkBTC, time.Hour, storage.NewMemoryWatchStore(), f, PollingConfig{ConfirmationDepth: 3})
+	if err := l.WatchAddress("bc1qaddr"); err != nil {
+		t.Fatal(err)
+	}
+	f.addBlock(&BlockData{Number: 5, Hash: "h5", Txs: []BlockTx{
+		{Hash: "deposit", From: "bc1qsender", To: "bc1qaddr", Amount: big.NewInt(1000)},
+	}})
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	drainEvents(l)
+
+	// A lagging node reports a head below the block holding the event.
+	f.mu.Lock()
+	f.head = 3
+	f.mu.Unlock()
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmedTxs(drainEvents(l)); len(got) != 0 {
+		t.Errorf("confirmed with the head below the block: %v", got)
+	}
+	if len(l.pendingEvents[5]) != 1 {
+		t.Errorf("event should stay pending, got %+v", l.pendingEvents)
+	}
+
+	f.addBlock(&BlockData{Number: 8, Hash: "h8"})
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	events := drainEvents(l)
+	if got := confirmedTxs(events); len(got) != 1 || got[0] != "deposit" {
+		t.Fatalf("confirmed at depth 3 = %v, want [deposit]", got)
+	}
+	if ev := events[len(events)-1]; ev.Confirmations != 3 {
+		t.Errorf("confirmations = %d, want 3", ev.Confirmations)
+	}
+}
+
+func TestPollingListener_ConfirmationOrder(t *testing.T) {
+	f := &finalityFetcher{mockFetcher: newMockFetcher()}
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), f, PollingConfig{
+		ConfirmationDepth: 2,
+		Finality:          FinalityFinalized,
+	})
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for n := uint64(1); n <= 16; n++ {
+		hash := fmt.Sprintf("tx%d", n)
+		want = append(want, hash)
+		f.addBlock(&BlockData{Number: n, Hash: fmt.Sprintf("h%d", n), Txs: []BlockTx{
+			{Hash: hash, From: "0xsender", To: "0xaddr", Amount: big.NewInt(1)},
+		}})
+	}
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	drainEvents(l)
+
+	// All pending blocks become final at once: they confirm in block order.
+	f.final = 16
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmedTxs(drainEvents(l)); !slices.Equal(got, want) {
+		t.Errorf("confirmed = %v, want %v", got, want)
+	}
+}
+
+func TestPollingListener_Finality(t *testing.T) {
+	f := &finalityFetcher{mockFetcher: newMockFetcher()}
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), f, PollingConfig{
+		ConfirmationDepth: 2,
+		Finality:          FinalityFinalized,
+	})
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "tx1", From: "0xsender", To: "0xaddr", Amount: big.NewInt(1)},
+	}})
+	f.addBlock(&BlockData{Number: 10, Hash: "h10"})
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Deep enough by block count, but not final yet.
+	if got := confirmedTxs(drainEvents(l)); len(got) != 0 {
+		t.Errorf("confirmed before finality = %v", got)
+	}
+	if _, ok := l.blockHashes[1]; !ok {
+		t.Error("hashes of non-final blocks must be kept")
+	}
+
+	f.final = 1
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmedTxs(drainEvents(l)); len(got) != 1 || got[0] != "tx1" {
+		t.Errorf("confirmed after finality = %v, want [tx1]", got)
+	}
+
+	f.final = 9
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.blockHashes) != 2 {
+		t.Errorf("hashes below the final block should be pruned, got %v", l.blockHashes)
+	}
+}
+
+func TestPollingListener_FinalityUnsupported(t *testing.T) {
+	l := NewPollingListener(models.NetworkBTC, time.Hour, storage.NewMemoryWatchStore(), newMockFetcher(), PollingConfig{
+		Finality: FinalitySolidified,
+	})
+	if err := l.Start(context.Background()); err == nil {
+		t.Fatal("expected Start to reject a fetcher without finality")
+	}
+}
+
+func TestPollingListener_ProgressEvents(t *testing.T) {
+	l, _, f := newTestListener()
+	l.cfg.ConfirmationDepth = 6
+	l.cfg.ProgressEvents = true
+	l.cfg.ProgressStep = 2
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "tx1", From: "0xsender", To: "0xaddr", Amount: big.NewInt(1)},
+	}})
+	var counts []uint64
+	for head := uint64(1); head <= 8; head++ {
+		if head > 1 {
+			f.addBlock(&BlockData{Number: head, Hash: fmt.Sprintf("h%d", head)})
+		}
+		if err := l.poll(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for _, ev := range drainEvents(l) {
+			counts = append(counts, ev.Confirmations)
+			if ev.Confirmed != (ev.Confirmations == 6) {
+				t.Errorf("event at %d confirmations: confirmed = %v", ev.Confirmations, ev.Confirmed)
+			}
+		}
+	}
+	// Detection, then every second block, then the confirmation.
+	if want := []uint64{0, 2, 4, 6}; fmt.Sprint(counts) != fmt.Sprint(want) {
+		t.Errorf("confirmations = %v, want %v", counts, want)
+	}
+}
+
+func TestPollingListener_ProgressInterval(t *testing.T) {
+	l, _, f := newTestListener()
+	l.cfg.ConfirmationDepth = 10
+	l.cfg.ProgressEvents = true
+	l.cfg.ProgressInterval = time.Hour
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "tx1", From: "0xsender", To: "0xaddr", Amount: big.NewInt(1)},
+	}})
+	f.addBlock(&BlockData{Number: 2, Hash: "h2"})
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if events := drainEvents(l); len(events) != 2 || events[1].Confirmations != 1 {
+		t.Fatalf("events = %+v", events)
+	}
+
+	// Within the interval: no progress event.
+	f.addBlock(&BlockData{Number: 3, Hash: "h3"})
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if events := drainEvents(l); len(events) != 0 {
+		t.Errorf("throttled round emitted %+v", events)
+	}
+
+	// Once the interval passed, the update carries the current depth.
+	l.lastProgress = time.Now().Add(-time.Hour)
+	f.addBlock(&BlockData{Number: 4, Hash: "h4"})
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if events := drainEvents(l); len(events) != 1 || events[0].Confirmations != 3 || events[0].Confirmed {
+		t.Errorf("events = %+v", events)
+	}
+}
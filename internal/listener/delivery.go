@@ -0,0 +1,244 @@
+package listener
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultMinBackoff  = time.Second
+	defaultMaxBackoff  = time.Minute
+)
+
+// DeliveryConfig controls how the Manager delivers events to its handler.
+// Events are written to the outbox before the handler sees them and removed
+// once it returns nil, so every event is delivered at least once; handlers
+// deduplicate by BlockEvent.ID. The listeners of this package write to the
+// outbox themselves, before their checkpoint moves past the event; events of
+// other BlockListener implementations are written as the Manager reads them.
+type DeliveryConfig struct {
+	// Outbox holds undelivered events. Defaults to an in-memory store; use
+	// storage.FileOutboxStore to keep events across restarts.
+	Outbox storage.OutboxStore
+	// MaxAttempts is the number of failed deliveries after which an event
+	// is dead-lettered (default 5). Dead letters stay in the outbox until
+	// replayed with Manager.Replay.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry; it doubles on each
+	// further failure up to MaxBackoff (defaults 1s and 1m).
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (c *DeliveryConfig) backoff(attempts int) time.Duration {
+	d := c.MinBackoff
+	for i := 1; i < attempts && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, c.MaxBackoff)
+}
+
+// EventID returns the deterministic ID of an event. The same event emitted
+// again, e.g. when a listener replays blocks after a restart, gets the same
+// ID; each state of a transfer (pending, detected, progress, confirmed,
+// reorged, dropped) gets a different one. The block hash is part of the ID,
+// so a transaction mined again at the same height after a reorg is not
+// mistaken for a duplicate of its orphaned events.
+func EventID(ev models.BlockEvent) string {
+	var status string
+	switch {
+	case ev.Alert != "":
+		status = "alert:" + ev.Alert
+	case ev.Dropped:
+		status = "dropped:" + ev.ReplacedBy
+	case ev.Pending:
+		status = "pending"
+	case ev.Reorged:
+		status = "reorged"
+	case ev.Confirmed:
+		status = "confirmed"
+	case ev.Confirmations > 0:
+		status = "progress:" + strconv.FormatUint(ev.Confirmations, 10)
+	default:
+		status = "detected"
+	}
+	key := strings.Join([]string{
+		string(ev.Network),
+		strconv.FormatUint(ev.BlockNumber, 10),
+		ev.BlockHash,
+		ev.TxHash,
+		strconv.FormatUint(uint64(ev.Vout), 10),
+		strconv.FormatUint(uint64(ev.LogIndex), 10),
+		status,
+	}, "|")
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// enqueue writes an event from a listener to the outbox and wakes the
+// network's dispatcher. A failed write is retried with backoff, which holds
+// up the listener's events channel, until it succeeds or StopAll is called.
+func (m *Manager) enqueue(network models.Network, ev models.BlockEvent) {
+	if ev.ID == "" {
+		ev.ID = EventID(ev)
+	}
+	for attempt := 1; ; attempt++ {
+		added, err := m.delivery.Outbox.Add(storage.OutboxEntry{Event: ev, CreatedAt: time.Now()})
+		if err == nil {
+			if added {
+				m.wakeDispatcher(network)
+			}
+			return
+		}
+		delay := m.delivery.backoff(attempt)
+		m.logger.Error("write outbox failed, retrying",
+			"network", network,
+			"event", ev.ID,
+			"attempt", attempt,
+			"retry_in", delay,
+			"error", err,
+		)
+		select {
+		case <-time.After(delay):
+		case <-m.quit:
+			m.logger.Error("event not written to the outbox before stop",
+				"network", network,
+				"event", ev.ID,
+				"tx", ev.TxHash,
+			)
+			return
+		}
+	}
+}
+
+// wakeDispatcher tells the network's dispatcher that the outbox changed.
+func (m *Manager) wakeDispatcher(network models.Network) {
+	select {
+	case m.wake[network] <- struct{}{}:
+	default: // a wake-up is already queued
+	}
+}
+
+// dispatch delivers the network's outbox entries in order until stop is
+// closed. An entry holds up the ones behind it until it is delivered or
+// dead-lettered.
+func (m *Manager) dispatch(network models.Network) {
+	for {
+		entries, err := m.delivery.Outbox.List()
+		if err != nil {
+			m.logger.Error("read outbox failed", "network", network, "error", err)
+		}
+		for _, entry := range entries {
+			if entry.Event.Network != network || entry.DeadLettered {
+				continue
+			}
+			if !m.deliver(entry) {
+				return
+			}
+		}
+		select {
+		case <-m.wake[network]:
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// deliver hands an entry to the handler, retrying with backoff until it
+// succeeds or is dead-lettered. It reports false if the Manager stopped
+// first; the entry is then left in the outbox for the next start.
+func (m *Manager) deliver(entry storage.OutboxEntry) bool {
+	for {
+		err := m.handler(entry.Event)
+		if err == nil {
+			if err := m.delivery.Outbox.Delete(entry.Event.ID); err != nil {
+				m.logger.Error("delete outbox entry failed", "event", entry.Event.ID, "error", err)
+			}
+			return true
+		}
+
+		entry.Attempts++
+		entry.LastError = err.Error()
+		entry.DeadLettered = entry.Attempts >= m.delivery.MaxAttempts
+		if err := m.delivery.Outbox.Update(entry); err != nil {
+			m.logger.Error("update outbox entry failed", "event", entry.Event.ID, "error", err)
+		}
+		if entry.DeadLettered {
+			m.logger.Error("event dead-lettered",
+				"network", entry.Event.Network,
+				"event", entry.Event.ID,
+				"tx", entry.Event.TxHash,
+				"attempts", entry.Attempts,
+				"error", err,
+			)
+			return true
+		}
+
+		delay := m.delivery.backoff(entry.Attempts)
+		m.logger.Warn("handle event failed, retrying",
+			"network", entry.Event.Network,
+			"event", entry.Event.ID,
+			"attempt", entry.Attempts,
+			"retry_in", delay,
+			"error", err,
+		)
+		select {
+		case <-time.After(delay):
+		case <-m.stop:
+			return false
+		}
+	}
+}
+
+// DeadLetters returns the events that exhausted their delivery attempts.
+func (m *Manager) DeadLetters() ([]storage.OutboxEntry, error) {
+	entries, err := m.delivery.Outbox.List()
+	if err != nil {
+		return nil, fmt.Errorf("read outbox: %w", err)
+	}
+	var dead []storage.OutboxEntry
+	for _, e := range entries {
+		if e.DeadLettered {
+			dead = append(dead, e)
+		}
+	}
+	return dead, nil
+}
+
+// Replay queues dead-lettered events for delivery again with a fresh
+// attempt budget: the given event IDs, or all dead letters if none are
+// given. It returns the number of events queued.
+func (m *Manager) Replay(ids ...string) (int, error) {
+	dead, err := m.DeadLetters()
+	if err != nil {
+		return 0, err
+	}
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	var n int
+	for _, entry := range dead {
+		if len(ids) > 0 && !selected[entry.Event.ID] {
+			continue
+		}
+		entry.DeadLettered = false
+		entry.Attempts = 0
+		if err := m.delivery.Outbox.Update(entry); err != nil {
+			return n, fmt.Errorf("replay %s: %w", entry.Event.ID, err)
+		}
+		m.wakeDispatcher(entry.Event.Network)
+		n++
+	}
+	m.logger.Info("replaying dead letters", "count", n)
+	return n, nil
+}
@@ -0,0 +1,377 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// chanListener is a BlockListener whose events are pushed by the test.
+type chanListener struct {
+	events chan models.BlockEvent
+}
+
+func newChanListener() *chanListener {
+	return &chanListener{events: make(chan models.BlockEvent, 10)}
+}
+
+func (l *chanListener) Start(ctx context.Context) error     { return nil }
+func (l *chanListener) Stop() error                         { close(l.events); return nil }
+func (l *chanListener) WatchAddress(address string) error   { return nil }
+func (l *chanListener) UnwatchAddress(address string) error { return nil }
+func (l *chanListener) Events() <-chan models.BlockEvent    { return l.events }
+
+// recordingHandler fails while fail is set and records every call.
+type recordingHandler struct {
+	mu    sync.Mutex
+	fail  bool
+	calls []models.BlockEvent
+	ok    chan models.BlockEvent
+}
+
+func newRecordingHandler(fail bool) *recordingHandler {
+	return &recordingHandler{fail: fail, ok: make(chan models.BlockEvent, 10)}
+}
+
+func (h *recordingHandler) handle(ev models.BlockEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, ev)
+	if h.fail {
+		return errors.New("handler down")
+	}
+	h.ok <- ev
+	return nil
+}
+
+func (h *recordingHandler) setFail(fail bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fail = fail
+}
+
+func (h *recordingHandler) callCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.calls)
+}
+
+func (h *recordingHandler) waitDelivered(t *testing.T) models.BlockEvent {
+	t.Helper()
+	select {
+	case ev := <-h.ok:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not delivered")
+		return models.BlockEvent{}
+	}
+}
+
+func startManager(t *testing.T, handler EventHandler, cfg DeliveryConfig) (*Manager, *chanListener) {
+	t.Helper()
+	mgr := NewManagerWithDelivery(handler, cfg)
+	l := newChanListener()
+	mgr.RegisterListener(models.NetworkETH, l)
+	if err := mgr.StartAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return mgr, l
+}
+
+func TestManager_RetriesFailedDelivery(t *testing.T) {
+	h := newRecordingHandler(true)
+	outbox := storage.NewMemoryOutboxStore()
+	mgr, l := startManager(t, h.handle, DeliveryConfig{Outbox: outbox, MinBackoff: 10 * time.Millisecond})
+	defer mgr.StopAll()
+
+	l.events <- models.BlockEvent{Network: models.NetworkETH, BlockNumber: 1, TxHash: "0xtx1", To: "0xaddr"}
+	time.Sleep(25 * time.Millisecond) // first attempt and a retry fail
+	if entries, _ := outbox.List(); len(entries) != 1 || entries[0].Attempts == 0 || entries[0].LastError != "handler down" {
+		t.Fatalf("outbox during retries = %+v", entries)
+	}
+
+	h.setFail(false)
+	ev := h.waitDelivered(t)
+	if ev.ID == "" || ev.ID != EventID(ev) {
+		t.Errorf("delivered event ID = %q, want %q", ev.ID, EventID(ev))
+	}
+	h.mu.Lock()
+	for _, call := range h.calls {
+		if call.ID != ev.ID {
+			t.Errorf("retry carried ID %q, want %q", call.ID, ev.ID)
+		}
+	}
+	h.mu.Unlock()
+	if entries, _ := outbox.List(); len(entries) != 0 {
+		t.Errorf("outbox after delivery = %+v, want empty", entries)
+	}
+}
+
+func TestManager_DeadLetterAndReplay(t *testing.T) {
+	h := newRecordingHandler(true)
+	mgr, l := startManager(t, h.handle, DeliveryConfig{MaxAttempts: 2, MinBackoff: time.Millisecond})
+	defer mgr.StopAll()
+
+	l.events <- models.BlockEvent{Network: models.NetworkETH, BlockNumber: 1, TxHash: "0xtx1", To: "0xaddr"}
+	var dead []storage.OutboxEntry
+	for deadline := time.Now().Add(2 * time.Second); len(dead) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("event not dead-lettered")
+		}
+		dead, _ = mgr.DeadLetters()
+	}
+	if dead[0].Attempts != 2 || h.callCount() != 2 {
+		t.Errorf("dead letter after %d attempts, %d calls; want 2", dead[0].Attempts, h.callCount())
+	}
+
+	// A dead letter does not hold up later events.
+	h.setFail(false)
+	l.events <- models.BlockEvent{Network: models.NetworkETH, BlockNumber: 2, TxHash: "0xtx2", To: "0xaddr"}
+	if ev := h.waitDelivered(t); ev.TxHash != "0xtx2" {
+		t.Fatalf("delivered %s, want 0xtx2", ev.TxHash)
+	}
+
+	if n, err := mgr.Replay("unknown"); err != nil || n != 0 {
+		t.Errorf("Replay(unknown) = %d, %v", n, err)
+	}
+	if n, err := mgr.Replay(dead[0].Event.ID); err != nil || n != 1 {
+		t.Fatalf("Replay = %d, %v", n, err)
+	}
+	if ev := h.waitDelivered(t); ev.TxHash != "0xtx1" {
+		t.Errorf("replayed %s, want 0xtx1", ev.TxHash)
+	}
+	if dead, _ := mgr.DeadLetters(); len(dead) != 0 {
+		t.Errorf("dead letters after replay = %+v", dead)
+	}
+}
+
+func TestManager_RedeliversOutboxOnStart(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := storage.NewFileOutboxStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first run stops while the handler is failing.
+	h := newRecordingHandler(true)
+	mgr, l := startManager(t, h.handle, DeliveryConfig{Outbox: outbox, MinBackoff: time.Hour})
+	ev := models.BlockEvent{Network: models.NetworkETH, BlockNumber: 1, TxHash: "0xtx1", To: "0xaddr"}
+	l.events <- ev
+	for deadline := time.Now().Add(2 * time.Second); h.callCount() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("event not attempted")
+		}
+	}
+	mgr.StopAll()
+
+	// The next run delivers it from the reopened outbox.
+	outbox, err = storage.NewFileOutboxStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = newRecordingHandler(false)
+	mgr = NewManagerWithDelivery(h.handle, DeliveryConfig{Outbox: outbox})
+	mgr.RegisterListener(models.NetworkETH, newChanListener())
+	if err := mgr.StartAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.StopAll()
+
+	if got := h.waitDelivered(t); got.TxHash != "0xtx1" {
+		t.Fatalf("redelivered %s, want 0xtx1", got.TxHash)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := h.callCount(); n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+}
+
+// flakyOutbox fails writes while fail is set.
+type flakyOutbox struct {
+	*storage.MemoryOutboxStore
+	mu   sync.Mutex
+	fail bool
+}
+
+func (o *flakyOutbox) setFail(fail bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.fail = fail
+}
+
+func (o *flakyOutbox) Add(entry storage.OutboxEntry) (bool, error) {
+	o.mu.Lock()
+	fail := o.fail
+	o.mu.Unlock()
+	if fail {
+		return false, errors.New("disk full")
+	}
+	return o.MemoryOutboxStore.Add(entry)
+}
+
+func TestManager_ListenerWritesOutboxBeforeCheckpoint(t *testing.T) {
+	outbox := &flakyOutbox{MemoryOutboxStore: storage.NewMemoryOutboxStore(), fail: true}
+	checkpoints := storage.NewMemoryCheckpointStore()
+	f := newMockFetcher()
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), f, PollingConfig{
+		ConfirmationDepth: 1,
+		Checkpoints:       checkpoints,
+	})
+	mgr := NewManagerWithDelivery(func(models.BlockEvent) error { return nil }, DeliveryConfig{Outbox: outbox})
+	mgr.RegisterListener(models.NetworkETH, l)
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "0xtx1", From: "0xsender", To: "0xaddr", Amount: big.NewInt(1)},
+	}})
+	f.addBlock(&BlockData{Number: 2, Hash: "h2"})
+
+	// While the outbox is down the listener does not move past the block.
+	if err := l.poll(context.Background()); err == nil {
+		t.Fatal("expected poll to fail while the outbox is down")
+	}
+	if cp, _ := checkpoints.Load(models.NetworkETH); cp != nil && cp.LastBlock != 0 {
+		t.Fatalf("checkpoint advanced to %d past an event not in the outbox", cp.LastBlock)
+	}
+	drainEvents(l)
+
+	outbox.setFail(false)
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if cp, _ := checkpoints.Load(models.NetworkETH); cp == nil || cp.LastBlock != 2 {
+		t.Fatalf("checkpoint = %+v, want block 2", cp)
+	}
+	entries, err := outbox.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var detected, confirmed int
+	for _, e := range entries {
+		if e.Event.ID != EventID(e.Event) {
+			t.Errorf("entry %+v has ID %q", e.Event, e.Event.ID)
+		}
+		if e.Event.Confirmed {
+			confirmed++
+		} else {
+			detected++
+		}
+	}
+	if detected != 1 || confirmed != 1 {
+		t.Errorf("outbox holds %d detected and %d confirmed events, want 1 each", detected, confirmed)
+	}
+}
+
+func TestManager_RetriesOutboxWrite(t *testing.T) {
+	outbox := &flakyOutbox{MemoryOutboxStore: storage.NewMemoryOutboxStore(), fail: true}
+	h := newRecordingHandler(false)
+	mgr, l := startManager(t, h.handle, DeliveryConfig{Outbox: outbox, MinBackoff: 10 * time.Millisecond})
+	defer mgr.StopAll()
+
+	l.events <- models.BlockEvent{Network: models.NetworkETH, BlockNumber: 1, TxHash: "0xtx1", To: "0xaddr"}
+	time.Sleep(30 * time.Millisecond)
+	if n := h.callCount(); n != 0 {
+		t.Fatalf("handler called %d times before the event was in the outbox", n)
+	}
+
+	outbox.setFail(false)
+	if got := h.waitDelivered(t); got.TxHash != "0xtx1" {
+		t.Fatalf("delivered %s, want 0xtx1", got.TxHash)
+	}
+}
+
+func TestEventID(t *testing.T) {
+	base := models.BlockEvent{Network: models.NetworkBTC, BlockNumber: 800_000, TxHash: "abc", To: "bc1q", Vout: 1}
+	if EventID(base) != EventID(base) {
+		t.Fatal("EventID is not deterministic")
+	}
+
+	variants := map[string]func(ev *models.BlockEvent){
+		"other output": func(ev *models.BlockEvent) { ev.Vout = 2 },
+		"other block":  func(ev *models.BlockEvent) { ev.BlockNumber++ },
+		"re-mined":     func(ev *models.BlockEvent) { ev.BlockHash = "other" },
+		"pending":      func(ev *models.BlockEvent) { ev.Pending, ev.BlockNumber = true, 0 },
+		"progress":     func(ev *models.BlockEvent) { ev.Confirmations = 2 },
+		"confirmed":    func(ev *models.BlockEvent) { ev.Confirmed, ev.Confirmations = true, 6 },
+		"reorged":      func(ev *models.BlockEvent) { ev.Reorged = true },
+	}
+	seen := map[string]string{EventID(base): "detected"}
+	for name, change := range variants {
+		ev := base
+		change(&ev)
+		id := EventID(ev)
+		if other, ok := seen[id]; ok {
+			t.Errorf("%s and %s share ID %s", name, other, id)
+		}
+		seen[id] = name
+	}
+
+	// The confirmation count of a confirmed event does not change its ID.
+	a, b := base, base
+	a.Confirmed, a.Confirmations = true, 6
+	b.Confirmed, b.Confirmations = true, 7
+	if EventID(a) != EventID(b) {
+		t.Error("confirmed event ID depends on the confirmation count")
+	}
+}
+
+func TestEventID_RemineAfterReorg(t *testing.T) {
+	l, _, f := newTestListener()
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	deposit := BlockTx{Hash: "tx1", From: "0xsender", To: "0xaddr", Amount: big.NewInt(100)}
+
+	f.addBlock(&BlockData{Number: 1, Hash: "h1"})
+	f.addBlock(&BlockData{Number: 2, Hash: "h2a", ParentHash: "h1", Txs: []BlockTx{deposit}})
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The same transaction is mined again at the same height on a new branch.
+	f.addBlock(&BlockData{Number: 2, Hash: "h2b", ParentHash: "h1", Txs: []BlockTx{deposit}})
+	f.addBlock(&BlockData{Number: 3, Hash: "h3", ParentHash: "h2b"})
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := drainEvents(l)
+	if len(events) != 3 || events[0].Reorged || !events[1].Reorged || events[2].Reorged {
+		t.Fatalf("expected detected, reorged, detected; got %+v", events)
+	}
+	seen := make(map[string]int)
+	for i, ev := range events {
+		id := EventID(ev)
+		if j, ok := seen[id]; ok {
+			t.Errorf("events %d and %d share ID %s: %+v, %+v", j, i, id, events[j], ev)
+		}
+		seen[id] = i
+	}
+	if events[0].BlockHash != "h2a" || events[2].BlockHash != "h2b" {
+		t.Errorf("block hashes = %q, %q", events[0].BlockHash, events[2].BlockHash)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	var calls []string
+	failing := func(ev models.BlockEvent) error { calls = append(calls, "failing"); return errors.New("down") }
+	ok := func(ev models.BlockEvent) error { calls = append(calls, "ok"); return nil }
+
+	if err := Handlers(ok, ok)(models.BlockEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	calls = nil
+	if err := Handlers(failing, ok)(models.BlockEvent{}); err == nil || err.Error() != "down" {
+		t.Errorf("err = %v, want down", err)
+	}
+	if len(calls) != 2 || calls[1] != "ok" {
+		t.Errorf("calls = %v, want every handler called", calls)
+	}
+}
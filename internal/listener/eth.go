@@ -0,0 +1,298 @@
+package listener
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/token"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// defaultMaxLogRange keeps eth_getLogs ranges within common provider limits.
+const defaultMaxLogRange = 1000
+
+// ETHFetcherConfig configures an ETHFetcher.
+type ETHFetcherConfig struct {
+	Endpoint string        // node JSON-RPC URL
+	Timeout  time.Duration // per-request timeout (default 10s)
+	// HTTPClient overrides the default client (and Timeout) when set.
+	HTTPClient *http.Client
+	// Tokens lists the contracts whose Transfer logs are fetched, usually the
+	// listener's PollingConfig.Tokens. Nil skips eth_getLogs.
+	Tokens *token.Registry
+	// MaxLogRange is the most blocks one eth_getLogs call spans (default
+	// 1000); longer ranges are split into several calls of the batch.
+	MaxLogRange uint64
+}
+
+// ETHFetcher implements BlockFetcher over Ethereum JSON-RPC: eth_blockNumber,
+// eth_getBlockByNumber with full transactions, and eth_getLogs for token
+// Transfer events of registered tokens, batched into one HTTP request per
+// fetch. PendingTxs reads the pending transactions from txpool_content (geth,
+// erigon, reth).
+type ETHFetcher struct {
+	rpc         *rpcClient
+	tokens      *token.Registry
+	maxLogRange uint64
+}
+
+// NewETHFetcher returns a fetcher for the node at cfg.Endpoint.
+func NewETHFetcher(cfg ETHFetcherConfig) *ETHFetcher {
+	if cfg.MaxLogRange == 0 {
+		cfg.MaxLogRange = defaultMaxLogRange
+	}
+	return &ETHFetcher{
+		rpc:         newRPCClient(cfg.Endpoint, cfg.Timeout, cfg.HTTPClient),
+		tokens:      cfg.Tokens,
+		maxLogRange: cfg.MaxLogRange,
+	}
+}
+
+// LatestBlockNumber returns the node's current head (eth_blockNumber).
+func (f *ETHFetcher) LatestBlockNumber(ctx context.Context) (uint64, error) {
+	var n hexUint64
+	if err := f.rpc.Call(ctx, "eth_blockNumber", &n); err != nil {
+		return 0, err
+	}
+	return uint64(n), nil
+}
+
+// FinalizedBlockNumber returns the number of the "finalized" or "safe" block
+// (eth_getBlockByNumber with the block tag). It implements FinalityFetcher.
+func (f *ETHFetcher) FinalizedBlockNumber(ctx context.Context, mode FinalityMode) (uint64, error) {
+	if mode != FinalityFinalized && mode != FinalitySafe {
+		return 0, fmt.Errorf("unsupported finality mode %q", mode)
+	}
+	var block *struct {
+		Number hexUint64 `json:"number"`
+	}
+	if err := f.rpc.Call(ctx, "eth_getBlockByNumber", &block, string(mode), false); err != nil {
+		return 0, err
+	}
+	if block == nil {
+		return 0, fmt.Errorf("node has no %s block", mode) // pre-merge chain
+	}
+	return uint64(block.Number), nil
+}
+
+// PendingTxs returns the executable pending transactions (txpool_content).
+// Pending transactions have no receipt yet, so a transfer(to, amount) call
+// is reported with the Transfer log it would emit. It implements
+// MempoolFetcher.
+func (f *ETHFetcher) PendingTxs(ctx context.Context) ([]BlockTx, error) {
+	var content struct {
+		Pending map[string]map[string]ethTx `json:"pending"` // from -> nonce -> tx
+	}
+	if err := f.rpc.Call(ctx, "txpool_content", &content); err != nil {
+		return nil, err
+	}
+	var out []BlockTx
+	for _, byNonce := range content.Pending {
+		for _, tx := range byNonce {
+			btx := tx.toBlockTx()
+			input, err := hex.DecodeString(strings.TrimPrefix(tx.Input, "0x"))
+			if err != nil {
+				return nil, fmt.Errorf("tx %s: invalid input: %w", btx.Hash, err)
+			}
+			if recipient, amount, err := token.DecodeTransfer(input); err == nil && btx.To != "" {
+				sender, err := hex.DecodeString(strings.TrimPrefix(btx.From, "0x"))
+				if err != nil {
+					return nil, fmt.Errorf("tx %s: invalid sender: %w", btx.Hash, err)
+				}
+				btx.Logs = []Log{{
+					Address: btx.To,
+					Topics:  []string{token.TransferEventTopic, addressTopic(sender), addressTopic(recipient)},
+					Data:    amount.FillBytes(make([]byte, 32)),
+				}}
+			}
+			out = append(out, btx)
+		}
+	}
+	return out, nil
+}
+
+// GetBlock returns the block with its transactions and Transfer logs.
+func (f *ETHFetcher) GetBlock(ctx context.Context, number uint64) (*BlockData, error) {
+	blocks, err := f.GetBlocks(ctx, number, number)
+	if err != nil {
+		return nil, err
+	}
+	return blocks[0], nil
+}
+
+// GetBlocks returns blocks from..to (inclusive) using a single batch request:
+// one eth_getBlockByNumber per block plus eth_getLogs over the range, filtered
+// to the registered token contracts and split into MaxLogRange chunks.
+func (f *ETHFetcher) GetBlocks(ctx context.Context, from, to uint64) ([]*BlockData, error) {
+	if to < from {
+		return nil, fmt.Errorf("invalid block range %d..%d", from, to)
+	}
+
+	count := int(to - from + 1)
+	blocks := make([]*ethBlock, count)
+	calls := make([]*rpcCall, 0, count+1)
+	for i := range blocks {
+		calls = append(calls, &rpcCall{
+			Method: "eth_getBlockByNumber",
+			Params: []any{encodeHexUint64(from + uint64(i)), true},
+			Result: &blocks[i],
+		})
+	}
+	var chunks [][]ethLog
+	if f.tokens != nil {
+		if contracts := f.tokens.Contracts(models.NetworkETH); len(contracts) > 0 {
+			chunks = make([][]ethLog, (to-from)/f.maxLogRange+1)
+			for i := range chunks {
+				start := from + uint64(i)*f.maxLogRange
+				calls = append(calls, &rpcCall{
+					Method: "eth_getLogs",
+					Params: []any{map[string]any{
+						"fromBlock": encodeHexUint64(start),
+						"toBlock":   encodeHexUint64(min(start+f.maxLogRange-1, to)),
+						"address":   contracts,
+						"topics":    []any{"0x" + token.TransferEventTopic},
+					}},
+					Result: &chunks[i],
+				})
+			}
+		}
+	}
+
+	if err := f.rpc.BatchCall(ctx, calls); err != nil {
+		return nil, err
+	}
+	for _, call := range calls {
+		if call.Err != nil {
+			return nil, call.Err
+		}
+	}
+
+	out := make([]*BlockData, count)
+	index := make(map[string]*BlockTx) // tx hash -> tx, across the range
+	for i, b := range blocks {
+		number := from + uint64(i)
+		if b == nil {
+			return nil, fmt.Errorf("block %d not found", number)
+		}
+		data, err := b.toBlockData()
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", number, err)
+		}
+		if data.Number != number {
+			return nil, fmt.Errorf("requested block %d, node returned %d", number, data.Number)
+		}
+		for j := range data.Txs {
+			index[data.Txs[j].Hash] = &data.Txs[j]
+		}
+		out[i] = data
+	}
+
+	var logs []ethLog
+	for _, chunk := range chunks {
+		logs = append(logs, chunk...)
+	}
+	for _, lg := range logs {
+		if lg.Removed {
+			continue
+		}
+		blockNum := uint64(lg.BlockNumber)
+		if blockNum < from || blockNum > to {
+			continue
+		}
+		// The calls in a batch are not atomic: a reorg between them shows up as
+		// logs from a different block hash. Fail and let the caller retry.
+		if block := out[blockNum-from]; !strings.EqualFold(lg.BlockHash, block.Hash) {
+			return nil, fmt.Errorf("block %d: logs from hash %s, block hash %s", blockNum, lg.BlockHash, block.Hash)
+		}
+		tx, ok := index[strings.ToLower(lg.TransactionHash)]
+		if !ok {
+			return nil, fmt.Errorf("log %d references unknown tx %s", uint64(lg.LogIndex), lg.TransactionHash)
+		}
+		l, err := lg.toLog()
+		if err != nil {
+			return nil, err
+		}
+		tx.Logs = append(tx.Logs, l)
+	}
+	return out, nil
+}
+
+// ethBlock is the eth_getBlockByNumber result with full transaction objects.
+type ethBlock struct {
+	Number       hexUint64 `json:"number"`
+	Hash         string    `json:"hash"`
+	ParentHash   string    `json:"parentHash"`
+	Transactions []ethTx   `json:"transactions"`
+}
+
+type ethTx struct {
+	Hash  string    `json:"hash"`
+	From  string    `json:"from"`
+	To    *string   `json:"to"` // null for contract creation
+	Value *hexBig   `json:"value"`
+	Nonce hexUint64 `json:"nonce"`
+	Input string    `json:"input"`
+}
+
+// toBlockTx converts the transaction; hashes and addresses are lowercased.
+// The sender and nonce form its conflict key.
+func (tx *ethTx) toBlockTx() BlockTx {
+	var to string
+	if tx.To != nil {
+		to = strings.ToLower(*tx.To)
+	}
+	from := strings.ToLower(tx.From)
+	return BlockTx{
+		Hash:      strings.ToLower(tx.Hash),
+		From:      from,
+		To:        to,
+		Amount:    tx.Value.Int(),
+		Conflicts: []string{fmt.Sprintf("%s/%d", from, uint64(tx.Nonce))},
+	}
+}
+
+type ethLog struct {
+	Address         string    `json:"address"`
+	Topics          []string  `json:"topics"`
+	Data            string    `json:"data"`
+	BlockNumber     hexUint64 `json:"blockNumber"`
+	BlockHash       string    `json:"blockHash"`
+	TransactionHash string    `json:"transactionHash"`
+	LogIndex        hexUint64 `json:"logIndex"`
+	Removed         bool      `json:"removed"`
+}
+
+// toBlockData converts the RPC block; hashes and addresses are lowercased so
+// they compare equal to generated addresses.
+func (b *ethBlock) toBlockData() (*BlockData, error) {
+	data := &BlockData{
+		Number:     uint64(b.Number),
+		Hash:       strings.ToLower(b.Hash),
+		ParentHash: strings.ToLower(b.ParentHash),
+		Txs:        make([]BlockTx, 0, len(b.Transactions)),
+	}
+	for _, tx := range b.Transactions {
+		if tx.Hash == "" {
+			return nil, fmt.Errorf("transaction objects missing: request full transactions")
+		}
+		data.Txs = append(data.Txs, tx.toBlockTx())
+	}
+	return data, nil
+}
+
+func (lg *ethLog) toLog() (Log, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(lg.Data, "0x"))
+	if err != nil {
+		return Log{}, fmt.Errorf("log %d: invalid data: %w", uint64(lg.LogIndex), err)
+	}
+	return Log{
+		Index:   uint(lg.LogIndex),
+		Address: strings.ToLower(lg.Address),
+		Topics:  lg.Topics,
+		Data:    data,
+	}, nil
+}
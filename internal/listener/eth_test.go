@@ -0,0 +1,331 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/internal/token"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// newFakeETHNode serves blocks 0x121eac0..0x121eac1 from testdata/eth fixtures
+// and a txpool with an ETH and a USDT transfer to 0x3535....
+func newFakeETHNode(t *testing.T) *fakeRPCServer {
+	t.Helper()
+	fixture := func(name string) json.RawMessage {
+		b, err := os.ReadFile(filepath.Join("testdata", "eth", name))
+		if err != nil {
+			return nil
+		}
+		return b
+	}
+	var logs []json.RawMessage
+	if err := json.Unmarshal(fixture("logs.json"), &logs); err != nil {
+		t.Fatal(err)
+	}
+
+	return newFakeRPCServer(t, func(method string, params []json.RawMessage) (any, *RPCError) {
+		switch method {
+		case "eth_blockNumber":
+			return "0x121eac1", nil
+		case "eth_getBlockByNumber":
+			var number string
+			var full bool
+			_ = json.Unmarshal(params[0], &number)
+			_ = json.Unmarshal(params[1], &full)
+			switch number {
+			case "finalized":
+				return map[string]string{"number": "0x121eac0"}, nil
+			case "safe":
+				return map[string]string{"number": "0x121eac1"}, nil
+			}
+			if !full {
+				return nil, &RPCError{Code: -32602, Message: "fixtures only hold full blocks"}
+			}
+			if b := fixture("block_" + number + ".json"); b != nil {
+				return b, nil
+			}
+			return nil, nil // unknown block: null, as geth returns
+		case "txpool_content":
+			return fixture("txpool_content.json"), nil
+		case "eth_getLogs":
+			var filter struct {
+				FromBlock string   `json:"fromBlock"`
+				ToBlock   string   `json:"toBlock"`
+				Address   []string `json:"address"`
+				Topics    []string `json:"topics"`
+			}
+			_ = json.Unmarshal(params[0], &filter)
+			from, _ := parseHexUint64(filter.FromBlock)
+			to, _ := parseHexUint64(filter.ToBlock)
+			out := []json.RawMessage{}
+			for _, raw := range logs {
+				var lg ethLog
+				_ = json.Unmarshal(raw, &lg)
+				n := uint64(lg.BlockNumber)
+				if n >= from && n <= to && lg.Topics[0] == filter.Topics[0] && matchesAddress(filter.Address, lg.Address) {
+					out = append(out, raw)
+				}
+			}
+			return out, nil
+		default:
+			return nil, &RPCError{Code: -32601, Message: "method not found"}
+		}
+	})
+}
+
+// matchesAddress applies the address filter of eth_getLogs; no addresses
+// match every contract, as on a real node.
+func matchesAddress(filter []string, address string) bool {
+	for _, a := range filter {
+		if strings.EqualFold(a, address) {
+			return true
+		}
+	}
+	return len(filter) == 0
+}
+
+func TestETHFetcher_LatestBlockNumber(t *testing.T) {
+	node := newFakeETHNode(t)
+	f := NewETHFetcher(ETHFetcherConfig{Endpoint: node.URL, Timeout: time.Second})
+
+	n, err := f.LatestBlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 19_000_001 {
+		t.Errorf("latest = %d, want 19000001", n)
+	}
+}
+
+func TestETHFetcher_GetBlock(t *testing.T) {
+	node := newFakeETHNode(t)
+	f := NewETHFetcher(ETHFetcherConfig{Endpoint: node.URL, Tokens: token.DefaultRegistry()})
+
+	block, err := f.GetBlock(context.Background(), 19_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Number != 19_000_000 || block.Hash != "0xc5d3e6c1f1b8f1a1c4a6b0f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3" {
+		t.Errorf("block = %d %s", block.Number, block.Hash)
+	}
+	if len(block.Txs) != 3 {
+		t.Fatalf("expected 3 txs, got %d", len(block.Txs))
+	}
+
+	eth := block.Txs[0]
+	if eth.From != "0x9858effd232b4033e47d90003d41ec34ecaeda94" || eth.To != "0x3535353535353535353535353535353535353535" {
+		t.Errorf("addresses should be lowercased: %s -> %s", eth.From, eth.To)
+	}
+	if eth.Amount.String() != "1000000000000000000" {
+		t.Errorf("value = %v, want 1 ETH", eth.Amount)
+	}
+	if len(eth.Logs) != 0 {
+		t.Errorf("plain transfer should have no logs, got %d", len(eth.Logs))
+	}
+
+	usdt := block.Txs[1]
+	if len(usdt.Logs) != 1 {
+		t.Fatalf("expected the Transfer log on the USDT tx, got %d", len(usdt.Logs))
+	}
+	lg := usdt.Logs[0]
+	if lg.Index != 5 || lg.Address != token.USDTEthereum.Contract || len(lg.Topics) != 3 || len(lg.Data) != 32 {
+		t.Errorf("log = %+v", lg)
+	}
+
+	if create := block.Txs[2]; create.To != "" || create.Amount.Sign() != 0 {
+		t.Errorf("contract creation = %q %v", create.To, create.Amount)
+	}
+
+	// Block and logs are fetched in a single batched HTTP request.
+	if requests, methods := node.stats(); requests != 1 || len(methods) != 2 {
+		t.Errorf("expected 1 batch request with 2 calls, got %d requests %v", requests, methods)
+	}
+}
+
+func TestETHFetcher_GetBlocksBatch(t *testing.T) {
+	node := newFakeETHNode(t)
+	f := NewETHFetcher(ETHFetcherConfig{Endpoint: node.URL, Tokens: token.DefaultRegistry()})
+
+	blocks, err := f.GetBlocks(context.Background(), 19_000_000, 19_000_001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0].Number != 19_000_000 || blocks[1].Number != 19_000_001 {
+		t.Fatalf("blocks = %+v", blocks)
+	}
+	if blocks[1].Txs[0].Amount.String() != "10000000000000000" {
+		t.Errorf("value = %v", blocks[1].Txs[0].Amount)
+	}
+	if requests, methods := node.stats(); requests != 1 || len(methods) != 3 {
+		t.Errorf("expected 1 batch request with 3 calls, got %d requests %v", requests, methods)
+	}
+
+	if _, err := f.GetBlocks(context.Background(), 19_000_001, 19_000_002); err == nil {
+		t.Error("expected error for a block the node does not have")
+	}
+}
+
+func TestETHFetcher_LogFilter(t *testing.T) {
+	node := newFakeETHNode(t)
+
+	// Only registered contracts are queried: the USDT log is not fetched
+	// when just USDC is registered.
+	usdc, err := token.NewRegistry(token.USDCEthereum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewETHFetcher(ETHFetcherConfig{Endpoint: node.URL, Tokens: usdc, MaxLogRange: 1})
+	blocks, err := f.GetBlocks(context.Background(), 19_000_000, 19_000_001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs := blocks[0].Txs[1].Logs; len(logs) != 0 {
+		t.Errorf("expected no logs for unregistered USDT, got %+v", logs)
+	}
+	// One eth_getLogs call per MaxLogRange blocks, in the same batch.
+	if requests, methods := node.stats(); requests != 1 || len(methods) != 4 {
+		t.Errorf("expected 1 batch request with 4 calls, got %d requests %v", requests, methods)
+	}
+
+	// Without a token registry no logs are requested.
+	f = NewETHFetcher(ETHFetcherConfig{Endpoint: node.URL})
+	if _, err := f.GetBlock(context.Background(), 19_000_000); err != nil {
+		t.Fatal(err)
+	}
+	if requests, methods := node.stats(); requests != 2 || len(methods) != 5 {
+		t.Errorf("expected eth_getBlockByNumber only, got %d requests %v", requests, methods)
+	}
+}
+
+func TestETHFetcher_FinalizedBlockNumber(t *testing.T) {
+	node := newFakeETHNode(t)
+	f := NewETHFetcher(ETHFetcherConfig{Endpoint: node.URL, Tokens: token.DefaultRegistry()})
+
+	for mode, want := range map[FinalityMode]uint64{FinalityFinalized: 19_000_000, FinalitySafe: 19_000_001} {
+		n, err := f.FinalizedBlockNumber(context.Background(), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("%s block = %d, want %d", mode, n, want)
+		}
+	}
+	if _, err := f.FinalizedBlockNumber(context.Background(), FinalitySolidified); err == nil {
+		t.Error("expected error for a TRON finality mode")
+	}
+}
+
+func TestETHFetcher_WithPollingListener(t *testing.T) {
+	node := newFakeETHNode(t)
+	ws := storage.NewMemoryWatchStore()
+	l := NewPollingListener(models.NetworkETH, time.Hour, ws, NewETHFetcher(ETHFetcherConfig{Endpoint: node.URL, Tokens: token.DefaultRegistry()}), PollingConfig{
+		ConfirmationDepth: 1,
+		Tokens:            token.DefaultRegistry(),
+	})
+	l.lastBlock = 18_999_999
+	if err := l.WatchAddress("0x3535353535353535353535353535353535353535"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var native, usdt, outgoing, confirmed int
+	for _, ev := range drainEvents(l) {
+		switch {
+		case ev.Confirmed:
+			confirmed++
+		case ev.TokenSymbol == "USDT":
+			usdt++
+		case ev.BlockNumber == 19_000_001:
+			outgoing++
+		default:
+			native++
+		}
+	}
+	if native != 1 || usdt != 1 || outgoing != 1 {
+		t.Errorf("detected native=%d usdt=%d outgoing=%d, want 1 each", native, usdt, outgoing)
+	}
+	if confirmed != 2 {
+		t.Errorf("block 19000000 events confirmed = %d, want 2", confirmed)
+	}
+}
+
+func TestETHFetcher_FinalityWithPollingListener(t *testing.T) {
+	node := newFakeETHNode(t)
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), NewETHFetcher(ETHFetcherConfig{Endpoint: node.URL, Tokens: token.DefaultRegistry()}), PollingConfig{
+		ConfirmationDepth: 64,
+		Finality:          FinalityFinalized,
+		Tokens:            token.DefaultRegistry(),
+	})
+	l.lastBlock = 18_999_999
+	if err := l.WatchAddress("0x3535353535353535353535353535353535353535"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the finalized block's events are confirmed, well before depth 64.
+	var confirmed []uint64
+	for _, ev := range drainEvents(l) {
+		if ev.Confirmed {
+			confirmed = append(confirmed, ev.BlockNumber)
+		}
+	}
+	if len(confirmed) != 2 || confirmed[0] != 19_000_000 || confirmed[1] != 19_000_000 {
+		t.Errorf("confirmed blocks = %v, want block 19000000 twice", confirmed)
+	}
+	if len(l.pendingEvents[19_000_001]) != 1 {
+		t.Errorf("block 19000001 pending = %+v", l.pendingEvents[19_000_001])
+	}
+}
+
+func TestETHFetcher_PendingTxs(t *testing.T) {
+	node := newFakeETHNode(t)
+	f := NewETHFetcher(ETHFetcherConfig{Endpoint: node.URL, Tokens: token.DefaultRegistry()})
+
+	txs, err := f.PendingTxs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 {
+		t.Fatalf("expected the 2 executable txs (queued skipped), got %d", len(txs))
+	}
+	byNonce := make(map[string]BlockTx)
+	for _, tx := range txs {
+		if len(tx.Conflicts) != 1 {
+			t.Fatalf("conflicts = %v", tx.Conflicts)
+		}
+		byNonce[tx.Conflicts[0]] = tx
+	}
+
+	native := byNonce["0x9858effd232b4033e47d90003d41ec34ecaeda94/9"]
+	if native.To != "0x3535353535353535353535353535353535353535" || native.Amount.String() != "500000000000000000" || len(native.Logs) != 0 {
+		t.Errorf("native = %+v", native)
+	}
+	// The transfer call carries the Transfer log it will emit.
+	usdt := byNonce["0x9858effd232b4033e47d90003d41ec34ecaeda94/10"]
+	if len(usdt.Logs) != 1 {
+		t.Fatalf("usdt logs = %+v", usdt.Logs)
+	}
+	from, to, amount, err := token.DecodeTransferEvent(usdt.Logs[0].Topics, usdt.Logs[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usdt.Logs[0].Address != token.USDTEthereum.Contract || amount.Int64() != 25_000_000 ||
+		fmt.Sprintf("%x", from) != "9858effd232b4033e47d90003d41ec34ecaeda94" ||
+		fmt.Sprintf("%x", to) != "3535353535353535353535353535353535353535" {
+		t.Errorf("usdt log = %+v", usdt.Logs[0])
+	}
+}
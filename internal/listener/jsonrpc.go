@@ -0,0 +1,240 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultRPCTimeout bounds a single HTTP round trip when no timeout is configured.
+const defaultRPCTimeout = 10 * time.Second
+
+// RPCError is an error object returned by a JSON-RPC server.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// rpcClient is a minimal JSON-RPC client over HTTP with batch support.
+// It speaks JSON-RPC 2.0, which Bitcoin Core also accepts.
+type rpcClient struct {
+	endpoint string
+	user     string // HTTP basic auth, used by bitcoind
+	password string
+	http     *http.Client
+	nextID   atomic.Uint64
+}
+
+func newRPCClient(endpoint string, timeout time.Duration, httpClient *http.Client) *rpcClient {
+	if httpClient == nil {
+		if timeout <= 0 {
+			timeout = defaultRPCTimeout
+		}
+		httpClient = &http.Client{Timeout: timeout}
+	}
+	return &rpcClient{endpoint: endpoint, http: httpClient}
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      uint64 `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// rpcCall is one call of a batch. Result receives the decoded result and Err
+// the per-call error.
+type rpcCall struct {
+	Method string
+	Params []any
+	Result any
+	Err    error
+}
+
+// Call performs a single JSON-RPC call and decodes its result into result.
+func (c *rpcClient) Call(ctx context.Context, method string, result any, params ...any) error {
+	call := rpcCall{Method: method, Params: params, Result: result}
+	if err := c.send(ctx, []*rpcCall{&call}, false); err != nil {
+		return err
+	}
+	return call.Err
+}
+
+// BatchCall sends all calls in one HTTP request. A transport failure is
+// returned directly; failures of individual calls are set on their Err field.
+func (c *rpcClient) BatchCall(ctx context.Context, calls []*rpcCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	return c.send(ctx, calls, true)
+}
+
+func (c *rpcClient) send(ctx context.Context, calls []*rpcCall, batch bool) error {
+	reqs := make([]rpcRequest, len(calls))
+	byID := make(map[uint64]*rpcCall, len(calls))
+	for i, call := range calls {
+		id := c.nextID.Add(1)
+		params := call.Params
+		if params == nil {
+			params = []any{}
+		}
+		reqs[i] = rpcRequest{JSONRPC: "2.0", ID: id, Method: call.Method, Params: params}
+		byID[id] = call
+	}
+
+	var body []byte
+	var err error
+	if batch {
+		body, err = json.Marshal(reqs)
+	} else {
+		body, err = json.Marshal(reqs[0])
+	}
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.user != "" {
+		httpReq.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("%s: %w", calls[0].Method, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	// Servers may report call errors with a non-2xx status (bitcoind uses 500),
+	// so decode the body first and only fall back to the status code.
+	var responses []rpcResponse
+	if batch {
+		err = json.Unmarshal(raw, &responses)
+	} else {
+		var single rpcResponse
+		err = json.Unmarshal(raw, &single)
+		responses = []rpcResponse{single}
+	}
+	if err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: http status %s", calls[0].Method, resp.Status)
+		}
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	for _, r := range responses {
+		call, ok := byID[r.ID]
+		if !ok {
+			continue
+		}
+		delete(byID, r.ID)
+		switch {
+		case r.Error != nil:
+			call.Err = fmt.Errorf("%s: %w", call.Method, r.Error)
+		case call.Result != nil:
+			if err := json.Unmarshal(r.Result, call.Result); err != nil {
+				call.Err = fmt.Errorf("%s: decode result: %w", call.Method, err)
+			}
+		}
+	}
+	for _, call := range byID {
+		call.Err = fmt.Errorf("%s: no response", call.Method)
+	}
+	return nil
+}
+
+// ----- hex quantity encoding (Ethereum JSON-RPC) -----
+
+// hexUint64 is a 0x-prefixed hex quantity decoded into a uint64.
+type hexUint64 uint64
+
+func (h *hexUint64) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	n, err := parseHexUint64(s)
+	if err != nil {
+		return err
+	}
+	*h = hexUint64(n)
+	return nil
+}
+
+// hexBig is a 0x-prefixed hex quantity decoded into a big.Int.
+type hexBig big.Int
+
+func (h *hexBig) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	digits, err := hexDigits(s)
+	if err != nil {
+		return err
+	}
+	n, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return fmt.Errorf("invalid hex quantity %q", s)
+	}
+	*h = hexBig(*n)
+	return nil
+}
+
+// Int returns the value as a *big.Int; nil receivers yield zero.
+func (h *hexBig) Int() *big.Int {
+	if h == nil {
+		return big.NewInt(0)
+	}
+	n := big.Int(*h)
+	return new(big.Int).Set(&n)
+}
+
+func parseHexUint64(s string) (uint64, error) {
+	digits, err := hexDigits(s)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(digits, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hex quantity %q: %w", s, err)
+	}
+	return n, nil
+}
+
+// hexDigits strips the 0x prefix of a quantity, which must have at least one digit.
+func hexDigits(s string) (string, error) {
+	if !strings.HasPrefix(s, "0x") || len(s) < 3 {
+		return "", fmt.Errorf("invalid hex quantity %q", s)
+	}
+	return s[2:], nil
+}
+
+func encodeHexUint64(n uint64) string {
+	return "0x" + strconv.FormatUint(n, 16)
+}
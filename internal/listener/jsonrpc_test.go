@@ -0,0 +1,183 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rpcHandler answers one JSON-RPC call of a fake node.
+type rpcHandler func(method string, params []json.RawMessage) (any, *RPCError)
+
+// fakeRPCServer is an httptest stand-in for a JSON-RPC node. It records the
+// number of HTTP requests, the methods called and the basic auth credentials
+// of the last request.
+type fakeRPCServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests int
+	methods  []string
+	user     string
+	password string
+}
+
+func newFakeRPCServer(t *testing.T, handle rpcHandler) *fakeRPCServer {
+	t.Helper()
+	s := &fakeRPCServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		type request struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		type response struct {
+			JSONRPC string          `json:"jsonrpc"`
+			ID      json.RawMessage `json:"id"`
+			Result  any             `json:"result"`
+			Error   *RPCError       `json:"error,omitempty"`
+		}
+		answer := func(req request) response {
+			s.mu.Lock()
+			s.methods = append(s.methods, req.Method)
+			s.mu.Unlock()
+			result, rpcErr := handle(req.Method, req.Params)
+			return response{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}
+		}
+
+		s.mu.Lock()
+		s.requests++
+		s.user, s.password, _ = r.BasicAuth()
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+			var reqs []request
+			if err := json.Unmarshal(body, &reqs); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// Answer in reverse order: clients must match responses by ID.
+			resps := make([]response, len(reqs))
+			for i, req := range reqs {
+				resps[len(reqs)-1-i] = answer(req)
+			}
+			_ = json.NewEncoder(w).Encode(resps)
+			return
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(answer(req))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeRPCServer) stats() (requests int, methods []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, append([]string(nil), s.methods...)
+}
+
+func (s *fakeRPCServer) credentials() (user, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user, s.password
+}
+
+func TestRPCClient_CallAndBatch(t *testing.T) {
+	srv := newFakeRPCServer(t, func(method string, params []json.RawMessage) (any, *RPCError) {
+		switch method {
+		case "echo":
+			var s string
+			_ = json.Unmarshal(params[0], &s)
+			return s, nil
+		default:
+			return nil, &RPCError{Code: -32601, Message: "method not found"}
+		}
+	})
+	c := newRPCClient(srv.URL, time.Second, nil)
+	ctx := context.Background()
+
+	var got string
+	if err := c.Call(ctx, "echo", &got, "hello"); err != nil || got != "hello" {
+		t.Fatalf("Call = %q, %v", got, err)
+	}
+
+	var a, b string
+	calls := []*rpcCall{
+		{Method: "echo", Params: []any{"a"}, Result: &a},
+		{Method: "missing"},
+		{Method: "echo", Params: []any{"b"}, Result: &b},
+	}
+	if err := c.BatchCall(ctx, calls); err != nil {
+		t.Fatal(err)
+	}
+	if a != "a" || b != "b" || calls[0].Err != nil || calls[2].Err != nil {
+		t.Errorf("batch results = %q %q, errors %v %v", a, b, calls[0].Err, calls[2].Err)
+	}
+	var rpcErr *RPCError
+	if !errors.As(calls[1].Err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("expected method-not-found error, got %v", calls[1].Err)
+	}
+
+	if requests, _ := srv.stats(); requests != 2 {
+		t.Errorf("expected 2 HTTP requests (single + batch), got %d", requests)
+	}
+}
+
+func TestRPCClient_HTTPErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	err := newRPCClient(srv.URL, time.Second, nil).Call(context.Background(), "eth_blockNumber", nil)
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("expected http status error, got %v", err)
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	if err := newRPCClient(slow.URL, 20*time.Millisecond, nil).Call(context.Background(), "eth_blockNumber", nil); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+func TestHexQuantities(t *testing.T) {
+	var n hexUint64
+	if err := json.Unmarshal([]byte(`"0x121eac0"`), &n); err != nil || n != 19_000_000 {
+		t.Errorf("hexUint64 = %d, %v", n, err)
+	}
+	var b hexBig
+	if err := json.Unmarshal([]byte(`"0xde0b6b3a7640000"`), &b); err != nil || b.Int().String() != "1000000000000000000" {
+		t.Errorf("hexBig = %v, %v", b.Int(), err)
+	}
+	for _, bad := range []string{`"0x"`, `"121eac0"`, `"0xzz"`, `18`} {
+		if err := json.Unmarshal([]byte(bad), &n); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+	if s := encodeHexUint64(19_000_000); s != "0x121eac0" {
+		t.Errorf("encode = %s", s)
+	}
+	if (*hexBig)(nil).Int().Sign() != 0 {
+		t.Error("nil hexBig should be zero")
+	}
+}
@@ -2,12 +2,17 @@ package listener
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/internal/token"
+	"github.com/OKaluzny/wallet-demo/internal/wallet"
 	"github.com/OKaluzny/wallet-demo/pkg/models"
 )
 
@@ -31,14 +36,34 @@ type BlockListener interface {
 }
 
 // EventHandler processes detected blockchain events.
-// In production: update balances, send notifications, trigger webhooks.
+// In production: update balances, send notifications, trigger webhooks
+// (see webhook.Notifier).
 type EventHandler func(event models.BlockEvent) error
 
+// Handlers combines handlers into one that calls each in order and returns
+// their joined errors. The Manager retries the whole event on error, so the
+// handlers must tolerate seeing an event again; ledger.Ledger,
+// journal.Journal and webhook.Notifier do.
+func Handlers(handlers ...EventHandler) EventHandler {
+	return func(event models.BlockEvent) error {
+		var errs []error
+		for _, h := range handlers {
+			if err := h(event); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
 // BlockData represents the data returned by a block fetcher.
 type BlockData struct {
 	Number uint64
 	Hash   string
-	Txs    []BlockTx
+	// ParentHash links the block to its predecessor; a mismatch with the
+	// tracked hash of the previous block reveals a reorg at the tip.
+	ParentHash string
+	Txs        []BlockTx
 }
 
 // BlockTx represents a transaction within a block.
@@ -47,10 +72,32 @@ type BlockTx struct {
 	From   string
 	To     string
 	Amount *big.Int
+	// Vout is the output index for UTXO chains, where each output of a
+	// transaction is reported as its own BlockTx.
+	Vout uint32
+	// Inputs lists the distinct addresses spent by a UTXO transaction's
+	// inputs; From is the first of them.
+	Inputs []string
+	// Logs are the events emitted by the transaction, from its receipt.
+	// Reverted transactions have none.
+	Logs []Log
+	// Conflicts identify what the transaction consumes: "<from>/<nonce>" on
+	// ETH, the spent "<txid>:<vout>" outpoints on BTC. Another transaction
+	// sharing a key replaces it. Empty where replacement does not apply.
+	Conflicts []string
+}
+
+// Log is a contract event log from a transaction receipt.
+type Log struct {
+	Index   uint     // position of the log in the block
+	Address string   // contract that emitted the log
+	Topics  []string // hex-encoded 32-byte topics; topic 0 is the event signature hash
+	Data    []byte   // non-indexed event arguments
 }
 
 // BlockFetcher abstracts the chain RPC calls for block data.
 // In production: wraps eth_blockNumber + eth_getBlockByNumber, etc.
+// Fetchers for chains with tokens also fill BlockTx.Logs from receipts.
 type BlockFetcher interface {
 	// LatestBlockNumber returns the current chain head.
 	LatestBlockNumber(ctx context.Context) (uint64, error)
@@ -58,59 +105,171 @@ type BlockFetcher interface {
 	GetBlock(ctx context.Context, number uint64) (*BlockData, error)
 }
 
+// MempoolFetcher is implemented by fetchers that can list unmined
+// transactions: ETHFetcher (txpool_content), BTCFetcher (getrawmempool) and
+// TRXFetcher (the pending pool).
+type MempoolFetcher interface {
+	// PendingTxs returns the transactions currently in the node's mempool,
+	// in the same form as block transactions.
+	PendingTxs(ctx context.Context) ([]BlockTx, error)
+}
+
+// BlockRangeFetcher is implemented by fetchers that can return consecutive
+// blocks in one round trip, such as ETHFetcher with batched JSON-RPC.
+type BlockRangeFetcher interface {
+	// GetBlocks returns blocks from..to inclusive, in order.
+	GetBlocks(ctx context.Context, from, to uint64) ([]*BlockData, error)
+}
+
 // ----- Generic polling-based listener (works for any JSON-RPC chain) -----
 
 // PollingConfig holds configuration for the polling listener.
 type PollingConfig struct {
 	ConfirmationDepth uint64 // blocks required before marking tx as confirmed
+	// ConfirmationTiers require more blocks for large amounts; an event waits
+	// for the deepest tier its amount reaches.
+	ConfirmationTiers []ConfirmationTier
+	// Finality confirms events once the node reports their block final,
+	// instead of at a fixed depth. The fetcher must implement FinalityFetcher.
+	Finality FinalityMode
+	// Tokens lists the token contracts whose Transfer events are reported.
+	// Transfers from unknown contracts are ignored; nil disables token detection.
+	Tokens *token.Registry
+	// Checkpoints persists the listener position after every block, so a
+	// restarted listener resumes from the last processed block with its reorg
+	// window and unconfirmed events. Nil keeps the state in memory only.
+	Checkpoints storage.CheckpointStore
+	// StartBlock is the first block to process when no checkpoint exists.
+	// Zero starts from block 1.
+	StartBlock uint64
+	// CatchUpWorkers is the number of concurrent block fetches used while the
+	// listener is further behind the tip than the confirmation window. Blocks are
+	// still processed strictly in order. Values below 2 disable catch-up mode.
+	CatchUpWorkers int
+	// CatchUpBatchSize is the number of blocks per fetch when the fetcher
+	// implements BlockRangeFetcher (default 10).
+	CatchUpBatchSize int
+	// OnCatchUpProgress, if set, is called after each block processed in
+	// catch-up mode.
+	OnCatchUpProgress func(CatchUpProgress)
+	// ProgressEvents re-emits each unconfirmed event with its current
+	// Confirmations count as the depth grows, until it is confirmed.
+	ProgressEvents bool
+	// ProgressStep is the minimum depth increase between two progress
+	// events of the same transaction (default 1).
+	ProgressStep uint64
+	// ProgressInterval is the minimum time between two rounds of progress
+	// events; zero emits them on every new block.
+	ProgressInterval time.Duration
+	// WatchMempool reports watched transactions from the node's mempool as
+	// Pending events before they are mined. The fetcher must implement
+	// MempoolFetcher. The mempool is read on every poll.
+	WatchMempool bool
+	// MaxReorgDepth is the deepest reorg, in orphaned blocks, that is rolled
+	// back automatically (default: the deepest confirmation depth, which is
+	// also the maximum in depth mode). A deeper
+	// one emits a deep-reorg alert event and stops the listener advancing
+	// until the tracked chain becomes canonical again.
+	MaxReorgDepth uint64
 }
 
-// PollingListener implements BlockListener using periodic block polling.
-// Tracks block hashes to detect chain reorganizations.
-type PollingListener struct {
-	network      models.Network
-	pollInterval time.Duration
-	events       chan models.BlockEvent
-	watchStore   storage.WatchStore
-	fetcher      BlockFetcher
-	cfg          PollingConfig
-	lastBlock    uint64
+// ErrReorgTooDeep is returned while a reorg deeper than MaxReorgDepth is pending.
+var ErrReorgTooDeep = errors.New("reorg deeper than max reorg depth")
+
+// blockTracker holds the chain-following state shared by the polling and
+// subscription listeners: the watch list, recent block hashes for reorg
+// detection and unconfirmed events awaiting confirmation depth. It is driven
+// from a single goroutine and is not safe for concurrent use.
+type blockTracker struct {
+	network    models.Network
+	events     chan models.BlockEvent
+	watchStore storage.WatchStore
+	fetcher    BlockFetcher
+	cfg        PollingConfig
+	lastBlock  uint64
 	// blockHashes tracks recent block number -> hash for reorg detection.
-	// Kept for the last confirmationDepth+1 blocks.
+	// Kept for the last window+1 blocks, or down to the final block in
+	// finality mode.
 	blockHashes map[uint64]string
 	// pendingEvents stores unconfirmed events keyed by block number for reorg rollback.
 	pendingEvents map[uint64][]models.BlockEvent
-	logger        *slog.Logger
-	cancel        context.CancelFunc
-	done          chan struct{}
+	// reorgAlerted is set once a deep-reorg alert was emitted, so repeated
+	// polls against the same fork do not repeat it.
+	reorgAlerted bool
+	// lastProgress is when progress events were last emitted.
+	lastProgress time.Time
+	// mempool holds the watched pending transactions by tx hash until they
+	// are mined, dropped or replaced.
+	mempool map[string]*mempoolTx
+	// outbox, set by the Manager, receives every event before it is sent on
+	// events, so the tracker never checkpoints past an event that is not
+	// stored yet.
+	outbox storage.OutboxStore
+	logger *slog.Logger
 }
 
-// NewPollingListener creates a new polling-based block listener for the given network.
-func NewPollingListener(network models.Network, pollInterval time.Duration, ws storage.WatchStore, fetcher BlockFetcher, cfg PollingConfig) *PollingListener {
+func newBlockTracker(network models.Network, ws storage.WatchStore, fetcher BlockFetcher, cfg PollingConfig) blockTracker {
 	if cfg.ConfirmationDepth == 0 {
 		cfg.ConfirmationDepth = 12
 	}
-	return &PollingListener{
+	if cfg.ProgressStep == 0 {
+		cfg.ProgressStep = 1
+	}
+	// In depth mode hashes are only kept for the confirmation window, so
+	// deeper reorgs cannot be walked back.
+	if cfg.MaxReorgDepth == 0 || cfg.Finality == FinalityDepth && cfg.MaxReorgDepth > cfg.window() {
+		cfg.MaxReorgDepth = cfg.window()
+	}
+	var lastBlock uint64
+	if cfg.StartBlock > 0 {
+		lastBlock = cfg.StartBlock - 1
+	}
+	return blockTracker{
 		network:       network,
-		pollInterval:  pollInterval,
 		events:        make(chan models.BlockEvent, 100),
 		watchStore:    ws,
 		fetcher:       fetcher,
 		cfg:           cfg,
+		lastBlock:     lastBlock,
 		blockHashes:   make(map[uint64]string),
 		pendingEvents: make(map[uint64][]models.BlockEvent),
-		done:          make(chan struct{}),
+		mempool:       make(map[string]*mempoolTx),
 		logger:        slog.Default().With("component", "listener", "network", string(network)),
 	}
 }
 
+// PollingListener implements BlockListener using periodic block polling.
+// Tracks block hashes to detect chain reorganizations.
+type PollingListener struct {
+	blockTracker
+	pollInterval time.Duration
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+// NewPollingListener creates a new polling-based block listener for the given network.
+func NewPollingListener(network models.Network, pollInterval time.Duration, ws storage.WatchStore, fetcher BlockFetcher, cfg PollingConfig) *PollingListener {
+	return &PollingListener{
+		blockTracker: newBlockTracker(network, ws, fetcher, cfg),
+		pollInterval: pollInterval,
+		done:         make(chan struct{}),
+	}
+}
+
 // Start begins polling for new blocks.
 func (l *PollingListener) Start(ctx context.Context) error {
+	if err := l.validate(); err != nil {
+		return err
+	}
+	if err := l.restore(); err != nil {
+		return err
+	}
 	ctx, l.cancel = context.WithCancel(ctx)
 
 	l.logger.Info("starting block listener",
 		"poll_interval", l.pollInterval,
 		"confirmation_depth", l.cfg.ConfirmationDepth,
+		"finality", l.cfg.Finality,
 	)
 
 	go l.pollLoop(ctx)
@@ -128,74 +287,193 @@ func (l *PollingListener) Stop() error {
 	return nil
 }
 
+func (l *PollingListener) pollLoop(ctx context.Context) {
+	defer close(l.done)
+	ticker := time.NewTicker(l.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.poll(ctx); err != nil {
+				l.logger.Error("poll failed", "error", err)
+			}
+		}
+	}
+}
+
+// restore loads the saved checkpoint, if any, replacing the StartBlock position.
+func (t *blockTracker) restore() error {
+	if t.cfg.Checkpoints == nil {
+		return nil
+	}
+	cp, err := t.cfg.Checkpoints.Load(t.network)
+	if err != nil {
+		return fmt.Errorf("load checkpoint: %w", err)
+	}
+	if cp == nil {
+		return nil
+	}
+	t.lastBlock = cp.LastBlock
+	t.blockHashes = cp.BlockHashes
+	t.pendingEvents = cp.PendingEvents
+	if t.blockHashes == nil {
+		t.blockHashes = make(map[uint64]string)
+	}
+	if t.pendingEvents == nil {
+		t.pendingEvents = make(map[uint64][]models.BlockEvent)
+	}
+	t.logger.Info("resuming from checkpoint",
+		"last_block", t.lastBlock,
+		"pending_blocks", len(t.pendingEvents),
+	)
+	return nil
+}
+
+// saveCheckpoint persists the tracker state. Each save is a full snapshot, so
+// a failed save is logged and healed by the next one rather than failing
+// block processing.
+func (t *blockTracker) saveCheckpoint() {
+	if t.cfg.Checkpoints == nil {
+		return
+	}
+	cp := storage.Checkpoint{
+		LastBlock:     t.lastBlock,
+		BlockHashes:   t.blockHashes,
+		PendingEvents: t.pendingEvents,
+	}
+	if err := t.cfg.Checkpoints.Save(t.network, cp); err != nil {
+		t.logger.Error("save checkpoint failed", "block", t.lastBlock, "error", err)
+	}
+}
+
+// normalizeAddress returns the form in which fetchers report an address:
+// lowercase for ETH, whose EIP-55 checksum casing is not significant.
+func (t *blockTracker) normalizeAddress(address string) string {
+	if t.network == models.NetworkETH {
+		return strings.ToLower(address)
+	}
+	return address
+}
+
 // WatchAddress adds an address to the watch list.
-func (l *PollingListener) WatchAddress(address string) error {
-	if err := l.watchStore.Add(address); err != nil {
+func (t *blockTracker) WatchAddress(address string) error {
+	address = t.normalizeAddress(address)
+	if err := t.watchStore.Add(address); err != nil {
 		return err
 	}
-	l.logger.Info("watching address", "address", address)
+	t.logger.Info("watching address", "address", address)
 	return nil
 }
 
 // UnwatchAddress removes an address from the watch list.
-func (l *PollingListener) UnwatchAddress(address string) error {
-	if err := l.watchStore.Remove(address); err != nil {
+func (t *blockTracker) UnwatchAddress(address string) error {
+	if err := t.watchStore.Remove(address); err != nil {
 		return err
 	}
-	l.logger.Info("unwatched address", "address", address)
+	if normalized := t.normalizeAddress(address); normalized != address {
+		if err := t.watchStore.Remove(normalized); err != nil {
+			return err
+		}
+	}
+	t.logger.Info("unwatched address", "address", address)
 	return nil
 }
 
 // Events returns the channel of detected block events.
-func (l *PollingListener) Events() <-chan models.BlockEvent {
-	return l.events
+func (t *blockTracker) Events() <-chan models.BlockEvent {
+	return t.events
 }
 
-func (l *PollingListener) pollLoop(ctx context.Context) {
-	defer close(l.done)
-	ticker := time.NewTicker(l.pollInterval)
-	defer ticker.Stop()
+// useOutbox makes the tracker write its events to the Manager's outbox.
+func (t *blockTracker) useOutbox(outbox storage.OutboxStore) {
+	t.outbox = outbox
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			if err := l.poll(ctx); err != nil {
-				l.logger.Error("poll failed", "error", err)
-			}
+// emit writes an event to the outbox, if any, and sends it on the events
+// channel. On error the caller leaves its state as it was, so the event is
+// emitted again by the next poll; the outbox drops the duplicate by ID.
+func (t *blockTracker) emit(ctx context.Context, ev models.BlockEvent) error {
+	if t.outbox != nil {
+		ev.ID = EventID(ev)
+		if _, err := t.outbox.Add(storage.OutboxEntry{Event: ev, CreatedAt: time.Now()}); err != nil {
+			return fmt.Errorf("write outbox: %w", err)
 		}
 	}
+	select {
+	case t.events <- ev:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (l *PollingListener) poll(ctx context.Context) error {
-	latest, err := l.fetcher.LatestBlockNumber(ctx)
+func (t *blockTracker) poll(ctx context.Context) error {
+	// The mempool is read before the head, so a watched transaction that
+	// left it was either mined in a block processed below or dropped.
+	left := t.scanMempool(ctx)
+
+	latest, err := t.fetcher.LatestBlockNumber(ctx)
 	if err != nil {
 		return fmt.Errorf("latest block: %w", err)
 	}
+	if err := t.advance(ctx, latest); err != nil {
+		return err
+	}
+	return t.dropPending(ctx, left)
+}
+
+// advance processes blocks up to latest and promotes events that were
+// confirmed.
+func (t *blockTracker) advance(ctx context.Context, latest uint64) error {
+	// Far behind the tip: backfill with parallel fetches up to the start of
+	// the confirmation window, then follow the tip block by block.
+	if window := t.cfg.window(); latest > t.lastBlock+window && t.cfg.CatchUpWorkers > 1 {
+		if err := t.catchUp(ctx, latest-window); err != nil {
+			return err
+		}
+	}
 
-	// Process all blocks from lastBlock+1 to latest
-	for num := l.lastBlock + 1; num <= latest; num++ {
-		if err := l.processBlock(ctx, num); err != nil {
+	// Process all blocks from lastBlock+1 to latest. A reorg rewinds
+	// lastBlock to the common ancestor and the canonical branch is processed.
+	for t.lastBlock < latest {
+		num := t.lastBlock + 1
+		if err := t.processBlock(ctx, num); err != nil {
 			return fmt.Errorf("process block %d: %w", num, err)
 		}
+		t.saveCheckpoint()
 	}
 
 	// Check for newly confirmed events
-	l.checkConfirmations(ctx, latest)
-
-	return nil
+	err := t.checkConfirmations(ctx, latest)
+	t.saveCheckpoint()
+	return err
 }
 
-func (l *PollingListener) processBlock(ctx context.Context, number uint64) error {
-	block, err := l.fetcher.GetBlock(ctx, number)
+func (t *blockTracker) processBlock(ctx context.Context, number uint64) error {
+	block, err := t.fetcher.GetBlock(ctx, number)
 	if err != nil {
 		return fmt.Errorf("get block: %w", err)
 	}
+	return t.applyBlock(ctx, number, block)
+}
+
+// applyBlock checks a fetched block for a reorg, records its hash and emits
+// events for watched addresses. If the block does not extend the tracked
+// chain, the tracker is rolled back to the common ancestor instead and
+// lastBlock ends up below number. lastBlock only reaches number once all
+// events of the block are emitted.
+func (t *blockTracker) applyBlock(ctx context.Context, number uint64, block *BlockData) error {
+	if prevHash, ok := t.blockHashes[number-1]; ok && block.ParentHash != "" && prevHash != block.ParentHash {
+		return t.rollBack(ctx, number, block)
+	}
+	t.reorgAlerted = false
 
 	// Reorg detection: check if stored hash differs from what we just fetched
-	if prevHash, ok := l.blockHashes[number]; ok && prevHash != block.Hash {
-		l.logger.Warn("chain reorganization detected",
+	if prevHash, ok := t.blockHashes[number]; ok && prevHash != block.Hash {
+		t.logger.Warn("chain reorganization detected",
 			"block", number,
 			"old_hash", prevHash,
 			"new_hash", block.Hash,
@@ -203,168 +481,366 @@ func (l *PollingListener) processBlock(ctx context.Context, number uint64) error
 		// Invalidate all pending events from this block onward.
 		// Use the highest block we have hashes for as upper bound.
 		var maxStored uint64
-		for bn := range l.blockHashes {
+		for bn := range t.blockHashes {
 			if bn > maxStored {
 				maxStored = bn
 			}
 		}
-		l.handleReorg(ctx, number, maxStored)
+		if err := t.handleReorg(ctx, number, maxStored); err != nil {
+			return err
+		}
 	}
 
 	// Store this block's hash
-	l.blockHashes[number] = block.Hash
-	l.lastBlock = number
+	t.blockHashes[number] = block.Hash
 
 	// Prune old block hashes beyond confirmation window
-	if number > l.cfg.ConfirmationDepth+1 {
-		delete(l.blockHashes, number-l.cfg.ConfirmationDepth-1)
+	if window := t.cfg.window(); t.cfg.Finality == FinalityDepth && number > window+1 {
+		delete(t.blockHashes, number-window-1)
+	}
+
+	if err := t.linkMined(ctx, block); err != nil {
+		return err
 	}
 
 	// Match transactions against watched addresses
-	addrs, err := l.watchStore.List()
+	addrSet, err := t.watchedSet()
 	if err != nil {
-		return fmt.Errorf("list watched: %w", err)
+		return err
+	}
+
+	events := t.matchBlock(block, addrSet)
+	for _, event := range events {
+		t.logger.Info("detected transaction",
+			"block", number,
+			"tx", event.TxHash,
+			"to", event.To,
+			"token", event.TokenSymbol,
+			"confirmed", false,
+		)
+		if err := t.emit(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	t.pendingEvents[number] = append(t.pendingEvents[number], events...)
+	t.lastBlock = number
+	return nil
+}
+
+// watchedSet returns the watched addresses as a set, normalized like the
+// addresses reported by the fetcher.
+func (t *blockTracker) watchedSet() (map[string]bool, error) {
+	addrs, err := t.watchStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("list watched: %w", err)
 	}
 	addrSet := make(map[string]bool, len(addrs))
 	for _, a := range addrs {
-		addrSet[a] = true
+		addrSet[t.normalizeAddress(a)] = true
 	}
+	return addrSet, nil
+}
 
+// matchBlock returns events for native transfers and token Transfer logs
+// that involve a watched address, in block order.
+func (t *blockTracker) matchBlock(block *BlockData, addrSet map[string]bool) []models.BlockEvent {
+	var events []models.BlockEvent
 	for _, tx := range block.Txs {
-		if addrSet[tx.To] || addrSet[tx.From] {
-			event := models.BlockEvent{
-				Network:     l.network,
-				BlockNumber: number,
+		from, spent := watchedSender(tx, addrSet)
+		if addrSet[tx.To] || spent {
+			events = append(events, models.BlockEvent{
+				Network:     t.network,
+				BlockNumber: block.Number,
+				BlockHash:   block.Hash,
 				TxHash:      tx.Hash,
-				From:        tx.From,
+				Vout:        tx.Vout,
+				From:        from,
 				To:          tx.To,
 				Amount:      tx.Amount,
 				Confirmed:   false,
+			})
+		}
+		for _, lg := range tx.Logs {
+			event, ok := t.tokenEvent(block, tx.Hash, lg)
+			if ok && (addrSet[event.To] || addrSet[event.From]) {
+				events = append(events, event)
 			}
+		}
+	}
+	return events
+}
 
-			l.pendingEvents[number] = append(l.pendingEvents[number], event)
-
-			l.logger.Info("detected transaction",
-				"block", number,
-				"tx", tx.Hash,
-				"to", tx.To,
-				"confirmed", false,
-			)
-
-			select {
-			case l.events <- event:
-			case <-ctx.Done():
-				return ctx.Err()
-			}
+// watchedSender reports whether tx spends from a watched address and returns
+// the sender to put on the event: the watched input address if there is one,
+// tx.From otherwise.
+func watchedSender(tx BlockTx, addrSet map[string]bool) (string, bool) {
+	if addrSet[tx.From] {
+		return tx.From, true
+	}
+	for _, in := range tx.Inputs {
+		if addrSet[in] {
+			return in, true
 		}
 	}
+	return tx.From, false
+}
 
-	return nil
+// tokenEvent decodes a Transfer log emitted by a registered token contract.
+func (t *blockTracker) tokenEvent(block *BlockData, txHash string, lg Log) (models.BlockEvent, bool) {
+	if t.cfg.Tokens == nil {
+		return models.BlockEvent{}, false
+	}
+	tok, ok := t.cfg.Tokens.ByContract(t.network, lg.Address)
+	if !ok {
+		return models.BlockEvent{}, false
+	}
+	from, to, amount, err := token.DecodeTransferEvent(lg.Topics, lg.Data)
+	if err != nil {
+		return models.BlockEvent{}, false // another event of the token contract
+	}
+	fromAddr, err := wallet.EncodeAccountAddress(t.network, from)
+	if err != nil {
+		return models.BlockEvent{}, false
+	}
+	toAddr, err := wallet.EncodeAccountAddress(t.network, to)
+	if err != nil {
+		return models.BlockEvent{}, false
+	}
+	return models.BlockEvent{
+		Network:       t.network,
+		BlockNumber:   block.Number,
+		BlockHash:     block.Hash,
+		TxHash:        txHash,
+		From:          fromAddr,
+		To:            toAddr,
+		Amount:        amount,
+		TokenContract: tok.Contract,
+		TokenSymbol:   tok.Symbol,
+		LogIndex:      lg.Index,
+	}, true
 }
 
 // handleReorg emits Reorged=true events for all pending events from reorgBlock to upTo,
 // then removes them from pendingEvents so re-processing can produce fresh events.
-func (l *PollingListener) handleReorg(ctx context.Context, reorgBlock uint64, upTo uint64) {
+// If an event cannot be emitted nothing is removed and the reorg is handled
+// again on the next poll.
+func (t *blockTracker) handleReorg(ctx context.Context, reorgBlock uint64, upTo uint64) error {
 	for blockNum := reorgBlock; blockNum <= upTo; blockNum++ {
-		events, ok := l.pendingEvents[blockNum]
-		if !ok {
-			continue
-		}
-		for _, ev := range events {
+		for _, ev := range t.pendingEvents[blockNum] {
 			ev.Reorged = true
 			ev.Confirmed = false
-			l.logger.Warn("reorg: invalidating event",
+			ev.Confirmations = 0
+			t.logger.Warn("reorg: invalidating event",
 				"block", ev.BlockNumber,
 				"tx", ev.TxHash,
 			)
-			select {
-			case l.events <- ev:
-			case <-ctx.Done():
-				return
+			if err := t.emit(ctx, ev); err != nil {
+				return err
 			}
 		}
-		delete(l.pendingEvents, blockNum)
-		delete(l.blockHashes, blockNum)
-	}
-}
-
-// checkConfirmations promotes pending events to confirmed once they have enough depth.
-func (l *PollingListener) checkConfirmations(ctx context.Context, currentBlock uint64) {
-	for blockNum, events := range l.pendingEvents {
-		if currentBlock >= blockNum+l.cfg.ConfirmationDepth {
-			for _, ev := range events {
-				ev.Confirmed = true
-				l.logger.Info("transaction confirmed",
-					"block", ev.BlockNumber,
-					"tx", ev.TxHash,
-					"depth", currentBlock-blockNum,
-				)
-				select {
-				case l.events <- ev:
-				case <-ctx.Done():
-					return
-				}
-			}
-			delete(l.pendingEvents, blockNum)
+	}
+	for blockNum := reorgBlock; blockNum <= upTo; blockNum++ {
+		delete(t.blockHashes, blockNum)
+		delete(t.pendingEvents, blockNum)
+	}
+	return nil
+}
+
+// rollBack handles a block whose parent is not the tracked block number-1:
+// it walks back to the common ancestor, invalidates the events of the
+// orphaned blocks and rewinds lastBlock so the canonical branch is processed
+// next. Reorgs deeper than MaxReorgDepth raise an alert instead.
+func (t *blockTracker) rollBack(ctx context.Context, number uint64, block *BlockData) error {
+	tip := number - 1
+	t.logger.Warn("chain reorganization detected",
+		"block", number,
+		"parent_hash", block.ParentHash,
+		"tracked_hash", t.blockHashes[tip],
+	)
+
+	ancestor, err := t.findCommonAncestor(ctx, tip)
+	if errors.Is(err, ErrReorgTooDeep) {
+		t.alertDeepReorg(ctx, number, err)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("find common ancestor: %w", err)
+	}
+
+	t.logger.Warn("rolling back to common ancestor",
+		"ancestor", ancestor,
+		"orphaned_blocks", tip-ancestor,
+	)
+	if err := t.handleReorg(ctx, ancestor+1, tip); err != nil {
+		return err
+	}
+	t.lastBlock = ancestor
+	return nil
+}
+
+// findCommonAncestor walks back from tip comparing tracked hashes with the
+// canonical chain and returns the highest block both agree on.
+func (t *blockTracker) findCommonAncestor(ctx context.Context, tip uint64) (uint64, error) {
+	for n := tip; n > 0; n-- {
+		depth := tip - n + 1 // orphaned blocks if n is not canonical either
+		stored, ok := t.blockHashes[n]
+		if !ok {
+			return 0, fmt.Errorf("%w: no common ancestor within %d tracked blocks", ErrReorgTooDeep, depth-1)
+		}
+		canonical, err := t.fetcher.GetBlock(ctx, n)
+		if err != nil {
+			return 0, fmt.Errorf("get block %d: %w", n, err)
+		}
+		if canonical.Hash == stored {
+			return n, nil
+		}
+		if depth > t.cfg.MaxReorgDepth {
+			return 0, fmt.Errorf("%w: more than %d blocks orphaned", ErrReorgTooDeep, t.cfg.MaxReorgDepth)
 		}
 	}
+	return 0, fmt.Errorf("%w: reorg reaches genesis", ErrReorgTooDeep)
+}
+
+// alertDeepReorg emits a deep-reorg alert event once per fork.
+func (t *blockTracker) alertDeepReorg(ctx context.Context, number uint64, cause error) {
+	t.logger.Error("reorg exceeds max depth, halting until the tracked chain is canonical",
+		"block", number,
+		"max_depth", t.cfg.MaxReorgDepth,
+		"error", cause,
+	)
+	if t.reorgAlerted {
+		return
+	}
+	alert := models.BlockEvent{
+		Network:     t.network,
+		BlockNumber: number,
+		Reorged:     true,
+		Alert:       models.AlertDeepReorg,
+	}
+	if err := t.emit(ctx, alert); err != nil {
+		t.logger.Error("emit deep-reorg alert failed", "block", number, "error", err)
+		return
+	}
+	t.reorgAlerted = true
 }
 
 // ----- Multi-chain listener manager -----
 
-// Manager coordinates listeners across multiple networks.
+// Manager coordinates listeners across multiple networks. Events pass
+// through a durable outbox on their way to the handler; see DeliveryConfig.
 type Manager struct {
 	listeners map[models.Network]BlockListener
 	handler   EventHandler
-	logger    *slog.Logger
+	delivery  DeliveryConfig
+	// writesOutbox marks the networks whose listener writes its events to
+	// the outbox itself (see outboxWriter).
+	writesOutbox map[models.Network]bool
+	// wake signals a network's dispatcher that its outbox entries changed.
+	wake map[models.Network]chan struct{}
+	// quit stops readers retrying outbox writes; stop stops the dispatchers.
+	quit        chan struct{}
+	stop        chan struct{}
+	readers     sync.WaitGroup
+	dispatchers sync.WaitGroup
+	logger      *slog.Logger
+}
+
+// outboxWriter is implemented by the listeners of this package. They write
+// each event to the outbox before checkpointing past it, so an event is
+// never lost between the listener and the Manager.
+type outboxWriter interface {
+	useOutbox(outbox storage.OutboxStore)
 }
 
-// NewManager creates a new multi-chain listener manager with the given event handler.
+// NewManager creates a new multi-chain listener manager with the given event
+// handler and the default in-memory delivery settings.
 func NewManager(handler EventHandler) *Manager {
+	return NewManagerWithDelivery(handler, DeliveryConfig{})
+}
+
+// NewManagerWithDelivery creates a listener manager that delivers events to
+// handler as configured by cfg.
+func NewManagerWithDelivery(handler EventHandler, cfg DeliveryConfig) *Manager {
+	if cfg.Outbox == nil {
+		cfg.Outbox = storage.NewMemoryOutboxStore()
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(defaultMaxBackoff, cfg.MinBackoff)
+	}
 	return &Manager{
-		listeners: make(map[models.Network]BlockListener),
-		handler:   handler,
-		logger:    slog.Default().With("component", "listener_manager"),
+		listeners:    make(map[models.Network]BlockListener),
+		handler:      handler,
+		delivery:     cfg,
+		writesOutbox: make(map[models.Network]bool),
+		wake:         make(map[models.Network]chan struct{}),
+		quit:         make(chan struct{}),
+		stop:         make(chan struct{}),
+		logger:       slog.Default().With("component", "listener_manager"),
 	}
 }
 
 // RegisterListener adds a block listener for the specified network.
 func (m *Manager) RegisterListener(network models.Network, listener BlockListener) {
 	m.listeners[network] = listener
+	m.wake[network] = make(chan struct{}, 1)
+	if w, ok := listener.(outboxWriter); ok {
+		w.useOutbox(m.delivery.Outbox)
+		m.writesOutbox[network] = true
+	}
 }
 
 // StartAll starts all registered listeners and routes events to the handler.
+// Events left in the outbox by a previous run are delivered first.
 func (m *Manager) StartAll(ctx context.Context) error {
 	for network, listener := range m.listeners {
 		if err := listener.Start(ctx); err != nil {
 			return fmt.Errorf("start %s listener: %w", network, err)
 		}
 
-		// Fan-in: route events from each listener to the common handler
+		// Fan-in: persist events from each listener, then deliver them to
+		// the common handler in order per network.
+		m.readers.Add(1)
 		go func(net models.Network, l BlockListener) {
+			defer m.readers.Done()
 			for event := range l.Events() {
-				if err := m.handler(event); err != nil {
-					m.logger.Error("handle event failed",
-						"network", net,
-						"block", event.BlockNumber,
-						"error", err,
-					)
+				if m.writesOutbox[net] {
+					m.wakeDispatcher(net) // already in the outbox
+					continue
 				}
+				m.enqueue(net, event)
 			}
 		}(network, listener)
+
+		m.dispatchers.Add(1)
+		go func(net models.Network) {
+			defer m.dispatchers.Done()
+			m.dispatch(net)
+		}(network)
 	}
 
 	m.logger.Info("all listeners started", "count", len(m.listeners))
 	return nil
 }
 
-// StopAll stops all registered listeners.
+// StopAll stops all registered listeners and waits for event delivery to
+// stop. Events not yet delivered stay in the outbox.
 func (m *Manager) StopAll() {
+	close(m.quit)
 	for network, listener := range m.listeners {
 		if err := listener.Stop(); err != nil {
 			m.logger.Error("stop listener failed", "network", network, "error", err)
 		}
 	}
+	m.readers.Wait()
+	close(m.stop)
+	m.dispatchers.Wait()
 }
 
 // WatchAddress adds an address to the appropriate network listener.
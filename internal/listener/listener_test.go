@@ -2,6 +2,7 @@ package listener
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/internal/token"
 	"github.com/OKaluzny/wallet-demo/pkg/models"
 )
 
@@ -145,6 +147,39 @@ func TestPollingListener_Stop(t *testing.T) {
 	}
 }
 
+func TestPollingListener_ChecksummedETHAddress(t *testing.T) {
+	l, ws, f := newTestListener()
+	// Watched with EIP-55 casing, directly in the store and via the listener.
+	if err := ws.Add("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.WatchAddress("0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"); err != nil {
+		t.Fatal(err)
+	}
+	f.addBlock(&BlockData{
+		Number: 1,
+		Hash:   "hash-1",
+		Txs: []BlockTx{
+			{Hash: "tx-1", From: "0xsender", To: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", Amount: big.NewInt(1)},
+			{Hash: "tx-2", From: "0xsender", To: "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359", Amount: big.NewInt(2)},
+		},
+	})
+
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if events := drainEvents(l); len(events) != 2 {
+		t.Fatalf("expected deposits to both checksummed addresses, got %+v", events)
+	}
+
+	if err := l.UnwatchAddress("0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := ws.Contains("0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359"); ok {
+		t.Error("unwatch with checksum casing should remove the address")
+	}
+}
+
 func TestPollingListener_Confirmation(t *testing.T) {
 	l, _, f := newTestListener()
 	// ConfirmationDepth = 3
@@ -275,6 +310,100 @@ func TestPollingListener_Reorg(t *testing.T) {
 	}
 }
 
+// addChain adds blocks from..to of a fork named prefix, linked by parent
+// hash and starting on parent.
+func (f *mockFetcher) addChain(prefix string, from, to uint64, parent string) {
+	for n := from; n <= to; n++ {
+		hash := fmt.Sprintf("%s%d", prefix, n)
+		f.addBlock(&BlockData{Number: n, Hash: hash, ParentHash: parent})
+		parent = hash
+	}
+}
+
+func TestPollingListener_ReorgWalkBack(t *testing.T) {
+	l, _, f := newTestListener()
+	l.cfg.ConfirmationDepth = 6
+	l.cfg.MaxReorgDepth = 6
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	f.addChain("a", 1, 5, "a0")
+	f.blocks[4].Txs = []BlockTx{{Hash: "tx-a4", From: "0xsender", To: "0xaddr", Amount: big.NewInt(1)}}
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	drainEvents(l)
+
+	// Blocks 4 and 5 are replaced by a longer fork; block 6 builds on it.
+	f.addChain("b", 4, 6, "a3")
+	f.blocks[5].Txs = []BlockTx{{Hash: "tx-b5", From: "0xsender", To: "0xaddr", Amount: big.NewInt(2)}}
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := drainEvents(l)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if ev := events[0]; ev.TxHash != "tx-a4" || !ev.Reorged {
+		t.Errorf("expected tx-a4 reorged, got %+v", ev)
+	}
+	if ev := events[1]; ev.TxHash != "tx-b5" || ev.Reorged || ev.BlockNumber != 5 {
+		t.Errorf("expected tx-b5 from the new branch, got %+v", ev)
+	}
+	if l.lastBlock != 6 {
+		t.Errorf("lastBlock = %d, want 6", l.lastBlock)
+	}
+	for n, want := range map[uint64]string{3: "a3", 4: "b4", 5: "b5", 6: "b6"} {
+		if got := l.blockHashes[n]; got != want {
+			t.Errorf("block %d hash = %q, want %q", n, got, want)
+		}
+	}
+	if _, ok := l.pendingEvents[4]; ok {
+		t.Error("orphaned pending events must be dropped")
+	}
+}
+
+func TestPollingListener_ReorgTooDeep(t *testing.T) {
+	l, _, f := newTestListener()
+	l.cfg.MaxReorgDepth = 2
+	ctx := context.Background()
+
+	f.addChain("a", 1, 4, "a0")
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fork from block 1 orphans three tracked blocks.
+	f.addChain("b", 2, 5, "a1")
+	for i := 0; i < 2; i++ {
+		if err := l.poll(ctx); !errors.Is(err, ErrReorgTooDeep) {
+			t.Fatalf("poll %d: err = %v, want ErrReorgTooDeep", i, err)
+		}
+	}
+	events := drainEvents(l)
+	if len(events) != 1 {
+		t.Fatalf("expected a single alert, got %+v", events)
+	}
+	if ev := events[0]; ev.Alert != models.AlertDeepReorg || !ev.Reorged || ev.BlockNumber != 5 {
+		t.Errorf("alert = %+v", ev)
+	}
+	if l.lastBlock != 4 || l.blockHashes[4] != "a4" {
+		t.Errorf("tracker moved past the fork: lastBlock %d, hash %q", l.lastBlock, l.blockHashes[4])
+	}
+
+	// The tracked branch wins after all: processing resumes.
+	f.addChain("a", 2, 5, "a1")
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if l.lastBlock != 5 {
+		t.Errorf("lastBlock = %d, want 5", l.lastBlock)
+	}
+}
+
 func TestManager_RegisterAndWatchAddress(t *testing.T) {
 	handler := func(event models.BlockEvent) error { return nil }
 	mgr := NewManager(handler)
@@ -343,3 +472,208 @@ func TestManager_UnknownNetwork(t *testing.T) {
 		t.Error("expected error for unregistered network")
 	}
 }
+
+// transferLog builds a Transfer(from, to, amount) log with 20-byte hex addresses.
+func transferLog(index uint, contract, fromHex, toHex string, amount int64) Log {
+	word := func(addr string) string { return "0x000000000000000000000000" + addr }
+	data := make([]byte, 32)
+	big.NewInt(amount).FillBytes(data)
+	return Log{
+		Index:   index,
+		Address: contract,
+		Topics:  []string{"0x" + token.TransferEventTopic, word(fromHex), word(toHex)},
+		Data:    data,
+	}
+}
+
+// drainEvents returns the events already queued on the listener.
+func drainEvents(l BlockListener) []models.BlockEvent {
+	var events []models.BlockEvent
+	for {
+		select {
+		case ev := <-l.Events():
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func TestPollingListener_TokenTransfer(t *testing.T) {
+	ws := storage.NewMemoryWatchStore()
+	f := newMockFetcher()
+	l := NewPollingListener(models.NetworkETH, time.Hour, ws, f, PollingConfig{
+		ConfirmationDepth: 3,
+		Tokens:            token.DefaultRegistry(),
+	})
+
+	const watched = "0x3535353535353535353535353535353535353535"
+	if err := l.WatchAddress(watched); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := "9858effd232b4033e47d90003d41ec34ecaeda94"
+	usdt := "0xdAC17F958D2ee523a2206206994597C13D831ec7" // checksum case, as some nodes return
+	approval := Log{Index: 3, Address: usdt, Topics: []string{
+		"0x8c5be1e5ebec7d5bd14f71427e41e3b5fe2e4ec5215b5bb16a1c4f5ebcfc4b8d", "0x00", "0x00",
+	}}
+	f.addBlock(&BlockData{
+		Number: 1, Hash: "h1",
+		Txs: []BlockTx{{
+			Hash: "tx-usdt", From: "0x" + sender, To: usdt, Amount: big.NewInt(0),
+			Logs: []Log{
+				transferLog(2, usdt, sender, watched[2:], 5_000_000),
+				approval,
+			},
+		}, {
+			// An unregistered contract emitting a Transfer to us must be ignored.
+			Hash: "tx-fake", From: "0x" + sender, To: "0x1111111111111111111111111111111111111111", Amount: big.NewInt(0),
+			Logs: []Log{transferLog(4, "0x1111111111111111111111111111111111111111", sender, watched[2:], 1)},
+		}},
+	})
+
+	ctx := context.Background()
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := drainEvents(l)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 token event, got %+v", events)
+	}
+	ev := events[0]
+	if !ev.IsToken() || ev.TokenSymbol != "USDT" || ev.TokenContract != token.USDTEthereum.Contract {
+		t.Errorf("token fields = %q %q", ev.TokenSymbol, ev.TokenContract)
+	}
+	if ev.To != watched || ev.From != "0x"+sender || ev.Amount.Int64() != 5_000_000 {
+		t.Errorf("transfer = %s -> %s %v", ev.From, ev.To, ev.Amount)
+	}
+	if ev.LogIndex != 2 || ev.TxHash != "tx-usdt" || ev.Confirmed {
+		t.Errorf("log index = %d, tx = %s, confirmed = %v", ev.LogIndex, ev.TxHash, ev.Confirmed)
+	}
+
+	// Token events are invalidated by a reorg like native ones.
+	f.addBlock(&BlockData{Number: 1, Hash: "h1-reorged"})
+	l.lastBlock = 0
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	events = drainEvents(l)
+	if len(events) != 1 || !events[0].Reorged || events[0].LogIndex != 2 || events[0].TokenSymbol != "USDT" {
+		t.Fatalf("expected reorged USDT event, got %+v", events)
+	}
+}
+
+func TestPollingListener_TokenConfirmationTRX(t *testing.T) {
+	ws := storage.NewMemoryWatchStore()
+	f := newMockFetcher()
+	l := NewPollingListener(models.NetworkTRX, time.Hour, ws, f, PollingConfig{
+		ConfirmationDepth: 2,
+		Tokens:            token.DefaultRegistry(),
+	})
+
+	// TRON addresses in events are Base58Check, matching wallet.TRXGenerator output.
+	const watched = "TUEZSdKsoDHQMeZwihtdoBiN46zxhGWYdH"
+	if err := l.WatchAddress(watched); err != nil {
+		t.Fatal(err)
+	}
+	f.addBlock(&BlockData{
+		Number: 1, Hash: "h1",
+		Txs: []BlockTx{{
+			Hash: "trc20", From: "TSeJkUh4Qv67VNFwY8LaAxERygNdy6NQZK", To: token.USDTTron.Contract,
+			Logs: []Log{transferLog(0, token.USDTTron.Contract,
+				"b6e708a39781c96bd399c7657780ff9fe9f052a8", "c8599111f29c1e1e061265b4af93ea1f274ad78a", 42)},
+		}},
+	})
+	f.addBlock(&BlockData{Number: 3, Hash: "h3"})
+
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	events := drainEvents(l)
+	if len(events) != 2 {
+		t.Fatalf("expected detected + confirmed events, got %+v", events)
+	}
+	if events[0].To != watched || events[0].From != "TSeJkUh4Qv67VNFwY8LaAxERygNdy6NQZK" {
+		t.Errorf("transfer = %s -> %s", events[0].From, events[0].To)
+	}
+	if !events[1].Confirmed || events[1].TokenSymbol != "USDT" || events[1].Amount.Int64() != 42 {
+		t.Errorf("confirmed event = %+v", events[1])
+	}
+}
+
+func TestPollingListener_CheckpointResume(t *testing.T) {
+	checkpoints := storage.NewMemoryCheckpointStore()
+	f := newMockFetcher()
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "tx1", From: "0xsender", To: "0xaddr", Amount: big.NewInt(100)},
+	}})
+	f.addBlock(&BlockData{Number: 2, Hash: "h2"})
+	cfg := PollingConfig{ConfirmationDepth: 3, Checkpoints: checkpoints}
+
+	first := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), f, cfg)
+	if err := first.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if events := drainEvents(first); len(events) != 1 || events[0].Confirmed {
+		t.Fatalf("first run events = %+v", events)
+	}
+
+	// A restarted listener resumes after block 2; StartBlock only applies
+	// without a checkpoint.
+	cfg.StartBlock = 100
+	second := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), f, cfg)
+	if err := second.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if second.lastBlock != 2 || second.blockHashes[1] != "h1" || len(second.pendingEvents[1]) != 1 {
+		t.Fatalf("restored lastBlock=%d hashes=%v pending=%v", second.lastBlock, second.blockHashes, second.pendingEvents)
+	}
+
+	// Block 1 is not rescanned; its pending event confirms at depth 3.
+	f.addBlock(&BlockData{Number: 3, Hash: "h3"})
+	f.addBlock(&BlockData{Number: 4, Hash: "h4"})
+	if err := second.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	events := drainEvents(second)
+	if len(events) != 1 || events[0].TxHash != "tx1" || !events[0].Confirmed {
+		t.Fatalf("second run events = %+v, want only tx1 confirmed", events)
+	}
+
+	cp, err := checkpoints.Load(models.NetworkETH)
+	if err != nil || cp == nil {
+		t.Fatalf("checkpoint = %v, %v", cp, err)
+	}
+	if cp.LastBlock != 4 || len(cp.PendingEvents) != 0 {
+		t.Errorf("checkpoint after confirmation = block %d, pending %v", cp.LastBlock, cp.PendingEvents)
+	}
+}
+
+func TestPollingListener_StartBlock(t *testing.T) {
+	f := newMockFetcher()
+	f.addBlock(&BlockData{Number: 6, Hash: "h6"})
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), f, PollingConfig{
+		ConfirmationDepth: 10,
+		StartBlock:        5,
+		Checkpoints:       storage.NewMemoryCheckpointStore(), // empty
+	})
+	if err := l.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.blockHashes[4]; ok {
+		t.Error("block 4 is before StartBlock and should not be processed")
+	}
+	if _, ok := l.blockHashes[5]; !ok || l.lastBlock != 6 {
+		t.Errorf("processed up to %d, hashes %v", l.lastBlock, l.blockHashes)
+	}
+}
@@ -0,0 +1,155 @@
+package listener
+
+import (
+	"context"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// mempoolTx is a watched pending transaction: the Pending events emitted for
+// it and its conflict keys.
+type mempoolTx struct {
+	events    []models.BlockEvent
+	conflicts []string
+}
+
+// scanMempool emits Pending events for watched transactions that appeared in
+// the mempool since the last scan. It returns the tracked transactions that
+// are no longer there, mapped to the transaction that replaced them, if any.
+// Mempool errors are logged and do not hold up block processing.
+func (t *blockTracker) scanMempool(ctx context.Context) map[string]string {
+	mf, ok := t.fetcher.(MempoolFetcher)
+	if !t.cfg.WatchMempool || !ok {
+		return nil
+	}
+	txs, err := mf.PendingTxs(ctx)
+	if err != nil {
+		t.logger.Warn("read mempool failed", "error", err)
+		return nil
+	}
+	addrSet, err := t.watchedSet()
+	if err != nil {
+		t.logger.Warn("read mempool failed", "error", err)
+		return nil
+	}
+
+	present := make(map[string][]string, len(txs)) // tx hash -> conflict keys
+	holders := make(map[string]string)             // conflict key -> tx hash
+	for _, tx := range txs {
+		present[tx.Hash] = tx.Conflicts
+		for _, key := range tx.Conflicts {
+			holders[key] = tx.Hash
+		}
+	}
+
+	left := make(map[string]string)
+	for hash, entry := range t.mempool {
+		if _, ok := present[hash]; ok {
+			continue
+		}
+		left[hash] = ""
+		for _, key := range entry.conflicts {
+			if holder, ok := holders[key]; ok && holder != hash {
+				left[hash] = holder
+			}
+		}
+	}
+
+	// Events are deduplicated per transaction: a BTC transaction paying two
+	// watched outputs yields two events in its first scan and none after.
+	seen := make(map[string]bool, len(t.mempool))
+	for hash := range t.mempool {
+		seen[hash] = true
+	}
+	for _, ev := range t.matchBlock(&BlockData{Txs: txs}, addrSet) {
+		if seen[ev.TxHash] {
+			continue
+		}
+		ev.Pending = true
+		entry, ok := t.mempool[ev.TxHash]
+		if !ok {
+			entry = &mempoolTx{conflicts: present[ev.TxHash]}
+			t.mempool[ev.TxHash] = entry
+		}
+		entry.events = append(entry.events, ev)
+
+		t.logger.Info("detected pending transaction",
+			"tx", ev.TxHash,
+			"to", ev.To,
+			"token", ev.TokenSymbol,
+		)
+		if err := t.emit(ctx, ev); err != nil {
+			// Forget the transaction, so the next scan emits all its events.
+			delete(t.mempool, ev.TxHash)
+			if ctx.Err() == nil {
+				t.logger.Warn("emit pending event failed", "tx", ev.TxHash, "error", err)
+			}
+			return nil
+		}
+	}
+	return left
+}
+
+// dropPending reports the transactions in left that were not mined in the
+// meantime as dropped, or replaced by the given transaction.
+func (t *blockTracker) dropPending(ctx context.Context, left map[string]string) error {
+	for hash, replacedBy := range left {
+		if _, ok := t.mempool[hash]; ok {
+			if err := t.dropMempoolTx(ctx, hash, replacedBy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// linkMined removes mined transactions from the pending set; their regular
+// events carry the same tx hash. Pending transactions whose conflict key is
+// taken by a mined transaction are reported as replaced.
+func (t *blockTracker) linkMined(ctx context.Context, block *BlockData) error {
+	if len(t.mempool) == 0 {
+		return nil
+	}
+	holders := make(map[string]string) // conflict key -> pending tx hash
+	for hash, entry := range t.mempool {
+		for _, key := range entry.conflicts {
+			holders[key] = hash
+		}
+	}
+	for _, tx := range block.Txs {
+		if _, ok := t.mempool[tx.Hash]; ok {
+			delete(t.mempool, tx.Hash)
+			continue
+		}
+		for _, key := range tx.Conflicts {
+			if hash, ok := holders[key]; ok {
+				if err := t.dropMempoolTx(ctx, hash, tx.Hash); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// dropMempoolTx re-emits the Pending events of hash as dropped. The
+// transaction stays tracked until all its events are emitted.
+func (t *blockTracker) dropMempoolTx(ctx context.Context, hash, replacedBy string) error {
+	entry, ok := t.mempool[hash]
+	if !ok {
+		return nil
+	}
+	t.logger.Warn("pending transaction dropped",
+		"tx", hash,
+		"replaced_by", replacedBy,
+	)
+	for _, ev := range entry.events {
+		ev.Dropped = true
+		ev.ReplacedBy = replacedBy
+		if err := t.emit(ctx, ev); err != nil {
+			return err
+		}
+	}
+	delete(t.mempool, hash)
+	return nil
+}
@@ -0,0 +1,130 @@
+package listener
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// mempoolMock adds a settable mempool to mockFetcher.
+type mempoolMock struct {
+	*mockFetcher
+	mu      sync.Mutex
+	pending []BlockTx
+}
+
+func (f *mempoolMock) PendingTxs(ctx context.Context) ([]BlockTx, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]BlockTx(nil), f.pending...), nil
+}
+
+func (f *mempoolMock) setPending(txs ...BlockTx) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = txs
+}
+
+func newMempoolListener(t *testing.T) (*PollingListener, *mempoolMock) {
+	t.Helper()
+	f := &mempoolMock{mockFetcher: newMockFetcher()}
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), f, PollingConfig{
+		ConfirmationDepth: 3,
+		WatchMempool:      true,
+	})
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	return l, f
+}
+
+func deposit(hash, conflict string) BlockTx {
+	return BlockTx{Hash: hash, From: "0xsender", To: "0xaddr", Amount: big.NewInt(1), Conflicts: []string{conflict}}
+}
+
+func TestPollingListener_MempoolMined(t *testing.T) {
+	l, f := newMempoolListener(t)
+	ctx := context.Background()
+
+	f.setPending(deposit("tx1", "0xsender/1"))
+	for i := 0; i < 2; i++ {
+		if err := l.poll(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events := drainEvents(l)
+	if len(events) != 1 || !events[0].Pending || events[0].TxHash != "tx1" || events[0].BlockNumber != 0 {
+		t.Fatalf("expected one pending event, got %+v", events)
+	}
+
+	// Mined: the regular event follows and nothing is reported dropped.
+	f.setPending()
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{deposit("tx1", "0xsender/1")}})
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	events = drainEvents(l)
+	if len(events) != 1 || events[0].Pending || events[0].Dropped || events[0].TxHash != "tx1" || events[0].BlockNumber != 1 {
+		t.Errorf("expected the mined event only, got %+v", events)
+	}
+	if len(l.mempool) != 0 {
+		t.Errorf("mined tx still tracked: %v", l.mempool)
+	}
+}
+
+func TestPollingListener_MempoolDroppedAndReplaced(t *testing.T) {
+	l, f := newMempoolListener(t)
+	ctx := context.Background()
+
+	f.setPending(deposit("dropped", "0xsender/1"), deposit("bumped", "0xsender/2"), deposit("mined-over", "0xsender/3"))
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if events := drainEvents(l); len(events) != 3 {
+		t.Fatalf("expected 3 pending events, got %+v", events)
+	}
+
+	// "bumped" is replaced in the mempool by a fee bump paying someone else,
+	// "mined-over" by a mined tx with the same nonce, "dropped" just leaves.
+	f.setPending(BlockTx{Hash: "bump", From: "0xsender", To: "0xother", Amount: big.NewInt(1), Conflicts: []string{"0xsender/2"}})
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "cancel", From: "0xsender", To: "0xsender", Amount: big.NewInt(0), Conflicts: []string{"0xsender/3"}},
+	}})
+	if err := l.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	replacedBy := make(map[string]string)
+	for _, ev := range drainEvents(l) {
+		if !ev.Pending || !ev.Dropped {
+			t.Errorf("unexpected event %+v", ev)
+		}
+		replacedBy[ev.TxHash] = ev.ReplacedBy
+	}
+	want := map[string]string{"dropped": "", "bumped": "bump", "mined-over": "cancel"}
+	if len(replacedBy) != len(want) {
+		t.Fatalf("dropped = %v, want %v", replacedBy, want)
+	}
+	for hash, by := range want {
+		if got, ok := replacedBy[hash]; !ok || got != by {
+			t.Errorf("%s replaced by %q, want %q", hash, got, by)
+		}
+	}
+	if len(l.mempool) != 0 {
+		t.Errorf("dropped txs still tracked: %v", l.mempool)
+	}
+}
+
+func TestPollingListener_MempoolUnsupported(t *testing.T) {
+	l := NewPollingListener(models.NetworkETH, time.Hour, storage.NewMemoryWatchStore(), newMockFetcher(), PollingConfig{
+		WatchMempool: true,
+	})
+	if err := l.Start(context.Background()); err == nil {
+		t.Fatal("expected Start to reject a fetcher without a mempool")
+	}
+}
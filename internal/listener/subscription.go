@@ -0,0 +1,251 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+	"github.com/gorilla/websocket"
+)
+
+// SubscriptionConfig holds configuration for the subscription listener.
+type SubscriptionConfig struct {
+	PollingConfig
+	// Endpoint is the node WebSocket URL, e.g. ws://localhost:8546.
+	Endpoint string
+	// FallbackInterval is the polling interval used while the socket is down (default 1s).
+	FallbackInterval time.Duration
+	// MinBackoff and MaxBackoff bound the delay between reconnect attempts,
+	// which doubles after each failure (defaults 1s and 30s).
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// HeadTimeout is how long the socket may stay silent before it is treated
+	// as dead and reconnected (default 60s, five ETH slots).
+	HeadTimeout time.Duration
+}
+
+// SubscriptionListener implements BlockListener with an eth_subscribe
+// newHeads WebSocket subscription. Each head triggers a fetch of the full
+// blocks through the BlockFetcher, and reorgs and confirmations are handled
+// exactly as in PollingListener.
+//
+// When the socket drops the listener reconnects with exponential backoff and
+// polls the fetcher in the meantime, so no block is missed while it is down.
+type SubscriptionListener struct {
+	blockTracker
+	sub    SubscriptionConfig
+	dialer *websocket.Dialer
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSubscriptionListener creates a WebSocket-driven block listener for the given network.
+func NewSubscriptionListener(network models.Network, ws storage.WatchStore, fetcher BlockFetcher, cfg SubscriptionConfig) *SubscriptionListener {
+	if cfg.FallbackInterval == 0 {
+		cfg.FallbackInterval = 1 * time.Second
+	}
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = 1 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.HeadTimeout == 0 {
+		cfg.HeadTimeout = 60 * time.Second
+	}
+	return &SubscriptionListener{
+		blockTracker: newBlockTracker(network, ws, fetcher, cfg.PollingConfig),
+		sub:          cfg,
+		dialer:       websocket.DefaultDialer,
+		done:         make(chan struct{}),
+	}
+}
+
+// Start connects to the node and begins following new heads.
+func (l *SubscriptionListener) Start(ctx context.Context) error {
+	if err := l.validate(); err != nil {
+		return err
+	}
+	if err := l.restore(); err != nil {
+		return err
+	}
+	ctx, l.cancel = context.WithCancel(ctx)
+
+	l.logger.Info("starting subscription listener",
+		"endpoint", l.sub.Endpoint,
+		"confirmation_depth", l.cfg.ConfirmationDepth,
+	)
+
+	go l.run(ctx)
+	return nil
+}
+
+// Stop closes the subscription and the events channel.
+func (l *SubscriptionListener) Stop() error {
+	if l.cancel != nil {
+		l.cancel()
+	}
+	<-l.done // wait for run to exit
+	close(l.events)
+	l.logger.Info("listener stopped")
+	return nil
+}
+
+// run alternates between the subscription and polling fallback until ctx ends.
+func (l *SubscriptionListener) run(ctx context.Context) {
+	defer close(l.done)
+	backoff := l.sub.MinBackoff
+
+	for {
+		subscribed, err := l.subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if subscribed {
+			backoff = l.sub.MinBackoff
+		}
+		l.logger.Warn("subscription down, polling until reconnect",
+			"error", err,
+			"retry_in", backoff,
+		)
+		if !l.pollFor(ctx, backoff) {
+			return
+		}
+		backoff = min(backoff*2, l.sub.MaxBackoff)
+	}
+}
+
+// pollFor polls the fetcher every FallbackInterval for d, starting at once.
+// It returns false if ctx was cancelled.
+func (l *SubscriptionListener) pollFor(ctx context.Context, d time.Duration) bool {
+	deadline := time.NewTimer(d)
+	defer deadline.Stop()
+	ticker := time.NewTicker(l.sub.FallbackInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.poll(ctx); err != nil && ctx.Err() == nil {
+			l.logger.Error("fallback poll failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			return true
+		case <-ticker.C:
+		}
+	}
+}
+
+// subscribe dials the node, subscribes to newHeads and processes heads until
+// the connection fails. subscribed reports whether the subscription was
+// established, which resets the reconnect backoff.
+func (l *SubscriptionListener) subscribe(ctx context.Context) (subscribed bool, err error) {
+	conn, _, err := l.dialer.DialContext(ctx, l.sub.Endpoint, nil)
+	if err != nil {
+		return false, fmt.Errorf("dial: %w", err)
+	}
+	defer conn.Close()
+
+	// Unblock ReadJSON when the listener stops.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	req := rpcRequest{JSONRPC: "2.0", ID: 1, Method: "eth_subscribe", Params: []any{"newHeads"}}
+	if err := conn.WriteJSON(req); err != nil {
+		return false, fmt.Errorf("subscribe: %w", err)
+	}
+	var ack rpcResponse
+	if err := l.read(conn, &ack); err != nil {
+		return false, fmt.Errorf("subscribe: %w", err)
+	}
+	if ack.Error != nil {
+		return false, fmt.Errorf("subscribe: %w", ack.Error)
+	}
+	var subID string
+	if err := json.Unmarshal(ack.Result, &subID); err != nil || subID == "" {
+		return false, fmt.Errorf("subscribe: invalid subscription id %s", ack.Result)
+	}
+	l.logger.Info("subscribed to new heads", "subscription", subID)
+
+	// Catch up on blocks produced while disconnected.
+	if err := l.poll(ctx); err != nil {
+		return true, fmt.Errorf("catch up: %w", err)
+	}
+
+	for {
+		var msg subscriptionMessage
+		if err := l.read(conn, &msg); err != nil {
+			return true, err
+		}
+		if msg.Method != "eth_subscription" || msg.Params.Subscription != subID {
+			continue
+		}
+		if err := l.handleHead(ctx, msg.Params.Result); err != nil {
+			return true, fmt.Errorf("head %d: %w", uint64(msg.Params.Result.Number), err)
+		}
+	}
+}
+
+// read decodes the next message, failing if none arrives within HeadTimeout.
+func (l *SubscriptionListener) read(conn *websocket.Conn, v any) error {
+	if err := conn.SetReadDeadline(time.Now().Add(l.sub.HeadTimeout)); err != nil {
+		return err
+	}
+	if err := conn.ReadJSON(v); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	return nil
+}
+
+// handleHead advances to a new head. A head at or below the last processed
+// block with a different hash replaced the tip: rewinding makes processBlock
+// see the hash mismatch and roll the old events back.
+//
+// With WatchMempool each head also scans the mempool, as poll does. The head
+// is then re-read from the fetcher: a transaction that left the mempool after
+// the notification may be in a newer block, and must not be reported dropped.
+func (l *SubscriptionListener) handleHead(ctx context.Context, head subscriptionHead) error {
+	number := uint64(head.Number)
+	if known, ok := l.blockHashes[number]; ok && number <= l.lastBlock && !strings.EqualFold(known, head.Hash) {
+		l.lastBlock = number - 1
+	}
+	if !l.cfg.WatchMempool {
+		return l.advance(ctx, number)
+	}
+
+	left := l.scanMempool(ctx)
+	latest, err := l.fetcher.LatestBlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("latest block: %w", err)
+	}
+	if err := l.advance(ctx, max(number, latest)); err != nil {
+		return err
+	}
+	return l.dropPending(ctx, left)
+}
+
+// subscriptionMessage is an eth_subscription notification.
+type subscriptionMessage struct {
+	Method string `json:"method"`
+	Params struct {
+		Subscription string           `json:"subscription"`
+		Result       subscriptionHead `json:"result"`
+	} `json:"params"`
+}
+
+type subscriptionHead struct {
+	Number hexUint64 `json:"number"`
+	Hash   string    `json:"hash"`
+}
@@ -0,0 +1,334 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+	"github.com/gorilla/websocket"
+)
+
+// fakeWSNode is a local stand-in for a node's WebSocket endpoint. It answers
+// eth_subscribe("newHeads") and pushes the heads sent on its channel to the
+// current connection.
+type fakeWSNode struct {
+	*httptest.Server
+	heads  chan subscriptionHead
+	drop   chan struct{}
+	closed chan struct{}
+
+	mu          sync.Mutex
+	refuse      bool
+	connections int
+}
+
+func newFakeWSNode(t *testing.T) *fakeWSNode {
+	t.Helper()
+	n := &fakeWSNode{
+		heads:  make(chan subscriptionHead),
+		drop:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	upgrader := websocket.Upgrader{}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		refuse := n.refuse
+		n.mu.Unlock()
+		if refuse {
+			http.Error(w, "node unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var req rpcRequest
+		if err := conn.ReadJSON(&req); err != nil || req.Method != "eth_subscribe" {
+			return
+		}
+		n.mu.Lock()
+		n.connections++
+		subID := fmt.Sprintf("0xsub%d", n.connections)
+		n.mu.Unlock()
+		if err := conn.WriteJSON(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": subID}); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case head := <-n.heads:
+				err := conn.WriteJSON(map[string]any{
+					"jsonrpc": "2.0",
+					"method":  "eth_subscription",
+					"params": map[string]any{
+						"subscription": subID,
+						"result":       map[string]any{"number": encodeHexUint64(uint64(head.Number)), "hash": head.Hash},
+					},
+				})
+				if err != nil {
+					return
+				}
+			case <-n.drop:
+				return
+			case <-n.closed:
+				return
+			}
+		}
+	}))
+	t.Cleanup(func() {
+		close(n.closed)
+		n.Close()
+	})
+	return n
+}
+
+func (n *fakeWSNode) setRefuse(refuse bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.refuse = refuse
+}
+
+// waitConnections waits until want subscriptions have been established.
+func (n *fakeWSNode) waitConnections(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		n.mu.Lock()
+		got := n.connections
+		n.mu.Unlock()
+		if got >= want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d subscriptions", want)
+}
+
+func (n *fakeWSNode) sendHead(t *testing.T, number uint64, hash string) {
+	t.Helper()
+	select {
+	case n.heads <- subscriptionHead{Number: hexUint64(number), Hash: hash}:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out sending head")
+	}
+}
+
+func newTestSubscriptionListener(t *testing.T, node *fakeWSNode, cfg SubscriptionConfig) (*SubscriptionListener, *mockFetcher) {
+	t.Helper()
+	f := newMockFetcher()
+	cfg.Endpoint = "ws" + strings.TrimPrefix(node.URL, "http")
+	l := NewSubscriptionListener(models.NetworkETH, storage.NewMemoryWatchStore(), f, cfg)
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	return l, f
+}
+
+func nextEvent(t *testing.T, events <-chan models.BlockEvent) models.BlockEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return models.BlockEvent{}
+	}
+}
+
+func TestSubscriptionListener_Heads(t *testing.T) {
+	node := newFakeWSNode(t)
+	l, f := newTestSubscriptionListener(t, node, SubscriptionConfig{
+		PollingConfig:    PollingConfig{ConfirmationDepth: 2},
+		FallbackInterval: time.Hour, // heads only
+	})
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "tx1", From: "0xsender", To: "0xaddr", Amount: big.NewInt(100)},
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := l.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Block 1 already existed when the subscription started: caught up at once.
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx1" || ev.Confirmed {
+		t.Errorf("catch-up event = %+v", ev)
+	}
+
+	f.addBlock(&BlockData{Number: 2, Hash: "h2", Txs: []BlockTx{
+		{Hash: "tx2", From: "0xaddr", To: "0xother", Amount: big.NewInt(50)},
+	}})
+	node.sendHead(t, 2, "h2")
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx2" || ev.Confirmed {
+		t.Errorf("head event = %+v", ev)
+	}
+
+	f.addBlock(&BlockData{Number: 3, Hash: "h3"})
+	node.sendHead(t, 3, "h3")
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx1" || !ev.Confirmed {
+		t.Errorf("expected tx1 confirmed at depth 2, got %+v", ev)
+	}
+
+	if err := l.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-l.Events(); ok {
+		t.Error("events channel should be closed after Stop")
+	}
+}
+
+func TestSubscriptionListener_MempoolOnHeads(t *testing.T) {
+	node := newFakeWSNode(t)
+	f := &mempoolMock{mockFetcher: newMockFetcher()}
+	l := NewSubscriptionListener(models.NetworkETH, storage.NewMemoryWatchStore(), f, SubscriptionConfig{
+		PollingConfig:    PollingConfig{ConfirmationDepth: 3, WatchMempool: true},
+		Endpoint:         "ws" + strings.TrimPrefix(node.URL, "http"),
+		FallbackInterval: time.Hour, // heads only
+	})
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{deposit("tx1", "0xsender/1")}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := l.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Stop() }()
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx1" || ev.Pending {
+		t.Fatalf("catch-up event = %+v", ev)
+	}
+
+	// Only a head can report the new mempool tx: the fallback never polls.
+	f.setPending(deposit("tx2", "0xsender/2"))
+	f.addBlock(&BlockData{Number: 2, Hash: "h2"})
+	node.sendHead(t, 2, "h2")
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx2" || !ev.Pending || ev.Dropped {
+		t.Errorf("expected tx2 pending, got %+v", ev)
+	}
+
+	f.setPending()
+	f.addBlock(&BlockData{Number: 3, Hash: "h3"})
+	node.sendHead(t, 3, "h3")
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx2" || !ev.Dropped {
+		t.Errorf("expected tx2 dropped, got %+v", ev)
+	}
+}
+
+func TestSubscriptionListener_MempoolMinedAfterHead(t *testing.T) {
+	f := &mempoolMock{mockFetcher: newMockFetcher()}
+	l := NewSubscriptionListener(models.NetworkETH, storage.NewMemoryWatchStore(), f, SubscriptionConfig{
+		PollingConfig: PollingConfig{ConfirmationDepth: 3, WatchMempool: true},
+	})
+	if err := l.WatchAddress("0xaddr"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	f.setPending(deposit("tx1", "0xsender/1"))
+	f.addBlock(&BlockData{Number: 1, Hash: "h1"})
+	if err := l.handleHead(ctx, subscriptionHead{Number: 1, Hash: "h1"}); err != nil {
+		t.Fatal(err)
+	}
+	if events := drainEvents(l); len(events) != 1 || !events[0].Pending {
+		t.Fatalf("expected tx1 pending, got %+v", events)
+	}
+
+	// tx1 is mined in block 3 after the node announced head 2: it is
+	// reported mined, not dropped.
+	f.setPending()
+	f.addBlock(&BlockData{Number: 2, Hash: "h2"})
+	f.addBlock(&BlockData{Number: 3, Hash: "h3", Txs: []BlockTx{deposit("tx1", "0xsender/1")}})
+	if err := l.handleHead(ctx, subscriptionHead{Number: 2, Hash: "h2"}); err != nil {
+		t.Fatal(err)
+	}
+	events := drainEvents(l)
+	if len(events) != 1 || events[0].Pending || events[0].Dropped || events[0].BlockNumber != 3 {
+		t.Errorf("expected tx1 mined in block 3, got %+v", events)
+	}
+}
+
+func TestSubscriptionListener_ReconnectWithPollingFallback(t *testing.T) {
+	node := newFakeWSNode(t)
+	l, f := newTestSubscriptionListener(t, node, SubscriptionConfig{
+		PollingConfig:    PollingConfig{ConfirmationDepth: 10},
+		FallbackInterval: 10 * time.Millisecond,
+		MinBackoff:       50 * time.Millisecond,
+		MaxBackoff:       100 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := l.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	node.waitConnections(t, 1)
+
+	// The node goes away: blocks keep arriving through the polling fallback.
+	node.setRefuse(true)
+	node.drop <- struct{}{}
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "tx-polled", From: "0xsender", To: "0xaddr", Amount: big.NewInt(1)},
+	}})
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx-polled" {
+		t.Errorf("fallback event = %+v", ev)
+	}
+
+	// The node comes back: the listener resubscribes and follows heads again.
+	node.setRefuse(false)
+	node.waitConnections(t, 2)
+	f.addBlock(&BlockData{Number: 2, Hash: "h2", Txs: []BlockTx{
+		{Hash: "tx-head", From: "0xsender", To: "0xaddr", Amount: big.NewInt(2)},
+	}})
+	node.sendHead(t, 2, "h2")
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx-head" {
+		t.Errorf("event after reconnect = %+v", ev)
+	}
+
+	if err := l.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscriptionListener_ReorgedHead(t *testing.T) {
+	node := newFakeWSNode(t)
+	l, f := newTestSubscriptionListener(t, node, SubscriptionConfig{
+		PollingConfig:    PollingConfig{ConfirmationDepth: 3},
+		FallbackInterval: time.Hour,
+	})
+	f.addBlock(&BlockData{Number: 1, Hash: "h1", Txs: []BlockTx{
+		{Hash: "tx1", From: "0xsender", To: "0xaddr", Amount: big.NewInt(100)},
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := l.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx1" {
+		t.Fatalf("event = %+v", ev)
+	}
+
+	// A competing block replaces block 1 at the same height.
+	f.addBlock(&BlockData{Number: 1, Hash: "h1-reorged"})
+	node.sendHead(t, 1, "h1-reorged")
+	if ev := nextEvent(t, l.Events()); ev.TxHash != "tx1" || !ev.Reorged {
+		t.Errorf("expected tx1 reorged, got %+v", ev)
+	}
+
+	if err := l.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,365 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/token"
+	"github.com/OKaluzny/wallet-demo/internal/wallet"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// TRXFetcherConfig configures a TRXFetcher.
+type TRXFetcherConfig struct {
+	Endpoint string        // full-node HTTP API URL, e.g. http://localhost:8090
+	APIKey   string        // TRON-PRO-API-KEY header, required by TronGrid
+	Timeout  time.Duration // per-request timeout (default 10s)
+	// SolidityEndpoint serves /walletsolidity (solidified blocks); full nodes
+	// expose it on a separate port, e.g. :8091. Defaults to Endpoint.
+	SolidityEndpoint string
+	// HTTPClient overrides the default client (and Timeout) when set.
+	HTTPClient *http.Client
+}
+
+// TRXFetcher implements BlockFetcher over the TRON full-node HTTP API:
+// /wallet/getnowblock and /wallet/getblockbynum.
+//
+// Node addresses (hex 41...) are converted to the Base58Check T... form that
+// TRXGenerator produces. TransferContract becomes a native BlockTx in sun.
+// TRON blocks carry no receipts, so a successful TriggerSmartContract calling
+// transfer(to, amount) is reported as a BlockTx to the contract with the
+// Transfer log the token emits; PollingListener decodes it like an ERC-20 log.
+type TRXFetcher struct {
+	endpoint string
+	solidity string
+	apiKey   string
+	http     *http.Client
+
+	mu      sync.Mutex
+	mempool map[string][]BlockTx // txID -> transfers, for the last pending listing
+}
+
+// NewTRXFetcher returns a fetcher for the node at cfg.Endpoint.
+func NewTRXFetcher(cfg TRXFetcherConfig) *TRXFetcher {
+	client := cfg.HTTPClient
+	if client == nil {
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = defaultRPCTimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+	solidity := cfg.SolidityEndpoint
+	if solidity == "" {
+		solidity = cfg.Endpoint
+	}
+	return &TRXFetcher{
+		endpoint: strings.TrimSuffix(cfg.Endpoint, "/"),
+		solidity: strings.TrimSuffix(solidity, "/"),
+		apiKey:   cfg.APIKey,
+		http:     client,
+		mempool:  make(map[string][]BlockTx),
+	}
+}
+
+// LatestBlockNumber returns the number of the node's head block (getnowblock).
+func (f *TRXFetcher) LatestBlockNumber(ctx context.Context) (uint64, error) {
+	var block trxBlock
+	if err := f.post(ctx, "/wallet/getnowblock", nil, &block); err != nil {
+		return 0, err
+	}
+	if block.BlockID == "" {
+		return 0, fmt.Errorf("getnowblock: empty block")
+	}
+	return block.BlockHeader.RawData.Number, nil
+}
+
+// FinalizedBlockNumber returns the latest solidified block
+// (/walletsolidity/getnowblock). It implements FinalityFetcher.
+func (f *TRXFetcher) FinalizedBlockNumber(ctx context.Context, mode FinalityMode) (uint64, error) {
+	if mode != FinalitySolidified {
+		return 0, fmt.Errorf("unsupported finality mode %q", mode)
+	}
+	var block trxBlock
+	if err := f.postTo(ctx, f.solidity, "/walletsolidity/getnowblock", nil, &block); err != nil {
+		return 0, err
+	}
+	if block.BlockID == "" {
+		return 0, fmt.Errorf("getnowblock: empty solidified block")
+	}
+	return block.BlockHeader.RawData.Number, nil
+}
+
+// PendingTxs returns the transfers in the node's pending pool
+// (gettransactionlistfrompending). Transactions are fetched once, when they
+// first appear, and cached while they stay pending. TRON transactions carry
+// no nonce, so pending ones are never replaced, only dropped on expiry. It
+// implements MempoolFetcher.
+func (f *TRXFetcher) PendingTxs(ctx context.Context) ([]BlockTx, error) {
+	var list struct {
+		TxIDs []string `json:"txId"`
+	}
+	if err := f.post(ctx, "/wallet/gettransactionlistfrompending", nil, &list); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	mempool := make(map[string][]BlockTx, len(list.TxIDs))
+	var out []BlockTx
+	for _, txID := range list.TxIDs {
+		txs, ok := f.mempool[txID]
+		if !ok {
+			var tx trxTx
+			if err := f.post(ctx, "/wallet/gettransactionfrompending", map[string]any{"value": txID}, &tx); err != nil {
+				return nil, err
+			}
+			if tx.TxID == "" {
+				continue // left the pool since the listing
+			}
+			var logIndex uint
+			var err error
+			if txs, err = tx.blockTxs(&logIndex); err != nil {
+				return nil, err
+			}
+		}
+		mempool[txID] = txs
+		out = append(out, txs...)
+	}
+	f.mempool = mempool
+	return out, nil
+}
+
+// GetBlock returns the block with its TRX and TRC-20 transfers (getblockbynum).
+func (f *TRXFetcher) GetBlock(ctx context.Context, number uint64) (*BlockData, error) {
+	var block trxBlock
+	if err := f.post(ctx, "/wallet/getblockbynum", map[string]any{"num": number}, &block); err != nil {
+		return nil, err
+	}
+	if block.BlockID == "" {
+		return nil, fmt.Errorf("block %d not found", number) // the node answers {}
+	}
+	if block.BlockHeader.RawData.Number != number {
+		return nil, fmt.Errorf("requested block %d, node returned %d", number, block.BlockHeader.RawData.Number)
+	}
+	data, err := block.toBlockData()
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", number, err)
+	}
+	return data, nil
+}
+
+// post calls an HTTP API method. The API reports failures as a 200 response
+// with an "Error" field.
+func (f *TRXFetcher) post(ctx context.Context, path string, body any, result any) error {
+	return f.postTo(ctx, f.endpoint, path, body, result)
+}
+
+func (f *TRXFetcher) postTo(ctx context.Context, endpoint, path string, body any, result any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.apiKey != "" {
+		req.Header.Set("TRON-PRO-API-KEY", f.apiKey)
+	}
+
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: http status %s", path, resp.Status)
+	}
+
+	var apiErr struct {
+		Error string `json:"Error"`
+	}
+	if err := json.Unmarshal(raw, &apiErr); err == nil && apiErr.Error != "" {
+		return fmt.Errorf("%s: %s", path, apiErr.Error)
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("%s: decode response: %w", path, err)
+	}
+	return nil
+}
+
+// trxBlock is the block object returned by getnowblock and getblockbynum.
+type trxBlock struct {
+	BlockID     string `json:"blockID"`
+	BlockHeader struct {
+		RawData struct {
+			Number     uint64 `json:"number"`
+			ParentHash string `json:"parentHash"`
+		} `json:"raw_data"`
+	} `json:"block_header"`
+	Transactions []trxTx `json:"transactions"` // omitted for empty blocks
+}
+
+type trxTx struct {
+	TxID string `json:"txID"`
+	Ret  []struct {
+		ContractRet string `json:"contractRet"`
+	} `json:"ret"`
+	RawData struct {
+		Contract []trxContract `json:"contract"`
+	} `json:"raw_data"`
+}
+
+type trxContract struct {
+	Type      string `json:"type"`
+	Parameter struct {
+		Value json.RawMessage `json:"value"`
+	} `json:"parameter"`
+}
+
+// trxTransferContract is the TransferContract parameter; amount is in sun.
+type trxTransferContract struct {
+	OwnerAddress string `json:"owner_address"`
+	ToAddress    string `json:"to_address"`
+	Amount       int64  `json:"amount"`
+}
+
+// trxTriggerSmartContract is the TriggerSmartContract parameter.
+type trxTriggerSmartContract struct {
+	OwnerAddress    string `json:"owner_address"`
+	ContractAddress string `json:"contract_address"`
+	Data            string `json:"data"`
+	CallValue       int64  `json:"call_value"`
+}
+
+func (b *trxBlock) toBlockData() (*BlockData, error) {
+	data := &BlockData{
+		Number:     b.BlockHeader.RawData.Number,
+		Hash:       b.BlockID,
+		ParentHash: b.BlockHeader.RawData.ParentHash,
+		Txs:        make([]BlockTx, 0, len(b.Transactions)),
+	}
+	var logIndex uint
+	for _, tx := range b.Transactions {
+		txs, err := tx.blockTxs(&logIndex)
+		if err != nil {
+			return nil, err
+		}
+		data.Txs = append(data.Txs, txs...)
+	}
+	return data, nil
+}
+
+// blockTxs converts the transfers of a transaction, numbering synthesized
+// logs from *logIndex.
+func (tx *trxTx) blockTxs(logIndex *uint) ([]BlockTx, error) {
+	// A failed transaction moves no value (TRON txs hold a single contract).
+	if len(tx.Ret) > 0 && tx.Ret[0].ContractRet != "" && tx.Ret[0].ContractRet != "SUCCESS" {
+		return nil, nil
+	}
+	var out []BlockTx
+	for _, c := range tx.RawData.Contract {
+		switch c.Type {
+		case "TransferContract":
+			var p trxTransferContract
+			if err := json.Unmarshal(c.Parameter.Value, &p); err != nil {
+				return nil, fmt.Errorf("tx %s: %w", tx.TxID, err)
+			}
+			from, err := trxAddress(p.OwnerAddress)
+			if err != nil {
+				return nil, fmt.Errorf("tx %s owner: %w", tx.TxID, err)
+			}
+			to, err := trxAddress(p.ToAddress)
+			if err != nil {
+				return nil, fmt.Errorf("tx %s to: %w", tx.TxID, err)
+			}
+			out = append(out, BlockTx{
+				Hash:   tx.TxID,
+				From:   from,
+				To:     to,
+				Amount: big.NewInt(p.Amount),
+			})
+		case "TriggerSmartContract":
+			var p trxTriggerSmartContract
+			if err := json.Unmarshal(c.Parameter.Value, &p); err != nil {
+				return nil, fmt.Errorf("tx %s: %w", tx.TxID, err)
+			}
+			btx, ok, err := p.toBlockTx(tx.TxID, *logIndex)
+			if err != nil {
+				return nil, fmt.Errorf("tx %s: %w", tx.TxID, err)
+			}
+			if ok {
+				*logIndex += uint(len(btx.Logs))
+				out = append(out, btx)
+			}
+		}
+	}
+	return out, nil
+}
+
+// toBlockTx reports a contract call; transfer(to, amount) calls carry the
+// equivalent Transfer log. Other calls are kept only when they send TRX.
+func (p *trxTriggerSmartContract) toBlockTx(txID string, logIndex uint) (BlockTx, bool, error) {
+	from, err := trxAddress(p.OwnerAddress)
+	if err != nil {
+		return BlockTx{}, false, fmt.Errorf("owner: %w", err)
+	}
+	contract, err := trxAddress(p.ContractAddress)
+	if err != nil {
+		return BlockTx{}, false, fmt.Errorf("contract: %w", err)
+	}
+	btx := BlockTx{Hash: txID, From: from, To: contract, Amount: big.NewInt(p.CallValue)}
+
+	callData, err := hex.DecodeString(p.Data)
+	if err != nil {
+		return BlockTx{}, false, fmt.Errorf("invalid call data: %w", err)
+	}
+	if recipient, amount, err := token.DecodeTransfer(callData); err == nil {
+		owner, err := wallet.DecodeAccountAddress(models.NetworkTRX, from)
+		if err != nil {
+			return BlockTx{}, false, err
+		}
+		btx.Logs = []Log{{
+			Index:   logIndex,
+			Address: contract,
+			Topics:  []string{token.TransferEventTopic, addressTopic(owner), addressTopic(recipient)},
+			Data:    amount.FillBytes(make([]byte, 32)),
+		}}
+	}
+	if len(btx.Logs) == 0 && btx.Amount.Sign() == 0 {
+		return BlockTx{}, false, nil
+	}
+	return btx, true, nil
+}
+
+// trxAddress converts a node address (hex 41... or already Base58) to T... form.
+func trxAddress(addr string) (string, error) {
+	account, err := wallet.DecodeAccountAddress(models.NetworkTRX, addr)
+	if err != nil {
+		return "", err
+	}
+	return wallet.EncodeAccountAddress(models.NetworkTRX, account)
+}
+
+// addressTopic formats a 20-byte account as an indexed address topic.
+func addressTopic(account []byte) string {
+	return strings.Repeat("00", 12) + hex.EncodeToString(account)
+}
@@ -0,0 +1,259 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/internal/token"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// Fixture addresses in testdata/trx, in the T... form TRXGenerator produces.
+// The node serves them as hex 41c8599111... and 41b6e708a3....
+const (
+	trxTestFrom = "TUEZSdKsoDHQMeZwihtdoBiN46zxhGWYdH"
+	trxTestTo   = "TSeJkUh4Qv67VNFwY8LaAxERygNdy6NQZK"
+
+	trxTestPendingTx = "cd1634ef55b13679e59bae595cc026417dc9010738ea0a20ae3b694b54fa82fa"
+)
+
+// fakeTRONNode serves blocks 62000000..62000001 from testdata/trx fixtures;
+// the first of them is solidified. Its pending pool holds the USDT transfer
+// from block 62000000.
+type fakeTRONNode struct {
+	*httptest.Server
+	mu     sync.Mutex
+	apiKey string
+}
+
+func newFakeTRONNode(t *testing.T) *fakeTRONNode {
+	t.Helper()
+	fixture := func(number uint64) []byte {
+		b, err := os.ReadFile(filepath.Join("testdata", "trx", fmt.Sprintf("block_%d.json", number)))
+		if err != nil {
+			return []byte("{}") // unknown blocks are an empty object
+		}
+		return b
+	}
+
+	n := &fakeTRONNode{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wallet/getnowblock", func(w http.ResponseWriter, r *http.Request) {
+		n.record(r)
+		_, _ = w.Write(fixture(62_000_001))
+	})
+	mux.HandleFunc("/walletsolidity/getnowblock", func(w http.ResponseWriter, r *http.Request) {
+		n.record(r)
+		_, _ = w.Write(fixture(62_000_000))
+	})
+	mux.HandleFunc("/wallet/gettransactionlistfrompending", func(w http.ResponseWriter, r *http.Request) {
+		n.record(r)
+		_, _ = fmt.Fprintf(w, `{"txId":[%q]}`, trxTestPendingTx)
+	})
+	mux.HandleFunc("/wallet/gettransactionfrompending", func(w http.ResponseWriter, r *http.Request) {
+		n.record(r)
+		var req struct {
+			Value string `json:"value"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		var block struct {
+			Transactions []json.RawMessage `json:"transactions"`
+		}
+		_ = json.Unmarshal(fixture(62_000_000), &block)
+		for _, raw := range block.Transactions {
+			var tx trxTx
+			if _ = json.Unmarshal(raw, &tx); tx.TxID == req.Value {
+				_, _ = w.Write(raw)
+				return
+			}
+		}
+		_, _ = w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("/wallet/getblockbynum", func(w http.ResponseWriter, r *http.Request) {
+		n.record(r)
+		var req struct {
+			Num *uint64 `json:"num"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Num == nil {
+			_, _ = w.Write([]byte(`{"Error":"class java.lang.NullPointerException : null"}`))
+			return
+		}
+		_, _ = w.Write(fixture(*req.Num))
+	})
+	n.Server = httptest.NewServer(mux)
+	t.Cleanup(n.Close)
+	return n
+}
+
+func (n *fakeTRONNode) record(r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.apiKey = r.Header.Get("TRON-PRO-API-KEY")
+}
+
+func TestTRXFetcher_LatestBlockNumber(t *testing.T) {
+	node := newFakeTRONNode(t)
+	f := NewTRXFetcher(TRXFetcherConfig{Endpoint: node.URL + "/", APIKey: "test-key"})
+
+	n, err := f.LatestBlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 62_000_001 {
+		t.Errorf("latest = %d, want 62000001", n)
+	}
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if node.apiKey != "test-key" {
+		t.Errorf("api key header = %q", node.apiKey)
+	}
+}
+
+func TestTRXFetcher_FinalizedBlockNumber(t *testing.T) {
+	node := newFakeTRONNode(t)
+	f := NewTRXFetcher(TRXFetcherConfig{Endpoint: "http://127.0.0.1:1", SolidityEndpoint: node.URL})
+
+	n, err := f.FinalizedBlockNumber(context.Background(), FinalitySolidified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 62_000_000 {
+		t.Errorf("solidified block = %d, want 62000000", n)
+	}
+	if _, err := f.FinalizedBlockNumber(context.Background(), FinalityFinalized); err == nil {
+		t.Error("expected error for an ETH finality mode")
+	}
+}
+
+func TestTRXFetcher_GetBlock(t *testing.T) {
+	node := newFakeTRONNode(t)
+	f := NewTRXFetcher(TRXFetcherConfig{Endpoint: node.URL})
+
+	block, err := f.GetBlock(context.Background(), 62_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Number != 62_000_000 || block.Hash != "0000000003b20b80fac231b39a23dc4da786eff8147c4e72b9807785afee48bb" {
+		t.Errorf("block = %d %s", block.Number, block.Hash)
+	}
+	// The reverted call and the TRC-10 transfer are dropped.
+	if len(block.Txs) != 3 {
+		t.Fatalf("expected 3 txs, got %d", len(block.Txs))
+	}
+
+	native := block.Txs[0]
+	if native.Hash != "6a5cd181ce912ebb4c9f883d5044aa710511f87ce98e15d447006695531bb01b" ||
+		native.From != trxTestFrom || native.To != trxTestTo || native.Amount.Int64() != 2_500_000 {
+		t.Errorf("TransferContract = %+v", native)
+	}
+	if len(native.Logs) != 0 {
+		t.Errorf("native transfer should have no logs, got %d", len(native.Logs))
+	}
+
+	usdt := block.Txs[1]
+	if usdt.From != trxTestFrom || usdt.To != token.USDTTron.Contract || usdt.Amount.Sign() != 0 {
+		t.Errorf("TriggerSmartContract = %+v", usdt)
+	}
+	if len(usdt.Logs) != 1 {
+		t.Fatalf("expected a Transfer log on the USDT call, got %d", len(usdt.Logs))
+	}
+	from, to, amount, err := token.DecodeTransferEvent(usdt.Logs[0].Topics, usdt.Logs[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%x", from) != "c8599111f29c1e1e061265b4af93ea1f274ad78a" ||
+		fmt.Sprintf("%x", to) != "b6e708a39781c96bd399c7657780ff9fe9f052a8" || amount.Int64() != 10_000_000 {
+		t.Errorf("Transfer log = %x -> %x %v", from, to, amount)
+	}
+
+	if fake := block.Txs[2]; fake.Logs[0].Index != 1 {
+		t.Errorf("log index = %d, want 1", fake.Logs[0].Index)
+	}
+
+	empty, err := f.GetBlock(context.Background(), 62_000_001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty.Txs) != 0 {
+		t.Errorf("empty block has %d txs", len(empty.Txs))
+	}
+}
+
+func TestTRXFetcher_Errors(t *testing.T) {
+	node := newFakeTRONNode(t)
+	f := NewTRXFetcher(TRXFetcherConfig{Endpoint: node.URL})
+
+	if _, err := f.GetBlock(context.Background(), 62_000_002); err == nil {
+		t.Error("expected error for a block the node does not have")
+	}
+	var block trxBlock
+	if err := f.post(context.Background(), "/wallet/getblockbynum", nil, &block); err == nil {
+		t.Error("expected the API Error field to be returned")
+	}
+	if err := f.post(context.Background(), "/wallet/missing", nil, &block); err == nil {
+		t.Error("expected http status error")
+	}
+}
+
+func TestTRXFetcher_WithPollingListener(t *testing.T) {
+	node := newFakeTRONNode(t)
+	ws := storage.NewMemoryWatchStore()
+	l := NewPollingListener(models.NetworkTRX, 0, ws, NewTRXFetcher(TRXFetcherConfig{Endpoint: node.URL}), PollingConfig{
+		ConfirmationDepth: 1,
+		Tokens:            token.DefaultRegistry(),
+	})
+	l.lastBlock = 61_999_999
+	if err := l.WatchAddress(trxTestTo); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The transfer from the unregistered contract is ignored.
+	var native, usdt, confirmed int
+	for _, ev := range drainEvents(l) {
+		switch {
+		case ev.Confirmed:
+			confirmed++
+		case ev.TokenSymbol == "USDT":
+			usdt++
+			if ev.From != trxTestFrom || ev.To != trxTestTo || ev.Amount.Int64() != 10_000_000 {
+				t.Errorf("usdt event = %+v", ev)
+			}
+		default:
+			native++
+		}
+	}
+	if native != 1 || usdt != 1 {
+		t.Errorf("detected native=%d usdt=%d, want 1 each", native, usdt)
+	}
+	if confirmed != 2 {
+		t.Errorf("confirmed = %d, want 2", confirmed)
+	}
+}
+
+func TestTRXFetcher_PendingTxs(t *testing.T) {
+	node := newFakeTRONNode(t)
+	f := NewTRXFetcher(TRXFetcherConfig{Endpoint: node.URL})
+
+	txs, err := f.PendingTxs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 || txs[0].Hash != trxTestPendingTx || len(txs[0].Logs) != 1 {
+		t.Fatalf("pending = %+v", txs)
+	}
+	if _, to, amount, err := token.DecodeTransferEvent(txs[0].Logs[0].Topics, txs[0].Logs[0].Data); err != nil || amount.Int64() != 10_000_000 || len(to) != 20 {
+		t.Errorf("transfer log: to %x amount %v err %v", to, amount, err)
+	}
+}
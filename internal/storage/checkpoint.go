@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// FileCheckpointStore is a CheckpointStore keeping one JSON file per network
+// in a directory. Files are replaced atomically, so a crash during Save
+// leaves the previous checkpoint intact.
+type FileCheckpointStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileCheckpointStore returns a store writing to dir, creating it if needed.
+func NewFileCheckpointStore(dir string) (*FileCheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create checkpoint dir: %w", err)
+	}
+	return &FileCheckpointStore{dir: dir}, nil
+}
+
+func (s *FileCheckpointStore) path(network models.Network) string {
+	return filepath.Join(s.dir, "checkpoint-"+strings.ToLower(string(network))+".json")
+}
+
+// Load returns the checkpoint of network, or nil if none was saved.
+func (s *FileCheckpointStore) Load(network models.Network) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := os.ReadFile(s.path(network))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("decode checkpoint %s: %w", s.path(network), err)
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint of network to a temporary file and renames it
+// over the previous one.
+func (s *FileCheckpointStore) Save(network models.Network, cp Checkpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(s.path(network), b); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes b to a temporary file next to path, syncs it and
+// renames it over path.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+	s, err := NewFileCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cp, err := s.Load(models.NetworkETH); err != nil || cp != nil {
+		t.Fatalf("empty store Load = %v, %v", cp, err)
+	}
+
+	amount, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	want := Checkpoint{
+		LastBlock:   19_000_001,
+		BlockHashes: map[uint64]string{19_000_000: "0xaa", 19_000_001: "0xbb"},
+		PendingEvents: map[uint64][]models.BlockEvent{
+			19_000_000: {{Network: models.NetworkETH, BlockNumber: 19_000_000, TxHash: "0x01", To: "0xaddr", Amount: amount}},
+		},
+	}
+	if err := s.Save(models.NetworkETH, want); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new store over the same directory sees the checkpoint, as after a restart.
+	reopened, err := NewFileCheckpointStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Load(models.NetworkETH)
+	if err != nil || got == nil {
+		t.Fatalf("Load = %v, %v", got, err)
+	}
+	if got.LastBlock != want.LastBlock || got.BlockHashes[19_000_001] != "0xbb" {
+		t.Errorf("checkpoint = %+v", got)
+	}
+	ev := got.PendingEvents[19_000_000]
+	if len(ev) != 1 || ev[0].TxHash != "0x01" || ev[0].Amount.Cmp(amount) != 0 {
+		t.Errorf("pending events = %+v", ev)
+	}
+	if cp, _ := reopened.Load(models.NetworkBTC); cp != nil {
+		t.Error("checkpoints are per network")
+	}
+
+	want.LastBlock++
+	if err := s.Save(models.NetworkETH, want); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Load(models.NetworkETH); got.LastBlock != 19_000_002 {
+		t.Errorf("overwritten LastBlock = %d", got.LastBlock)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the checkpoint file, found %d entries", len(entries))
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "checkpoint-btc.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(models.NetworkBTC); err == nil {
+		t.Error("expected error for a corrupt checkpoint")
+	}
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/OKaluzny/wallet-demo/pkg/models"
@@ -29,7 +31,7 @@ func (s *MemoryNonceStore) GetAndIncrement(address string) (uint64, error) {
 // MemoryTxStore is an in-memory TxStore.
 type MemoryTxStore struct {
 	mu  sync.RWMutex
-	txs map[string]*models.Transaction
+	txs map[string]*models.Transaction // nil for reserved keys
 }
 
 // NewMemoryTxStore returns a new in-memory TxStore.
@@ -44,6 +46,27 @@ func (s *MemoryTxStore) Get(idempotencyKey string) (*models.Transaction, error)
 	return s.txs[idempotencyKey], nil
 }
 
+// Reserve claims an unused idempotency key.
+func (s *MemoryTxStore) Reserve(idempotencyKey string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.txs[idempotencyKey]; ok {
+		return false, nil
+	}
+	s.txs[idempotencyKey] = nil
+	return true, nil
+}
+
+// Release drops the reservation of a key without a stored transaction.
+func (s *MemoryTxStore) Release(idempotencyKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tx, ok := s.txs[idempotencyKey]; ok && tx == nil {
+		delete(s.txs, idempotencyKey)
+	}
+	return nil
+}
+
 // Put stores a transaction by idempotency key.
 func (s *MemoryTxStore) Put(idempotencyKey string, tx *models.Transaction) error {
 	s.mu.Lock()
@@ -96,3 +119,180 @@ func (s *MemoryWatchStore) Contains(address string) (bool, error) {
 	defer s.mu.RUnlock()
 	return s.addrs[address], nil
 }
+
+// MemoryUTXOStore is an in-memory UTXOStore.
+type MemoryUTXOStore struct {
+	mu    sync.Mutex
+	utxos map[string]map[string]models.UTXO // address -> "txid:vout" -> utxo
+}
+
+// NewMemoryUTXOStore returns a new in-memory UTXOStore.
+func NewMemoryUTXOStore() *MemoryUTXOStore {
+	return &MemoryUTXOStore{utxos: make(map[string]map[string]models.UTXO)}
+}
+
+// Add records an unspent output owned by address.
+func (s *MemoryUTXOStore) Add(address string, utxo models.UTXO) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.utxos[address] == nil {
+		s.utxos[address] = make(map[string]models.UTXO)
+	}
+	s.utxos[address][outpointKey(utxo)] = utxo
+	return nil
+}
+
+// List returns all unspent outputs owned by address.
+func (s *MemoryUTXOStore) List(address string) ([]models.UTXO, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]models.UTXO, 0, len(s.utxos[address]))
+	for _, u := range s.utxos[address] {
+		result = append(result, u)
+	}
+	return result, nil
+}
+
+// Spend atomically removes the given outputs, failing if any is no longer unspent.
+func (s *MemoryUTXOStore) Spend(address string, utxos []models.UTXO) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owned := s.utxos[address]
+	for _, u := range utxos {
+		if _, ok := owned[outpointKey(u)]; !ok {
+			return fmt.Errorf("utxo %s not unspent", outpointKey(u))
+		}
+	}
+	for _, u := range utxos {
+		delete(owned, outpointKey(u))
+	}
+	return nil
+}
+
+func outpointKey(u models.UTXO) string {
+	return fmt.Sprintf("%s:%d", u.TxID, u.Vout)
+}
+
+// MemoryCheckpointStore is an in-memory CheckpointStore. It keeps checkpoints
+// across listener restarts within one process; use FileCheckpointStore to
+// survive process restarts.
+type MemoryCheckpointStore struct {
+	mu          sync.RWMutex
+	checkpoints map[models.Network]Checkpoint
+}
+
+// NewMemoryCheckpointStore returns a new in-memory CheckpointStore.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{checkpoints: make(map[models.Network]Checkpoint)}
+}
+
+// Load returns a copy of the checkpoint of network, or nil if none was saved.
+func (s *MemoryCheckpointStore) Load(network models.Network) (*Checkpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cp, ok := s.checkpoints[network]
+	if !ok {
+		return nil, nil
+	}
+	cp = copyCheckpoint(cp)
+	return &cp, nil
+}
+
+// Save stores a copy of the checkpoint of network.
+func (s *MemoryCheckpointStore) Save(network models.Network, cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[network] = copyCheckpoint(cp)
+	return nil
+}
+
+// copyCheckpoint copies the maps and event slices so the caller may keep
+// mutating its own.
+func copyCheckpoint(cp Checkpoint) Checkpoint {
+	out := Checkpoint{
+		LastBlock:     cp.LastBlock,
+		BlockHashes:   make(map[uint64]string, len(cp.BlockHashes)),
+		PendingEvents: make(map[uint64][]models.BlockEvent, len(cp.PendingEvents)),
+	}
+	for n, h := range cp.BlockHashes {
+		out.BlockHashes[n] = h
+	}
+	for n, events := range cp.PendingEvents {
+		out.PendingEvents[n] = append([]models.BlockEvent(nil), events...)
+	}
+	return out
+}
+
+// MemoryOutboxStore is an in-memory OutboxStore. Undelivered events survive
+// handler failures but not a process restart; use FileOutboxStore for that.
+type MemoryOutboxStore struct {
+	mu      sync.Mutex
+	nextSeq uint64
+	entries map[string]OutboxEntry
+}
+
+// NewMemoryOutboxStore returns a new in-memory OutboxStore.
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{nextSeq: 1, entries: make(map[string]OutboxEntry)}
+}
+
+// Add appends an entry unless its event ID is already present.
+func (s *MemoryOutboxStore) Add(entry OutboxEntry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return addOutboxEntry(s.entries, &s.nextSeq, entry)
+}
+
+// Update replaces the entry with the same event ID.
+func (s *MemoryOutboxStore) Update(entry OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return updateOutboxEntry(s.entries, entry)
+}
+
+// Delete removes the entry with the given event ID.
+func (s *MemoryOutboxStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	return nil
+}
+
+// List returns all entries in Seq order.
+func (s *MemoryOutboxStore) List() ([]OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedOutboxEntries(s.entries), nil
+}
+
+func addOutboxEntry(entries map[string]OutboxEntry, nextSeq *uint64, entry OutboxEntry) (bool, error) {
+	if entry.Event.ID == "" {
+		return false, fmt.Errorf("outbox entry without event ID")
+	}
+	if _, ok := entries[entry.Event.ID]; ok {
+		return false, nil
+	}
+	entry.Seq = *nextSeq
+	*nextSeq++
+	entries[entry.Event.ID] = entry
+	return true, nil
+}
+
+func updateOutboxEntry(entries map[string]OutboxEntry, entry OutboxEntry) error {
+	stored, ok := entries[entry.Event.ID]
+	if !ok {
+		return fmt.Errorf("outbox entry %s not found", entry.Event.ID)
+	}
+	entry.Seq = stored.Seq
+	entries[entry.Event.ID] = entry
+	return nil
+}
+
+func sortedOutboxEntries(entries map[string]OutboxEntry) []OutboxEntry {
+	result := make([]OutboxEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Seq < result[j].Seq })
+	return result
+}
@@ -0,0 +1,30 @@
+-- Nonces of account-model addresses (ETH, TRX): next_nonce is the nonce the
+-- next transaction from address uses.
+CREATE TABLE nonces (
+    address    TEXT   NOT NULL PRIMARY KEY,
+    next_nonce BIGINT NOT NULL
+);
+
+-- Sent transactions by idempotency key. A send inserts the key before signing
+-- and fills in the transaction once broadcast; the unique constraint makes a
+-- second send under the same key fail even across processes. Rows without
+-- tx_hash are reservations of sends in progress.
+CREATE TABLE transactions (
+    idempotency_key TEXT      NOT NULL,
+    network         TEXT,
+    tx_hash         TEXT,
+    tx              TEXT,     -- models.Transaction as JSON
+    raw_signed      BYTEA,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT transactions_idempotency_key_unique UNIQUE (idempotency_key)
+);
+
+CREATE INDEX transactions_tx_hash_idx ON transactions (network, tx_hash);
+
+-- Watched addresses per listener network.
+CREATE TABLE watched_addresses (
+    network    TEXT      NOT NULL,
+    address    TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (network, address)
+);
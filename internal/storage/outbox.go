@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileOutboxStore is an OutboxStore kept in a single JSON file. Every change
+// rewrites the file atomically before it returns, so an event added to the
+// outbox survives a crash. The outbox only holds undelivered and
+// dead-lettered events, which keeps the file small.
+type FileOutboxStore struct {
+	mu      sync.Mutex
+	path    string
+	nextSeq uint64
+	entries map[string]OutboxEntry
+}
+
+// outboxFile is the on-disk form of a FileOutboxStore.
+type outboxFile struct {
+	NextSeq uint64        `json:"next_seq"`
+	Entries []OutboxEntry `json:"entries"`
+}
+
+// NewFileOutboxStore opens the outbox in dir, creating the directory if
+// needed and loading the entries left by a previous run.
+func NewFileOutboxStore(dir string) (*FileOutboxStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create outbox dir: %w", err)
+	}
+	s := &FileOutboxStore{
+		path:    filepath.Join(dir, "outbox.json"),
+		nextSeq: 1,
+		entries: make(map[string]OutboxEntry),
+	}
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read outbox: %w", err)
+	}
+	var f outboxFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("decode outbox %s: %w", s.path, err)
+	}
+	s.nextSeq = max(f.NextSeq, 1)
+	for _, e := range f.Entries {
+		s.entries[e.Event.ID] = e
+	}
+	return s, nil
+}
+
+// Add appends an entry unless its event ID is already present.
+func (s *FileOutboxStore) Add(entry OutboxEntry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nextSeq := s.nextSeq
+	added, err := addOutboxEntry(s.entries, &s.nextSeq, entry)
+	if err != nil || !added {
+		return added, err
+	}
+	if err := s.save(); err != nil {
+		delete(s.entries, entry.Event.ID)
+		s.nextSeq = nextSeq
+		return false, err
+	}
+	return true, nil
+}
+
+// Update replaces the entry with the same event ID.
+func (s *FileOutboxStore) Update(entry OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.entries[entry.Event.ID]
+	if err := updateOutboxEntry(s.entries, entry); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		s.entries[entry.Event.ID] = prev
+		return err
+	}
+	return nil
+}
+
+// Delete removes the entry with the given event ID.
+func (s *FileOutboxStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.entries[id]
+	if !ok {
+		return nil
+	}
+	delete(s.entries, id)
+	if err := s.save(); err != nil {
+		s.entries[id] = prev
+		return err
+	}
+	return nil
+}
+
+// List returns all entries in Seq order.
+func (s *FileOutboxStore) List() ([]OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedOutboxEntries(s.entries), nil
+}
+
+func (s *FileOutboxStore) save() error {
+	b, err := json.Marshal(outboxFile{NextSeq: s.nextSeq, Entries: sortedOutboxEntries(s.entries)})
+	if err != nil {
+		return fmt.Errorf("encode outbox: %w", err)
+	}
+	if err := writeFileAtomic(s.path, b); err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+func TestFileOutboxStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	s, err := NewFileOutboxStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := func(id string) OutboxEntry {
+		return OutboxEntry{
+			Event:     models.BlockEvent{ID: id, Network: models.NetworkETH, TxHash: "0x" + id},
+			CreatedAt: time.Now(),
+		}
+	}
+	for _, id := range []string{"b", "a", "c"} {
+		if added, err := s.Add(entry(id)); err != nil || !added {
+			t.Fatalf("Add(%s) = %v, %v", id, added, err)
+		}
+	}
+	if added, err := s.Add(entry("a")); err != nil || added {
+		t.Errorf("duplicate Add = %v, %v, want false", added, err)
+	}
+	if _, err := s.Add(entry("")); err == nil {
+		t.Error("Add without event ID should fail")
+	}
+
+	failed := entry("a")
+	failed.Attempts, failed.LastError, failed.DeadLettered = 5, "handler down", true
+	if err := s.Update(failed); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(entry("missing")); err == nil {
+		t.Error("Update of a missing entry should fail")
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new store over the same directory sees the entries, as after a restart.
+	reopened, err := NewFileOutboxStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Event.ID != "a" || got[1].Event.ID != "c" {
+		t.Fatalf("entries = %+v, want a, c in insertion order", got)
+	}
+	if got[0].Seq != 2 || got[0].Attempts != 5 || !got[0].DeadLettered || got[0].LastError != "handler down" {
+		t.Errorf("updated entry = %+v", got[0])
+	}
+
+	// Sequence numbers continue after a restart.
+	if _, err := reopened.Add(entry("d")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopened.List(); got[len(got)-1].Seq != 4 {
+		t.Errorf("Seq after reopen = %d, want 4", got[len(got)-1].Seq)
+	}
+}
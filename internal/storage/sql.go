@@ -0,0 +1,369 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// SQLDialect selects the SQL flavour of the database behind the SQL stores.
+// The stores use database/sql; the caller opens the database with a driver
+// such as github.com/jackc/pgx/v5/stdlib ("pgx") or a SQLite driver.
+type SQLDialect string
+
+// Supported SQL dialects.
+const (
+	DialectPostgres SQLDialect = "postgres"
+	// DialectSQLite requires transactions to take the write lock when they
+	// begin (e.g. "_txlock=immediate" with mattn/go-sqlite3), as SQLite has
+	// no SELECT ... FOR UPDATE.
+	DialectSQLite SQLDialect = "sqlite"
+)
+
+// ErrDuplicateIdempotencyKey is returned by SQLTxStore.Put when the key is
+// already used by another transaction.
+var ErrDuplicateIdempotencyKey = errors.New("idempotency key already used")
+
+// sqlQueryTimeout bounds each store call; the store interfaces take no context.
+const sqlQueryTimeout = 10 * time.Second
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// sqlDB is the database handle shared by the SQL stores.
+type sqlDB struct {
+	db      *sql.DB
+	dialect SQLDialect
+}
+
+// rebind rewrites ? placeholders to $n for Postgres.
+func (s sqlDB) rebind(query string) string {
+	if s.dialect != DialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// forUpdate returns the row-locking clause of the dialect.
+func (s sqlDB) forUpdate() string {
+	if s.dialect == DialectPostgres {
+		return " FOR UPDATE"
+	}
+	return "" // the immediate transaction already holds the write lock
+}
+
+func queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), sqlQueryTimeout)
+}
+
+// MigrateSQL applies the pending schema migrations, each in its own
+// transaction, and records them in schema_migrations. It is safe to call on
+// every start; applied migrations are skipped.
+func MigrateSQL(ctx context.Context, db *sql.DB, dialect SQLDialect) error {
+	s := sqlDB{db: db, dialect: dialect}
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER   NOT NULL PRIMARY KEY,
+    name       TEXT      NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("read schema_migrations: %w", err)
+	}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return fmt.Errorf("read schema_migrations: %w", err)
+		}
+		applied[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read schema_migrations: %w", err)
+	}
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, path := range names {
+		name := strings.TrimPrefix(path, "migrations/")
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %s: name must start with a version number", name)
+		}
+		if applied[version] {
+			continue
+		}
+		script, err := migrations.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := s.applyMigration(ctx, version, name, string(script)); err != nil {
+			return fmt.Errorf("migration %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s sqlDB) applyMigration(ctx context.Context, version int, name, script string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+	for _, stmt := range strings.Split(script, ";\n") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`), version, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SQLNonceStore is a NonceStore in the nonces table.
+type SQLNonceStore struct {
+	sqlDB
+}
+
+// NewSQLNonceStore returns a NonceStore backed by db. Run MigrateSQL first.
+func NewSQLNonceStore(db *sql.DB, dialect SQLDialect) *SQLNonceStore {
+	return &SQLNonceStore{sqlDB{db: db, dialect: dialect}}
+}
+
+// GetAndIncrement atomically returns the current nonce and increments it.
+// The address row is locked for the transaction, so concurrent callers, in
+// this or another process, never get the same nonce.
+func (s *SQLNonceStore) GetAndIncrement(address string) (uint64, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("get nonce: %w", err)
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	if _, err := tx.ExecContext(ctx, s.rebind(
+		`INSERT INTO nonces (address, next_nonce) VALUES (?, 0) ON CONFLICT (address) DO NOTHING`), address); err != nil {
+		return 0, fmt.Errorf("get nonce: %w", err)
+	}
+	var nonce int64
+	if err := tx.QueryRowContext(ctx, s.rebind(
+		`SELECT next_nonce FROM nonces WHERE address = ?`+s.forUpdate()), address).Scan(&nonce); err != nil {
+		return 0, fmt.Errorf("get nonce: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(
+		`UPDATE nonces SET next_nonce = ? WHERE address = ?`), nonce+1, address); err != nil {
+		return 0, fmt.Errorf("increment nonce: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("increment nonce: %w", err)
+	}
+	return uint64(nonce), nil
+}
+
+// SQLTxStore is a TxStore in the transactions table.
+type SQLTxStore struct {
+	sqlDB
+}
+
+// NewSQLTxStore returns a TxStore backed by db. Run MigrateSQL first.
+func NewSQLTxStore(db *sql.DB, dialect SQLDialect) *SQLTxStore {
+	return &SQLTxStore{sqlDB{db: db, dialect: dialect}}
+}
+
+// Get returns a transaction by idempotency key, or nil if not found or
+// only reserved.
+func (s *SQLTxStore) Get(idempotencyKey string) (*models.Transaction, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	var data sql.NullString
+	var raw []byte
+	err := s.db.QueryRowContext(ctx, s.rebind(
+		`SELECT tx, raw_signed FROM transactions WHERE idempotency_key = ?`), idempotencyKey).Scan(&data, &raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get tx: %w", err)
+	}
+	if !data.Valid {
+		return nil, nil // reserved by a send in progress
+	}
+	var tx models.Transaction
+	if err := json.Unmarshal([]byte(data.String), &tx); err != nil {
+		return nil, fmt.Errorf("decode tx %s: %w", idempotencyKey, err)
+	}
+	tx.RawSigned = raw
+	return &tx, nil
+}
+
+// Reserve inserts a row without a transaction for the key. The unique
+// constraint lets only one of concurrent callers, in this or another
+// process, insert it.
+func (s *SQLTxStore) Reserve(idempotencyKey string) (bool, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, s.rebind(
+		`INSERT INTO transactions (idempotency_key) VALUES (?) ON CONFLICT (idempotency_key) DO NOTHING`), idempotencyKey)
+	if err != nil {
+		return false, fmt.Errorf("reserve tx: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("reserve tx: %w", err)
+	}
+	return n == 1, nil
+}
+
+// Release deletes the reservation row of the key, if it has no transaction.
+func (s *SQLTxStore) Release(idempotencyKey string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	if _, err := s.db.ExecContext(ctx, s.rebind(
+		`DELETE FROM transactions WHERE idempotency_key = ? AND tx_hash IS NULL`), idempotencyKey); err != nil {
+		return fmt.Errorf("release tx: %w", err)
+	}
+	return nil
+}
+
+// Put stores a transaction by idempotency key, filling in its reservation
+// row if any. Storing the same transaction again is a no-op; a different
+// transaction under a used key fails with ErrDuplicateIdempotencyKey.
+func (s *SQLTxStore) Put(idempotencyKey string, tx *models.Transaction) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return fmt.Errorf("encode tx: %w", err)
+	}
+	ctx, cancel := queryContext()
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, s.rebind(
+		`INSERT INTO transactions (idempotency_key, network, tx_hash, tx, raw_signed) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (idempotency_key) DO UPDATE SET
+    network = excluded.network, tx_hash = excluded.tx_hash, tx = excluded.tx, raw_signed = excluded.raw_signed
+WHERE transactions.tx_hash IS NULL`),
+		idempotencyKey, string(tx.Network), tx.TxHash, string(data), tx.RawSigned)
+	if err != nil {
+		return fmt.Errorf("put tx: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return err
+	}
+
+	var hash string
+	if err := s.db.QueryRowContext(ctx, s.rebind(
+		`SELECT tx_hash FROM transactions WHERE idempotency_key = ?`), idempotencyKey).Scan(&hash); err != nil {
+		return fmt.Errorf("put tx: %w", err)
+	}
+	if hash != tx.TxHash {
+		return fmt.Errorf("put tx %s: %w by %s", idempotencyKey, ErrDuplicateIdempotencyKey, hash)
+	}
+	return nil
+}
+
+// SQLWatchStore is a WatchStore in the watched_addresses table. Each
+// listener network has its own watch list.
+type SQLWatchStore struct {
+	sqlDB
+	network models.Network
+}
+
+// NewSQLWatchStore returns the watch list of network backed by db. Run
+// MigrateSQL first.
+func NewSQLWatchStore(db *sql.DB, dialect SQLDialect, network models.Network) *SQLWatchStore {
+	return &SQLWatchStore{sqlDB: sqlDB{db: db, dialect: dialect}, network: network}
+}
+
+// Add registers an address for watching.
+func (s *SQLWatchStore) Add(address string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	if _, err := s.db.ExecContext(ctx, s.rebind(
+		`INSERT INTO watched_addresses (network, address) VALUES (?, ?) ON CONFLICT (network, address) DO NOTHING`),
+		string(s.network), address); err != nil {
+		return fmt.Errorf("watch address: %w", err)
+	}
+	return nil
+}
+
+// Remove unregisters an address from watching.
+func (s *SQLWatchStore) Remove(address string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	if _, err := s.db.ExecContext(ctx, s.rebind(
+		`DELETE FROM watched_addresses WHERE network = ? AND address = ?`), string(s.network), address); err != nil {
+		return fmt.Errorf("unwatch address: %w", err)
+	}
+	return nil
+}
+
+// List returns all watched addresses, sorted.
+func (s *SQLWatchStore) List() ([]string, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, s.rebind(
+		`SELECT address FROM watched_addresses WHERE network = ? ORDER BY address`), string(s.network))
+	if err != nil {
+		return nil, fmt.Errorf("list watched addresses: %w", err)
+	}
+	defer rows.Close()
+	result := []string{}
+	for rows.Next() {
+		var addr string
+		if err := rows.Scan(&addr); err != nil {
+			return nil, fmt.Errorf("list watched addresses: %w", err)
+		}
+		result = append(result, addr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list watched addresses: %w", err)
+	}
+	return result, nil
+}
+
+// Contains checks if an address is being watched.
+func (s *SQLWatchStore) Contains(address string) (bool, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	var one int
+	err := s.db.QueryRowContext(ctx, s.rebind(
+		`SELECT 1 FROM watched_addresses WHERE network = ? AND address = ?`), string(s.network), address).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("check watched address: %w", err)
+	}
+	return true, nil
+}
@@ -1,6 +1,10 @@
 package storage
 
-import "github.com/OKaluzny/wallet-demo/pkg/models"
+import (
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
 
 // NonceStore manages per-address nonce state.
 type NonceStore interface {
@@ -10,9 +14,18 @@ type NonceStore interface {
 
 // TxStore provides idempotent transaction storage.
 type TxStore interface {
-	// Get returns a previously stored transaction by idempotency key, or nil if not found.
+	// Get returns a previously stored transaction by idempotency key, or nil
+	// if not found or only reserved.
 	Get(idempotencyKey string) (*models.Transaction, error)
-	// Put stores a transaction keyed by idempotency key.
+	// Reserve claims an idempotency key before its transaction is signed and
+	// broadcast. It reports false, without changing anything, if the key is
+	// already reserved or has a stored transaction.
+	Reserve(idempotencyKey string) (bool, error)
+	// Release drops the reservation of a key whose send failed before
+	// broadcast. A key with a stored transaction is kept.
+	Release(idempotencyKey string) error
+	// Put stores a transaction keyed by idempotency key, replacing its
+	// reservation if any.
 	Put(idempotencyKey string, tx *models.Transaction) error
 }
 
@@ -27,3 +40,60 @@ type WatchStore interface {
 	// Contains checks if an address is in the watch set.
 	Contains(address string) (bool, error)
 }
+
+// UTXOStore tracks spendable outputs per address for UTXO-model chains.
+type UTXOStore interface {
+	// Add records an unspent output owned by address.
+	Add(address string, utxo models.UTXO) error
+	// List returns all unspent outputs owned by address.
+	List(address string) ([]models.UTXO, error)
+	// Spend atomically removes the given outputs, failing if any is no longer unspent.
+	Spend(address string, utxos []models.UTXO) error
+}
+
+// Checkpoint is the persisted position of a block listener on one network.
+type Checkpoint struct {
+	// LastBlock is the last fully processed block number.
+	LastBlock uint64 `json:"last_block"`
+	// BlockHashes holds the recent block number -> hash window used for reorg detection.
+	BlockHashes map[uint64]string `json:"block_hashes"`
+	// PendingEvents holds detected events not yet confirmed, keyed by block number.
+	PendingEvents map[uint64][]models.BlockEvent `json:"pending_events"`
+}
+
+// CheckpointStore persists listener checkpoints so a restarted listener
+// resumes where it stopped.
+type CheckpointStore interface {
+	// Load returns the checkpoint of network, or nil if none was saved.
+	Load(network models.Network) (*Checkpoint, error)
+	// Save replaces the checkpoint of network.
+	Save(network models.Network, cp Checkpoint) error
+}
+
+// OutboxEntry is a listener event awaiting delivery to the event handler.
+type OutboxEntry struct {
+	// Seq orders entries by insertion; assigned by the store.
+	Seq   uint64            `json:"seq"`
+	Event models.BlockEvent `json:"event"`
+	// Attempts counts failed deliveries; LastError is the latest failure.
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+	// DeadLettered is set once the entry exhausted its delivery attempts.
+	// Dead-lettered entries are kept until replayed.
+	DeadLettered bool      `json:"dead_lettered,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OutboxStore persists undelivered events, so an event is only forgotten
+// once the handler accepted it. Entries are keyed by Event.ID.
+type OutboxStore interface {
+	// Add appends an entry and assigns its Seq. It reports false, without
+	// changing anything, if an entry with the same event ID is present.
+	Add(entry OutboxEntry) (bool, error)
+	// Update replaces the entry with the same event ID.
+	Update(entry OutboxEntry) error
+	// Delete removes the entry with the given event ID, once delivered.
+	Delete(id string) error
+	// List returns all entries in Seq order.
+	List() ([]OutboxEntry, error)
+}
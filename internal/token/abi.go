@@ -0,0 +1,110 @@
+package token
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/OKaluzny/wallet-demo/internal/wallet"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// TransferSelector is the ABI function selector of transfer(address,uint256):
+// the first four bytes of keccak256("transfer(address,uint256)").
+var TransferSelector = []byte{0xa9, 0x05, 0x9c, 0xbb}
+
+// abiWordSize is the size of one ABI-encoded static argument.
+const abiWordSize = 32
+
+// EncodeTransfer returns the call data for transfer(to, amount). The recipient
+// is an address of network (0x... for ETH, T... for TRON) and amount is in the
+// token's smallest unit.
+func EncodeTransfer(network models.Network, to string, amount *big.Int) ([]byte, error) {
+	addr, err := wallet.DecodeAccountAddress(network, to)
+	if err != nil {
+		return nil, fmt.Errorf("recipient: %w", err)
+	}
+	if amount == nil || amount.Sign() <= 0 {
+		return nil, fmt.Errorf("amount must be positive, got %v", amount)
+	}
+	if amount.BitLen() > 256 {
+		return nil, fmt.Errorf("amount overflows uint256")
+	}
+
+	data := make([]byte, 0, len(TransferSelector)+2*abiWordSize)
+	data = append(data, TransferSelector...)
+	data = append(data, abiWord(addr)...)
+	data = append(data, abiWord(amount.Bytes())...)
+	return data, nil
+}
+
+// abiWord left-pads b to a 32-byte ABI word.
+func abiWord(b []byte) []byte {
+	word := make([]byte, abiWordSize)
+	copy(word[abiWordSize-len(b):], b)
+	return word
+}
+
+// TransferEventTopic is topic 0 of Transfer(address,address,uint256) logs:
+// keccak256("Transfer(address,address,uint256)").
+const TransferEventTopic = "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// DecodeTransferEvent decodes a Transfer(address indexed from, address indexed to,
+// uint256 value) log into the 20-byte sender and recipient and the amount.
+// Topics are hex strings with or without a 0x prefix, as returned by ETH and
+// TRON nodes.
+func DecodeTransferEvent(topics []string, data []byte) (from, to []byte, amount *big.Int, err error) {
+	// ERC-721 Transfer has the same signature but indexes the token ID (4 topics).
+	if len(topics) != 3 {
+		return nil, nil, nil, fmt.Errorf("transfer event has %d topics, want 3", len(topics))
+	}
+	if !strings.EqualFold(strings.TrimPrefix(topics[0], "0x"), TransferEventTopic) {
+		return nil, nil, nil, fmt.Errorf("not a Transfer event")
+	}
+	if from, err = topicAddress(topics[1]); err != nil {
+		return nil, nil, nil, fmt.Errorf("from: %w", err)
+	}
+	if to, err = topicAddress(topics[2]); err != nil {
+		return nil, nil, nil, fmt.Errorf("to: %w", err)
+	}
+	if len(data) != abiWordSize {
+		return nil, nil, nil, fmt.Errorf("transfer data is %d bytes, want %d", len(data), abiWordSize)
+	}
+	return from, to, new(big.Int).SetBytes(data), nil
+}
+
+// topicAddress extracts the address from an indexed address topic
+// (12 zero bytes followed by the 20-byte address).
+func topicAddress(topic string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(topic, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic %q: %w", topic, err)
+	}
+	if len(b) != abiWordSize {
+		return nil, fmt.Errorf("topic is %d bytes, want %d", len(b), abiWordSize)
+	}
+	for _, z := range b[:abiWordSize-20] {
+		if z != 0 {
+			return nil, fmt.Errorf("topic %q is not an address", topic)
+		}
+	}
+	return b[abiWordSize-20:], nil
+}
+
+// DecodeTransfer decodes transfer(to, amount) call data into the 20-byte
+// recipient and the amount. It is the inverse of EncodeTransfer.
+func DecodeTransfer(data []byte) (to []byte, amount *big.Int, err error) {
+	if len(data) != len(TransferSelector)+2*abiWordSize {
+		return nil, nil, fmt.Errorf("transfer call data is %d bytes, want %d", len(data), len(TransferSelector)+2*abiWordSize)
+	}
+	if !bytes.Equal(data[:len(TransferSelector)], TransferSelector) {
+		return nil, nil, fmt.Errorf("not a transfer call")
+	}
+	args := data[len(TransferSelector):]
+	if to, err = topicAddress(hex.EncodeToString(args[:abiWordSize])); err != nil {
+		return nil, nil, fmt.Errorf("to: %w", err)
+	}
+	return to, new(big.Int).SetBytes(args[abiWordSize:]), nil
+}
@@ -0,0 +1,117 @@
+package token
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// Token describes a fungible token contract (ERC-20 on ETH, TRC-20 on TRON).
+type Token struct {
+	Network  models.Network `json:"network"`
+	Symbol   string         `json:"symbol"`
+	Contract string         `json:"contract"`
+	Decimals uint8          `json:"decimals"`
+}
+
+// Well-known mainnet tokens registered by DefaultRegistry.
+var (
+	USDTEthereum = Token{Network: models.NetworkETH, Symbol: "USDT", Contract: "0xdac17f958d2ee523a2206206994597c13d831ec7", Decimals: 6}
+	USDCEthereum = Token{Network: models.NetworkETH, Symbol: "USDC", Contract: "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", Decimals: 6}
+	USDTTron     = Token{Network: models.NetworkTRX, Symbol: "USDT", Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Decimals: 6}
+)
+
+// Registry indexes tokens by network and symbol, and by network and contract.
+// Safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	bySymbol   map[string]Token
+	byContract map[string]Token
+}
+
+// NewRegistry returns a registry holding the given tokens.
+func NewRegistry(tokens ...Token) (*Registry, error) {
+	r := &Registry{
+		bySymbol:   make(map[string]Token),
+		byContract: make(map[string]Token),
+	}
+	for _, t := range tokens {
+		if err := r.Register(t); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// DefaultRegistry returns a registry with USDT and USDC on their mainnet contracts.
+func DefaultRegistry() *Registry {
+	r, _ := NewRegistry(USDTEthereum, USDCEthereum, USDTTron)
+	return r
+}
+
+// Register adds a token. A symbol or contract may be registered only once per network.
+func (r *Registry) Register(t Token) error {
+	if t.Symbol == "" || t.Contract == "" {
+		return fmt.Errorf("token must have a symbol and a contract")
+	}
+	sk := symbolKey(t.Network, t.Symbol)
+	ck := contractKey(t.Network, t.Contract)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.bySymbol[sk]; ok {
+		return fmt.Errorf("token %s already registered on %s", t.Symbol, t.Network)
+	}
+	if _, ok := r.byContract[ck]; ok {
+		return fmt.Errorf("contract %s already registered on %s", t.Contract, t.Network)
+	}
+	r.bySymbol[sk] = t
+	r.byContract[ck] = t
+	return nil
+}
+
+// BySymbol returns the token with the given symbol on a network.
+func (r *Registry) BySymbol(network models.Network, symbol string) (Token, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.bySymbol[symbolKey(network, symbol)]
+	return t, ok
+}
+
+// ByContract returns the token deployed at contract on a network.
+func (r *Registry) ByContract(network models.Network, contract string) (Token, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byContract[contractKey(network, contract)]
+	return t, ok
+}
+
+// Contracts returns the contracts of the tokens registered on a network, sorted.
+func (r *Registry) Contracts(network models.Network) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var contracts []string
+	for _, t := range r.bySymbol {
+		if t.Network == network {
+			contracts = append(contracts, t.Contract)
+		}
+	}
+	sort.Strings(contracts)
+	return contracts
+}
+
+func symbolKey(network models.Network, symbol string) string {
+	return string(network) + ":" + strings.ToUpper(symbol)
+}
+
+// contractKey normalizes hex contract addresses, which are case-insensitive.
+// Base58 TRON addresses are case-sensitive and kept as-is.
+func contractKey(network models.Network, contract string) string {
+	if strings.HasPrefix(contract, "0x") || strings.HasPrefix(contract, "0X") {
+		contract = strings.ToLower(contract)
+	}
+	return string(network) + ":" + contract
+}
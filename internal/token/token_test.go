@@ -0,0 +1,208 @@
+package token
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+	"golang.org/x/crypto/sha3"
+)
+
+func TestRegistry_Lookup(t *testing.T) {
+	r := DefaultRegistry()
+
+	tok, ok := r.BySymbol(models.NetworkTRX, "usdt")
+	if !ok || tok.Contract != "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t" || tok.Decimals != 6 {
+		t.Errorf("TRX USDT = %+v, %v", tok, ok)
+	}
+
+	// Hex contracts match regardless of checksum casing.
+	tok, ok = r.ByContract(models.NetworkETH, "0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	if !ok || tok.Symbol != "USDT" {
+		t.Errorf("ETH USDT by contract = %+v, %v", tok, ok)
+	}
+
+	if _, ok := r.BySymbol(models.NetworkTRX, "USDC"); ok {
+		t.Error("USDC is not registered on TRX")
+	}
+	if _, ok := r.ByContract(models.NetworkTRX, USDTEthereum.Contract); ok {
+		t.Error("contract lookup must be scoped to the network")
+	}
+
+	if got := r.Contracts(models.NetworkETH); len(got) != 2 || got[0] != USDCEthereum.Contract || got[1] != USDTEthereum.Contract {
+		t.Errorf("ETH contracts = %v", got)
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r, err := NewRegistry(USDTEthereum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dupSymbol := Token{Network: models.NetworkETH, Symbol: "usdt", Contract: "0x1111111111111111111111111111111111111111", Decimals: 6}
+	if err := r.Register(dupSymbol); err == nil {
+		t.Error("expected error for duplicate symbol")
+	}
+	dupContract := Token{Network: models.NetworkETH, Symbol: "TETHER", Contract: "0xDAC17F958D2EE523A2206206994597C13D831EC7", Decimals: 6}
+	if err := r.Register(dupContract); err == nil {
+		t.Error("expected error for duplicate contract")
+	}
+	if err := r.Register(Token{Network: models.NetworkETH, Symbol: "X"}); err == nil {
+		t.Error("expected error for missing contract")
+	}
+
+	// The same symbol on another network is a different token.
+	if err := r.Register(USDTTron); err != nil {
+		t.Errorf("register on another network: %v", err)
+	}
+}
+
+func TestEncodeTransfer(t *testing.T) {
+	tests := []struct {
+		name    string
+		network models.Network
+		to      string
+		amount  int64
+		want    string
+	}{
+		{
+			"ETH", models.NetworkETH, "0x3535353535353535353535353535353535353535", 1_000_000,
+			"a9059cbb" +
+				"0000000000000000000000003535353535353535353535353535353535353535" +
+				"00000000000000000000000000000000000000000000000000000000000f4240",
+		},
+		{
+			// TRON recipients are encoded without the 0x41 prefix.
+			"TRX", models.NetworkTRX, "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", 1,
+			"a9059cbb" +
+				"000000000000000000000000a614f803b6fd780986a42c78ec9c7f77e6ded13c" +
+				"0000000000000000000000000000000000000000000000000000000000000001",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeTransfer(tt.network, tt.to, big.NewInt(tt.amount))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(data); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeTransfer_Errors(t *testing.T) {
+	overflow := new(big.Int).Lsh(big.NewInt(1), 256)
+	tests := []struct {
+		name    string
+		network models.Network
+		to      string
+		amount  *big.Int
+	}{
+		{"zero amount", models.NetworkETH, "0x3535353535353535353535353535353535353535", big.NewInt(0)},
+		{"nil amount", models.NetworkETH, "0x3535353535353535353535353535353535353535", nil},
+		{"overflow", models.NetworkETH, "0x3535353535353535353535353535353535353535", overflow},
+		{"bad address", models.NetworkETH, "0x35", big.NewInt(1)},
+		{"ETH address on TRX", models.NetworkTRX, "0x3535353535353535353535353535353535353535", big.NewInt(1)},
+		{"UTXO network", models.NetworkBTC, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", big.NewInt(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := EncodeTransfer(tt.network, tt.to, tt.amount); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestDecodeTransfer(t *testing.T) {
+	data, err := EncodeTransfer(models.NetworkTRX, "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", big.NewInt(5_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, amount, err := DecodeTransfer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(to) != "a614f803b6fd780986a42c78ec9c7f77e6ded13c" || amount.Int64() != 5_000_000 {
+		t.Errorf("to = %x, amount = %v", to, amount)
+	}
+
+	approve := append(mustHex(t, "095ea7b3"), data[4:]...)
+	dirty := append([]byte(nil), data...)
+	dirty[4] = 0xff
+	for name, bad := range map[string][]byte{
+		"short":         data[:len(data)-1],
+		"other method":  approve,
+		"dirty address": dirty,
+	} {
+		if _, _, err := DecodeTransfer(bad); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestTransferEventTopic(t *testing.T) {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte("Transfer(address,address,uint256)"))
+	if got := hex.EncodeToString(h.Sum(nil)); got != TransferEventTopic {
+		t.Errorf("topic = %s, want keccak256 of the event signature %s", TransferEventTopic, got)
+	}
+
+	h = sha3.NewLegacyKeccak256()
+	h.Write([]byte("transfer(address,uint256)"))
+	if got := h.Sum(nil)[:4]; hex.EncodeToString(got) != hex.EncodeToString(TransferSelector) {
+		t.Errorf("selector = %x, want %x", TransferSelector, got)
+	}
+}
+
+func TestDecodeTransferEvent(t *testing.T) {
+	topics := []string{
+		"0x" + TransferEventTopic,
+		"0x0000000000000000000000009858effd232b4033e47d90003d41ec34ecaeda94",
+		"000000000000000000000000a614f803b6fd780986a42c78ec9c7f77e6ded13c", // TRON nodes omit 0x
+	}
+	data := mustHex(t, "00000000000000000000000000000000000000000000000000000000000f4240")
+
+	from, to, amount, err := DecodeTransferEvent(topics, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(from) != "9858effd232b4033e47d90003d41ec34ecaeda94" ||
+		hex.EncodeToString(to) != "a614f803b6fd780986a42c78ec9c7f77e6ded13c" {
+		t.Errorf("from = %x, to = %x", from, to)
+	}
+	if amount.Int64() != 1_000_000 {
+		t.Errorf("amount = %v", amount)
+	}
+
+	bad := []struct {
+		name   string
+		topics []string
+		data   []byte
+	}{
+		{"ERC-721 (indexed token id)", append(topics, "0x01"), nil},
+		{"other event", []string{"0x8c5be1e5ebec7d5bd14f71427e41e3b5fe2e4ec5215b5bb16a1c4f5ebcfc4b8d", topics[1], topics[2]}, data},
+		{"dirty address topic", []string{topics[0], "0x1111111111111111111111119858effd232b4033e47d90003d41ec34ecaeda94", topics[2]}, data},
+		{"short data", topics, data[:31]},
+	}
+	for _, tt := range bad {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := DecodeTransferEvent(tt.topics, tt.data); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
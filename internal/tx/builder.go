@@ -2,12 +2,17 @@ package tx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
+	"sync"
 	"time"
 
+	"github.com/OKaluzny/wallet-demo/internal/coinselect"
+	"github.com/OKaluzny/wallet-demo/internal/config"
 	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/internal/token"
 	"github.com/OKaluzny/wallet-demo/internal/wallet"
 	"github.com/OKaluzny/wallet-demo/pkg/models"
 )
@@ -16,6 +21,75 @@ import (
 type BuilderConfig struct {
 	MaxRetries int
 	Fees       map[models.Network]*big.Int
+	// DynamicFees enables EIP-1559 transactions for networks where London is active.
+	// Networks without an entry fall back to legacy transactions priced from Fees.
+	DynamicFees map[models.Network]DynamicFee
+	// FeeRates holds the sat/vB rate for UTXO-model networks. The fee is
+	// computed from the selected inputs' virtual size, not taken from Fees.
+	FeeRates map[models.Network]int64
+	// CoinSelector picks inputs for UTXO-model sends (default coinselect.Auto).
+	CoinSelector coinselect.Strategy
+	// DustThreshold is the smallest change output created, in satoshis.
+	DustThreshold int64
+	// TokenGasLimit is the gas limit of ETH token transfers (default 100000).
+	TokenGasLimit uint64
+	// FeeLimits caps the energy cost of TRON smart-contract calls, in sun.
+	FeeLimits map[models.Network]int64
+}
+
+// ErrSendInProgress is returned for a send under an idempotency key that
+// another send reserved and has not stored a transaction for yet.
+var ErrSendInProgress = errors.New("send in progress under this idempotency key")
+
+// Gas limits for ETH sends.
+const (
+	transferGasLimit     = 21_000  // intrinsic gas of a plain value transfer
+	defaultTokenGasLimit = 100_000 // headroom over the ~65k a transfer(address,uint256) costs
+)
+
+// DynamicFee holds EIP-1559 fee parameters for a network.
+type DynamicFee struct {
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	GasLimit             uint64
+}
+
+// validate checks that both fee caps are set and the tip fits under the max fee.
+func (df DynamicFee) validate() error {
+	if df.MaxFeePerGas == nil || df.MaxPriorityFeePerGas == nil {
+		return fmt.Errorf("maxFeePerGas and maxPriorityFeePerGas are required")
+	}
+	if df.MaxPriorityFeePerGas.Cmp(df.MaxFeePerGas) > 0 {
+		return fmt.Errorf("maxPriorityFeePerGas %v exceeds maxFeePerGas %v", df.MaxPriorityFeePerGas, df.MaxFeePerGas)
+	}
+	return nil
+}
+
+// BuilderConfigFrom maps the application config onto builder settings.
+// ETH uses EIP-1559 fees when London is active and legacy fees otherwise.
+func BuilderConfigFrom(cfg config.Config) BuilderConfig {
+	bc := BuilderConfig{
+		MaxRetries: cfg.BroadcastMaxRetries,
+		Fees: map[models.Network]*big.Int{
+			models.NetworkETH: cfg.ETHDefaultFee,
+			models.NetworkTRX: cfg.TRXDefaultFee,
+		},
+		DynamicFees: make(map[models.Network]DynamicFee),
+		FeeRates: map[models.Network]int64{
+			models.NetworkBTC: cfg.BTCFeeRate,
+		},
+		TokenGasLimit: cfg.ETHTokenGasLimit,
+		FeeLimits: map[models.Network]int64{
+			models.NetworkTRX: cfg.TRXFeeLimit,
+		},
+	}
+	if cfg.ETHLondon {
+		bc.DynamicFees[models.NetworkETH] = DynamicFee{
+			MaxFeePerGas:         cfg.ETHMaxFeePerGas,
+			MaxPriorityFeePerGas: cfg.ETHMaxPriorityFeePerGas,
+		}
+	}
+	return bc
 }
 
 // Builder constructs and manages transaction lifecycle.
@@ -24,25 +98,54 @@ type Builder struct {
 	signers    map[models.Network]wallet.Signer
 	nonceStore storage.NonceStore
 	txStore    storage.TxStore
+	utxoStore  storage.UTXOStore
+	tokens     *token.Registry
 	logger     *slog.Logger
 	cfg        BuilderConfig
+
+	// reserved holds UTXO-model sends by tx hash whose inputs stay spent
+	// until the listener reports them confirmed or dropped.
+	mu       sync.Mutex
+	reserved map[string]*models.Transaction
 }
 
 // NewBuilder creates a new transaction builder with the given config and stores.
-func NewBuilder(cfg BuilderConfig, nonces storage.NonceStore, txs storage.TxStore) *Builder {
+// It fails if a DynamicFees entry is invalid.
+func NewBuilder(cfg BuilderConfig, nonces storage.NonceStore, txs storage.TxStore) (*Builder, error) {
 	if cfg.MaxRetries <= 0 {
 		cfg.MaxRetries = 3
 	}
 	if cfg.Fees == nil {
 		cfg.Fees = make(map[models.Network]*big.Int)
 	}
+	if cfg.DynamicFees == nil {
+		cfg.DynamicFees = make(map[models.Network]DynamicFee)
+	}
+	for network, df := range cfg.DynamicFees {
+		if err := df.validate(); err != nil {
+			return nil, fmt.Errorf("dynamic fees for %s: %w", network, err)
+		}
+	}
+	if cfg.FeeRates == nil {
+		cfg.FeeRates = make(map[models.Network]int64)
+	}
+	if cfg.CoinSelector == nil {
+		cfg.CoinSelector = coinselect.Auto{}
+	}
+	if cfg.TokenGasLimit == 0 {
+		cfg.TokenGasLimit = defaultTokenGasLimit
+	}
+	if cfg.FeeLimits == nil {
+		cfg.FeeLimits = make(map[models.Network]int64)
+	}
 	return &Builder{
 		signers:    make(map[models.Network]wallet.Signer),
 		nonceStore: nonces,
 		txStore:    txs,
 		logger:     slog.Default().With("component", "tx_builder"),
 		cfg:        cfg,
-	}
+		reserved:   make(map[string]*models.Transaction),
+	}, nil
 }
 
 // RegisterSigner registers a transaction signer for a specific network.
@@ -50,6 +153,16 @@ func (b *Builder) RegisterSigner(network models.Network, signer wallet.Signer) {
 	b.signers[network] = signer
 }
 
+// SetUTXOStore sets the store of spendable outputs used for UTXO-model sends.
+func (b *Builder) SetUTXOStore(store storage.UTXOStore) {
+	b.utxoStore = store
+}
+
+// SetTokenRegistry sets the registry used to resolve token symbols in SendToken.
+func (b *Builder) SetTokenRegistry(tokens *token.Registry) {
+	b.tokens = tokens
+}
+
 // SendRequest represents a request to send a transaction.
 type SendRequest struct {
 	IdempotencyKey string // prevents duplicate sends
@@ -59,38 +172,184 @@ type SendRequest struct {
 	Amount         *big.Int
 	Data           []byte // smart contract call data (ETH/TRX)
 	PrivateKey     []byte // in production: replaced by HSM key reference
+
+	// TRX: recent block the transaction references (TaPoS), e.g. from wallet/getnowblock
+	RefBlockNumber uint64
+	RefBlockHash   string
+}
+
+// TokenSendRequest represents a request to send an ERC-20/TRC-20 token.
+// Amount is in the token's smallest unit and Data must be empty.
+type TokenSendRequest struct {
+	SendRequest
+	Symbol string // token symbol, resolved in the builder's token registry
 }
 
 // Send builds, signs, and "broadcasts" a transaction with idempotency.
 func (b *Builder) Send(ctx context.Context, req SendRequest) (*models.Transaction, error) {
+	tx := &models.Transaction{
+		Network: req.Network,
+		From:    req.From,
+		To:      req.To,
+		Amount:  req.Amount,
+		Data:    req.Data,
+
+		RefBlockNumber: req.RefBlockNumber,
+		RefBlockHash:   req.RefBlockHash,
+	}
+	return b.submit(ctx, req.IdempotencyKey, tx, req.PrivateKey)
+}
+
+// SendToken sends a token transfer: a zero-value call of transfer(to, amount)
+// on the token contract. ETH calls use TokenGasLimit; TRON calls set fee_limit
+// from FeeLimits.
+func (b *Builder) SendToken(ctx context.Context, req TokenSendRequest) (*models.Transaction, error) {
+	if b.tokens == nil {
+		return nil, fmt.Errorf("no token registry")
+	}
+	if req.Network.IsUTXO() {
+		return nil, fmt.Errorf("network %s does not support tokens", req.Network)
+	}
+	if len(req.Data) > 0 {
+		return nil, fmt.Errorf("token transfer must not carry call data")
+	}
+	tok, ok := b.tokens.BySymbol(req.Network, req.Symbol)
+	if !ok {
+		return nil, fmt.Errorf("unknown token %s on %s", req.Symbol, req.Network)
+	}
+	data, err := token.EncodeTransfer(req.Network, req.To, req.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("encode transfer: %w", err)
+	}
+
+	tx := &models.Transaction{
+		Network: req.Network,
+		From:    req.From,
+		To:      tok.Contract,
+		Amount:  big.NewInt(0),
+		Data:    data,
+		Token: &models.TokenTransfer{
+			Contract:  tok.Contract,
+			Symbol:    tok.Symbol,
+			Decimals:  tok.Decimals,
+			Recipient: req.To,
+			Amount:    new(big.Int).Set(req.Amount),
+		},
+
+		RefBlockNumber: req.RefBlockNumber,
+		RefBlockHash:   req.RefBlockHash,
+	}
+	switch req.Network {
+	case models.NetworkETH:
+		tx.GasLimit = b.cfg.TokenGasLimit
+	case models.NetworkTRX:
+		tx.FeeLimit = b.cfg.FeeLimits[req.Network]
+		if tx.FeeLimit <= 0 {
+			return nil, fmt.Errorf("no fee limit configured for %s", req.Network)
+		}
+	}
+	return b.submit(ctx, req.IdempotencyKey, tx, req.PrivateKey)
+}
+
+// submit runs the send pipeline for a built transaction: idempotency key
+// reservation, coin selection or nonce and fees, signing, broadcast and
+// storage.
+func (b *Builder) submit(ctx context.Context, idempotencyKey string, tx *models.Transaction, privateKey []byte) (*models.Transaction, error) {
 	// Idempotency check — prevent duplicate sends
-	existing, err := b.txStore.Get(req.IdempotencyKey)
+	existing, err := b.claimKey(idempotencyKey)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	signed, err := b.prepare(ctx, tx, privateKey)
+	if err != nil {
+		// Nothing left the process: a retry under the key may send.
+		if rerr := b.txStore.Release(idempotencyKey); rerr != nil {
+			b.logger.Warn("release idempotency key", "idempotency_key", idempotencyKey, "error", rerr)
+		}
+		return nil, err
+	}
+
+	// From here on the key stays reserved even if the send fails: a failed
+	// broadcast may still have reached the network.
+	if err := b.broadcastWithRetry(ctx, signed, b.cfg.MaxRetries); err != nil {
+		return nil, fmt.Errorf("broadcast: %w", err)
+	}
+
+	// The change is spendable once broadcast; record it before the store
+	// write so a failed write cannot lose it.
+	if tx.Network.IsUTXO() {
+		if err := b.recordChange(signed); err != nil {
+			return nil, fmt.Errorf("record change: %w", err)
+		}
+	}
+
+	// Store for idempotency
+	if err := b.txStore.Put(idempotencyKey, signed); err != nil {
+		return nil, fmt.Errorf("tx store put: %w", err)
+	}
+
+	return signed, nil
+}
+
+// claimKey reserves the idempotency key for this send, so a concurrent send
+// under the same key, in this or another process, cannot sign and broadcast
+// a second transaction. It returns the transaction already sent under the
+// key, if any, and ErrSendInProgress if another send holds the key.
+func (b *Builder) claimKey(idempotencyKey string) (*models.Transaction, error) {
+	existing, err := b.storedTx(idempotencyKey)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	ok, err := b.txStore.Reserve(idempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("tx store reserve: %w", err)
+	}
+	if ok {
+		return nil, nil
+	}
+	// Another send holds the key; it may have stored its transaction since
+	// the check above.
+	existing, err = b.storedTx(idempotencyKey)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	return nil, ErrSendInProgress
+}
+
+// storedTx returns the transaction stored under the idempotency key, or nil.
+func (b *Builder) storedTx(idempotencyKey string) (*models.Transaction, error) {
+	existing, err := b.txStore.Get(idempotencyKey)
 	if err != nil {
 		return nil, fmt.Errorf("tx store get: %w", err)
 	}
 	if existing != nil {
 		b.logger.Info("duplicate request, returning existing tx",
-			"idempotency_key", req.IdempotencyKey,
+			"idempotency_key", idempotencyKey,
 			"tx_hash", existing.TxHash,
 		)
-		return existing, nil
-	}
-
-	// Nonce management (for account-model chains like ETH, TRX)
-	nonce, err := b.nonceStore.GetAndIncrement(req.From)
-	if err != nil {
-		return nil, fmt.Errorf("nonce store: %w", err)
 	}
+	return existing, nil
+}
 
-	// Build transaction
-	tx := &models.Transaction{
-		Network: req.Network,
-		From:    req.From,
-		To:      req.To,
-		Amount:  req.Amount,
-		Nonce:   nonce,
-		Data:    req.Data,
-		Fee:     b.estimateFee(req.Network),
+// prepare picks the inputs or nonce and fee of tx and signs it. For UTXO
+// networks the signed transaction's inputs are reserved.
+func (b *Builder) prepare(ctx context.Context, tx *models.Transaction, privateKey []byte) (*models.Transaction, error) {
+	if tx.Network.IsUTXO() {
+		// Coin selection (for UTXO-model chains like BTC)
+		if err := b.selectCoins(tx); err != nil {
+			return nil, fmt.Errorf("coin selection: %w", err)
+		}
+	} else {
+		// Nonce management (for account-model chains like ETH, TRX)
+		nonce, err := b.nonceStore.GetAndIncrement(tx.From)
+		if err != nil {
+			return nil, fmt.Errorf("nonce store: %w", err)
+		}
+		tx.Nonce = nonce
+		tx.Fee = b.estimateFee(tx.Network)
+		b.applyDynamicFee(tx)
+		b.scaleLegacyFee(tx)
 	}
 
 	b.logger.Info("building transaction",
@@ -98,31 +357,140 @@ func (b *Builder) Send(ctx context.Context, req SendRequest) (*models.Transactio
 		"from", tx.From,
 		"to", tx.To,
 		"amount", tx.Amount,
+		"token", tokenSymbol(tx),
 		"nonce", tx.Nonce,
+		"type", tx.Type,
+		"inputs", len(tx.Inputs),
+		"fee", tx.Fee,
 	)
 
 	// Sign
-	signer, ok := b.signers[req.Network]
+	signer, ok := b.signers[tx.Network]
 	if !ok {
-		return nil, fmt.Errorf("no signer for network %s", req.Network)
+		return nil, fmt.Errorf("no signer for network %s", tx.Network)
 	}
 
-	signed, err := signer.Sign(ctx, tx, req.PrivateKey)
+	signed, err := signer.Sign(ctx, tx, privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("sign: %w", err)
 	}
 
-	// Broadcast with retry
-	if err := b.broadcastWithRetry(ctx, signed, b.cfg.MaxRetries); err != nil {
-		return nil, fmt.Errorf("broadcast: %w", err)
+	// Reserve the spent outputs so concurrent sends cannot select them. A
+	// failed broadcast may still have reached the network, so from here on
+	// the inputs stay reserved until the transaction confirms or is dropped.
+	if tx.Network.IsUTXO() {
+		if err := b.utxoStore.Spend(tx.From, tx.Inputs); err != nil {
+			return nil, fmt.Errorf("utxo store spend: %w", err)
+		}
+		b.mu.Lock()
+		b.reserved[signed.TxHash] = signed
+		b.mu.Unlock()
 	}
+	return signed, nil
+}
 
-	// Store for idempotency
-	if err := b.txStore.Put(req.IdempotencyKey, signed); err != nil {
-		return nil, fmt.Errorf("tx store put: %w", err)
+// selectCoins funds a UTXO-model transaction from the sender's unspent outputs,
+// adding a change output back to the sender when the leftover is above dust.
+func (b *Builder) selectCoins(tx *models.Transaction) error {
+	if b.utxoStore == nil {
+		return fmt.Errorf("no UTXO store for network %s", tx.Network)
+	}
+	if tx.Amount == nil || !tx.Amount.IsInt64() {
+		return fmt.Errorf("invalid amount %v", tx.Amount)
+	}
+	utxos, err := b.utxoStore.List(tx.From)
+	if err != nil {
+		return fmt.Errorf("list utxos: %w", err)
 	}
 
-	return signed, nil
+	sel, err := b.cfg.CoinSelector.Select(utxos, coinselect.Request{
+		Target:        tx.Amount.Int64(),
+		FeeRate:       b.cfg.FeeRates[tx.Network],
+		OutputsVSize:  coinselect.AddressOutputVSize(tx.To),
+		ChangeVSize:   coinselect.AddressOutputVSize(tx.From),
+		DustThreshold: b.cfg.DustThreshold,
+	})
+	if err != nil {
+		return err
+	}
+
+	tx.Inputs = sel.Inputs
+	tx.Outputs = []models.TxOutput{{Address: tx.To, Amount: new(big.Int).Set(tx.Amount)}}
+	if sel.Change > 0 {
+		tx.Outputs = append(tx.Outputs, models.TxOutput{Address: tx.From, Amount: big.NewInt(sel.Change)})
+	}
+	tx.Fee = big.NewInt(sel.Fee)
+	return nil
+}
+
+// Handle releases the inputs of a UTXO-model send that the listener reports
+// dropped from the mempool, and stops tracking sends once they confirm. It
+// implements listener.EventHandler.
+func (b *Builder) Handle(ev models.BlockEvent) error {
+	if !ev.Network.IsUTXO() || (!ev.Dropped && !ev.Confirmed) {
+		return nil
+	}
+	b.mu.Lock()
+	tx, ok := b.reserved[ev.TxHash]
+	delete(b.reserved, ev.TxHash)
+	b.mu.Unlock()
+	if !ok || !ev.Dropped {
+		return nil
+	}
+
+	b.logger.Warn("sent transaction dropped, releasing inputs",
+		"network", ev.Network,
+		"tx_hash", ev.TxHash,
+		"replaced_by", ev.ReplacedBy,
+	)
+	return b.releaseInputs(tx)
+}
+
+// releaseInputs makes the inputs of a dropped send spendable again and
+// removes its change output.
+func (b *Builder) releaseInputs(tx *models.Transaction) error {
+	for _, in := range tx.Inputs {
+		if err := b.utxoStore.Add(tx.From, in); err != nil {
+			return fmt.Errorf("release utxo %s:%d: %w", in.TxID, in.Vout, err)
+		}
+	}
+	for vout, out := range tx.Outputs {
+		if vout == 0 || out.Address != tx.From {
+			continue
+		}
+		change := models.UTXO{TxID: tx.TxHash, Vout: uint32(vout)}
+		if err := b.utxoStore.Spend(tx.From, []models.UTXO{change}); err != nil {
+			b.logger.Warn("change of dropped transaction not unspent",
+				"tx_hash", tx.TxHash,
+				"vout", vout,
+				"error", err,
+			)
+		}
+	}
+	return nil
+}
+
+// recordChange makes the change output of a sent transaction spendable by the sender.
+func (b *Builder) recordChange(tx *models.Transaction) error {
+	for vout, out := range tx.Outputs {
+		if vout == 0 || out.Address != tx.From {
+			continue
+		}
+		script, err := wallet.BTCAddressScript(tx.From)
+		if err != nil {
+			return fmt.Errorf("change script: %w", err)
+		}
+		if err := b.utxoStore.Add(tx.From, models.UTXO{
+			TxID:         tx.TxHash,
+			Vout:         uint32(vout),
+			Amount:       new(big.Int).Set(out.Amount),
+			ScriptPubKey: script,
+			Address:      tx.From,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (b *Builder) estimateFee(network models.Network) *big.Int {
@@ -132,6 +500,43 @@ func (b *Builder) estimateFee(network models.Network) *big.Int {
 	return big.NewInt(0)
 }
 
+// applyDynamicFee switches tx to an EIP-1559 transaction when the network has
+// dynamic fees configured. Fee is set to the worst-case cost, maxFeePerGas * gasLimit.
+func (b *Builder) applyDynamicFee(tx *models.Transaction) {
+	df, ok := b.cfg.DynamicFees[tx.Network]
+	if !ok {
+		return
+	}
+	tx.Type = models.TxTypeDynamicFee
+	tx.MaxFeePerGas = new(big.Int).Set(df.MaxFeePerGas)
+	tx.MaxPriorityFeePerGas = new(big.Int).Set(df.MaxPriorityFeePerGas)
+	if tx.GasLimit == 0 {
+		tx.GasLimit = df.GasLimit
+	}
+	if tx.GasLimit == 0 {
+		tx.GasLimit = transferGasLimit
+	}
+	tx.Fee = new(big.Int).Mul(tx.MaxFeePerGas, new(big.Int).SetUint64(tx.GasLimit))
+}
+
+// scaleLegacyFee prices a legacy transaction with an explicit gas limit, such as
+// a token call. The flat fee covers a plain transfer, so its gas price is kept
+// and Fee becomes gasPrice * gasLimit.
+func (b *Builder) scaleLegacyFee(tx *models.Transaction) {
+	if tx.Type != models.TxTypeLegacy || tx.GasLimit == 0 {
+		return
+	}
+	tx.GasPrice = new(big.Int).Div(tx.Fee, big.NewInt(transferGasLimit))
+	tx.Fee = new(big.Int).Mul(tx.GasPrice, new(big.Int).SetUint64(tx.GasLimit))
+}
+
+func tokenSymbol(tx *models.Transaction) string {
+	if tx.Token == nil {
+		return ""
+	}
+	return tx.Token.Symbol
+}
+
 func (b *Builder) broadcastWithRetry(ctx context.Context, tx *models.Transaction, maxRetries int) error {
 	var lastErr error
 
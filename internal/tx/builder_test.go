@@ -1,11 +1,18 @@
 package tx
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"math/big"
+	"sync/atomic"
 	"testing"
 
+	"github.com/OKaluzny/wallet-demo/internal/coinselect"
+	"github.com/OKaluzny/wallet-demo/internal/config"
 	"github.com/OKaluzny/wallet-demo/internal/storage"
+	"github.com/OKaluzny/wallet-demo/internal/token"
+	"github.com/OKaluzny/wallet-demo/internal/wallet"
 	"github.com/OKaluzny/wallet-demo/pkg/models"
 )
 
@@ -19,8 +26,17 @@ func (m *mockSigner) Sign(ctx context.Context, tx *models.Transaction, privateKe
 	return tx, nil
 }
 
+// mustNewBuilder is NewBuilder for configs known to be valid.
+func mustNewBuilder(cfg BuilderConfig, nonces storage.NonceStore, txs storage.TxStore) *Builder {
+	b, err := NewBuilder(cfg, nonces, txs)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
 func newTestBuilder() *Builder {
-	b := NewBuilder(
+	b := mustNewBuilder(
 		BuilderConfig{
 			MaxRetries: 3,
 			Fees: map[models.Network]*big.Int{
@@ -66,6 +82,93 @@ func TestBuilder_Idempotency(t *testing.T) {
 	}
 }
 
+// blockingSigner counts signings and holds the first until release is closed.
+type blockingSigner struct {
+	signing chan struct{}
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (s *blockingSigner) Sign(ctx context.Context, tx *models.Transaction, privateKey []byte) (*models.Transaction, error) {
+	if s.calls.Add(1) == 1 {
+		close(s.signing)
+		<-s.release
+	}
+	return (&mockSigner{}).Sign(ctx, tx, privateKey)
+}
+
+func TestBuilder_ConcurrentSameKey(t *testing.T) {
+	b := newTestBuilder()
+	signer := &blockingSigner{signing: make(chan struct{}), release: make(chan struct{})}
+	b.RegisterSigner(models.NetworkETH, signer)
+	req := SendRequest{
+		IdempotencyKey: "key-1",
+		Network:        models.NetworkETH,
+		From:           "0xfrom",
+		To:             "0xto",
+		Amount:         big.NewInt(1000),
+	}
+
+	type result struct {
+		tx  *models.Transaction
+		err error
+	}
+	first := make(chan result, 1)
+	go func() {
+		tx, err := b.Send(context.Background(), req)
+		first <- result{tx, err}
+	}()
+	<-signer.signing
+
+	// The key is reserved while the first send is signing: the second send
+	// neither signs nor broadcasts.
+	if _, err := b.Send(context.Background(), req); !errors.Is(err, ErrSendInProgress) {
+		t.Errorf("concurrent send = %v, want ErrSendInProgress", err)
+	}
+	close(signer.release)
+	r := <-first
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	// Once stored, the transaction is returned for the key.
+	tx, err := b.Send(context.Background(), req)
+	if err != nil || tx.TxHash != r.tx.TxHash {
+		t.Errorf("send after completion = %v, %v; want %s", tx, err, r.tx.TxHash)
+	}
+	if n := signer.calls.Load(); n != 1 {
+		t.Errorf("signed %d times, want once", n)
+	}
+}
+
+// failingSigner rejects every transaction.
+type failingSigner struct{}
+
+func (failingSigner) Sign(ctx context.Context, tx *models.Transaction, privateKey []byte) (*models.Transaction, error) {
+	return nil, errors.New("hsm unavailable")
+}
+
+func TestBuilder_FailedSignReleasesKey(t *testing.T) {
+	b := newTestBuilder()
+	b.RegisterSigner(models.NetworkETH, failingSigner{})
+	req := SendRequest{
+		IdempotencyKey: "key-1",
+		Network:        models.NetworkETH,
+		From:           "0xfrom",
+		To:             "0xto",
+		Amount:         big.NewInt(1000),
+	}
+	if _, err := b.Send(context.Background(), req); err == nil {
+		t.Fatal("expected sign error")
+	}
+
+	// Nothing was broadcast, so a retry under the key sends.
+	b.RegisterSigner(models.NetworkETH, &mockSigner{})
+	if _, err := b.Send(context.Background(), req); err != nil {
+		t.Errorf("retry after a failed sign: %v", err)
+	}
+}
+
 func TestBuilder_DifferentKeys(t *testing.T) {
 	b := newTestBuilder()
 	ctx := context.Background()
@@ -128,7 +231,7 @@ func TestBuilder_NonceIncrement(t *testing.T) {
 }
 
 func TestBuilder_NoSigner(t *testing.T) {
-	b := NewBuilder(BuilderConfig{}, storage.NewMemoryNonceStore(), storage.NewMemoryTxStore())
+	b := mustNewBuilder(BuilderConfig{}, storage.NewMemoryNonceStore(), storage.NewMemoryTxStore())
 	// No signers registered
 
 	_, err := b.Send(context.Background(), SendRequest{
@@ -167,3 +270,457 @@ func TestBuilder_FeeEstimation(t *testing.T) {
 		})
 	}
 }
+
+func TestBuilder_DynamicFeeSelection(t *testing.T) {
+	b := mustNewBuilder(
+		BuilderConfig{
+			Fees: map[models.Network]*big.Int{models.NetworkTRX: big.NewInt(1_000_000)},
+			DynamicFees: map[models.Network]DynamicFee{
+				models.NetworkETH: {
+					MaxFeePerGas:         big.NewInt(40_000_000_000),
+					MaxPriorityFeePerGas: big.NewInt(2_000_000_000),
+				},
+			},
+		},
+		storage.NewMemoryNonceStore(),
+		storage.NewMemoryTxStore(),
+	)
+	b.RegisterSigner(models.NetworkETH, &mockSigner{})
+	b.RegisterSigner(models.NetworkTRX, &mockSigner{})
+
+	ethTx, err := b.Send(context.Background(), SendRequest{
+		IdempotencyKey: "eth",
+		Network:        models.NetworkETH,
+		From:           "0xfrom",
+		To:             "0xto",
+		Amount:         big.NewInt(100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ethTx.Type != models.TxTypeDynamicFee {
+		t.Errorf("ETH tx type = %d, want dynamic fee", ethTx.Type)
+	}
+	if ethTx.GasLimit != 21_000 {
+		t.Errorf("gas limit = %d, want 21000", ethTx.GasLimit)
+	}
+	if want := big.NewInt(21_000 * 40_000_000_000); ethTx.Fee.Cmp(want) != 0 {
+		t.Errorf("fee = %v, want %v", ethTx.Fee, want)
+	}
+
+	trxTx, err := b.Send(context.Background(), SendRequest{
+		IdempotencyKey: "trx",
+		Network:        models.NetworkTRX,
+		From:           "Tfrom",
+		To:             "Tto",
+		Amount:         big.NewInt(100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trxTx.Type != models.TxTypeLegacy {
+		t.Errorf("TRX tx type = %d, want legacy", trxTx.Type)
+	}
+}
+
+func TestBuilder_InvalidDynamicFeeRejected(t *testing.T) {
+	for name, df := range map[string]DynamicFee{
+		"nil max fee":      {MaxPriorityFeePerGas: big.NewInt(2_000_000_000)},
+		"nil priority fee": {MaxFeePerGas: big.NewInt(40_000_000_000)},
+		"tip above max":    {MaxFeePerGas: big.NewInt(1_000_000_000), MaxPriorityFeePerGas: big.NewInt(2_000_000_000)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewBuilder(
+				BuilderConfig{
+					Fees:        map[models.Network]*big.Int{models.NetworkETH: big.NewInt(21_000 * 20_000_000_000)},
+					DynamicFees: map[models.Network]DynamicFee{models.NetworkETH: df},
+				},
+				storage.NewMemoryNonceStore(),
+				storage.NewMemoryTxStore(),
+			)
+			if err == nil {
+				t.Fatal("expected an error for invalid dynamic fees")
+			}
+		})
+	}
+}
+
+func TestBuilderConfigFrom_London(t *testing.T) {
+	cfg := config.Default()
+	if _, ok := BuilderConfigFrom(cfg).DynamicFees[models.NetworkETH]; !ok {
+		t.Error("London active: expected ETH dynamic fees")
+	}
+
+	cfg.ETHLondon = false
+	if _, ok := BuilderConfigFrom(cfg).DynamicFees[models.NetworkETH]; ok {
+		t.Error("London inactive: expected legacy ETH fees")
+	}
+}
+
+// btcSender is a mainnet P2PKH address; the test UTXOs pay to P2WPKH scripts.
+const btcSender = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+
+func newTestUTXOBuilder(utxos ...models.UTXO) (*Builder, *storage.MemoryUTXOStore, *storage.MemoryNonceStore) {
+	nonces := storage.NewMemoryNonceStore()
+	b := mustNewBuilder(
+		BuilderConfig{
+			FeeRates:     map[models.Network]int64{models.NetworkBTC: 10},
+			CoinSelector: coinselect.LargestFirst{},
+		},
+		nonces,
+		storage.NewMemoryTxStore(),
+	)
+	store := storage.NewMemoryUTXOStore()
+	for _, u := range utxos {
+		_ = store.Add(btcSender, u)
+	}
+	b.SetUTXOStore(store)
+	b.RegisterSigner(models.NetworkBTC, &mockSigner{})
+	return b, store, nonces
+}
+
+func testUTXO(txid string, amount int64) models.UTXO {
+	return models.UTXO{
+		TxID:         txid,
+		Amount:       big.NewInt(amount),
+		ScriptPubKey: append([]byte{0x00, 20}, make([]byte, 20)...),
+		Address:      btcSender,
+	}
+}
+
+func TestBuilder_BTCCoinSelection(t *testing.T) {
+	b, store, nonces := newTestUTXOBuilder(testUTXO("aa", 30_000), testUTXO("bb", 80_000))
+
+	tx, err := b.Send(context.Background(), SendRequest{
+		IdempotencyKey: "btc-1",
+		Network:        models.NetworkBTC,
+		From:           btcSender,
+		To:             "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Amount:         big.NewInt(50_000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tx.Inputs) != 1 || tx.Inputs[0].TxID != "bb" {
+		t.Errorf("expected the 80000 sat input, got %v", tx.Inputs)
+	}
+	if len(tx.Outputs) != 2 || tx.Outputs[1].Address != btcSender {
+		t.Fatalf("expected payment + change outputs, got %v", tx.Outputs)
+	}
+	total := new(big.Int).Add(tx.Outputs[0].Amount, tx.Outputs[1].Amount)
+	total.Add(total, tx.Fee)
+	if total.Cmp(big.NewInt(80_000)) != 0 {
+		t.Errorf("outputs + fee = %v, want 80000", total)
+	}
+
+	// BTC must not touch the nonce path.
+	if n, _ := nonces.GetAndIncrement(btcSender); n != 0 {
+		t.Errorf("nonce should be untouched for BTC, got %d", n)
+	}
+
+	// The spent input is gone; the unspent one and the change remain.
+	left, _ := store.List(btcSender)
+	var haveChange bool
+	for _, u := range left {
+		if u.TxID == "bb" {
+			t.Error("spent input should be removed from the store")
+		}
+		if u.TxID == tx.TxHash && u.Vout == 1 {
+			haveChange = true
+		}
+	}
+	if !haveChange {
+		t.Error("change output should be recorded as spendable")
+	}
+}
+
+func TestBuilder_BTCChangeScriptFromAddress(t *testing.T) {
+	b, store, _ := newTestUTXOBuilder(testUTXO("bb", 80_000))
+
+	tx, err := b.Send(context.Background(), SendRequest{
+		IdempotencyKey: "btc-change",
+		Network:        models.NetworkBTC,
+		From:           btcSender,
+		To:             "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Amount:         big.NewInt(50_000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := wallet.BTCAddressScript(btcSender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxos, _ := store.List(btcSender)
+	if len(utxos) != 1 || utxos[0].TxID != tx.TxHash {
+		t.Fatalf("expected only the change output, got %v", utxos)
+	}
+	if !bytes.Equal(utxos[0].ScriptPubKey, want) {
+		t.Errorf("change script = %x, want P2PKH script %x", utxos[0].ScriptPubKey, want)
+	}
+}
+
+// failingTxStore finds no earlier sends and fails to store new ones.
+type failingTxStore struct {
+	*storage.MemoryTxStore
+}
+
+func (failingTxStore) Put(idempotencyKey string, tx *models.Transaction) error {
+	return errors.New("database unavailable")
+}
+
+func TestBuilder_BTCFailedSendKeepsInputsReserved(t *testing.T) {
+	b, store, _ := newTestUTXOBuilder(testUTXO("aa", 30_000), testUTXO("bb", 80_000))
+	b.txStore = failingTxStore{storage.NewMemoryTxStore()}
+
+	if _, err := b.Send(context.Background(), SendRequest{
+		IdempotencyKey: "btc-fail",
+		Network:        models.NetworkBTC,
+		From:           btcSender,
+		To:             "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Amount:         big.NewInt(50_000),
+	}); err == nil {
+		t.Fatal("expected tx store error")
+	}
+	// The transaction was broadcast: its input must not fund another send,
+	// and its change is spendable.
+	utxos, _ := store.List(btcSender)
+	var haveChange bool
+	for _, u := range utxos {
+		if u.TxID == "bb" {
+			t.Fatal("input of a broadcast transaction released after a failed store write")
+		}
+		if u.TxID == "0xmockhash" {
+			haveChange = true
+		}
+	}
+	if !haveChange {
+		t.Error("change output lost after a failed store write")
+	}
+	// The key stays reserved, so a retry cannot send the payment again.
+	if _, err := b.Send(context.Background(), SendRequest{
+		IdempotencyKey: "btc-fail",
+		Network:        models.NetworkBTC,
+		From:           btcSender,
+		To:             "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Amount:         big.NewInt(30_000),
+	}); !errors.Is(err, ErrSendInProgress) {
+		t.Errorf("retry after a failed store write = %v, want ErrSendInProgress", err)
+	}
+
+	// A pending event leaves the input reserved; a drop releases it.
+	for _, ev := range []models.BlockEvent{
+		{Network: models.NetworkBTC, TxHash: "0xmockhash", Pending: true},
+		{Network: models.NetworkBTC, TxHash: "0xmockhash", Dropped: true},
+	} {
+		if err := b.Handle(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	utxos, _ = store.List(btcSender)
+	if len(utxos) != 2 {
+		t.Fatalf("inputs should be spendable again and the change gone after the drop, got %v", utxos)
+	}
+}
+
+func TestBuilder_BTCConfirmedSendNotReleased(t *testing.T) {
+	b, store, _ := newTestUTXOBuilder(testUTXO("bb", 80_000))
+
+	tx, err := b.Send(context.Background(), SendRequest{
+		IdempotencyKey: "btc-confirmed",
+		Network:        models.NetworkBTC,
+		From:           btcSender,
+		To:             "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Amount:         big.NewInt(50_000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = b.Handle(models.BlockEvent{Network: models.NetworkBTC, TxHash: tx.TxHash, Confirmed: true})
+	// A late drop report of a confirmed transaction must not free its input.
+	_ = b.Handle(models.BlockEvent{Network: models.NetworkBTC, TxHash: tx.TxHash, Dropped: true})
+
+	utxos, _ := store.List(btcSender)
+	if len(utxos) != 1 || utxos[0].TxID != tx.TxHash {
+		t.Fatalf("expected only the change output, got %v", utxos)
+	}
+}
+
+func TestBuilder_BTCInsufficientFunds(t *testing.T) {
+	b, _, _ := newTestUTXOBuilder(testUTXO("aa", 10_000))
+
+	_, err := b.Send(context.Background(), SendRequest{
+		IdempotencyKey: "btc-poor",
+		Network:        models.NetworkBTC,
+		From:           btcSender,
+		To:             "1recipient",
+		Amount:         big.NewInt(50_000),
+	})
+	if !errors.Is(err, coinselect.ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+}
+
+func TestBuilder_TRXRefBlock(t *testing.T) {
+	b := newTestBuilder()
+
+	tx, err := b.Send(context.Background(), SendRequest{
+		IdempotencyKey: "trx-ref",
+		Network:        models.NetworkTRX,
+		From:           "TUEZSdKsoDHQMeZwihtdoBiN46zxhGWYdH",
+		To:             "TSeJkUh4Qv67VNFwY8LaAxERygNdy6NQZK",
+		Amount:         big.NewInt(1_000_000),
+		RefBlockNumber: 63_000_123,
+		RefBlockHash:   "0000000003c14e3ba1b2c3d4e5f6071800000000000000000000000000000000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.RefBlockNumber != 63_000_123 || tx.RefBlockHash == "" {
+		t.Errorf("ref block not passed to the signer: %d %q", tx.RefBlockNumber, tx.RefBlockHash)
+	}
+}
+
+func newTestTokenBuilder(cfg BuilderConfig) *Builder {
+	b := mustNewBuilder(cfg, storage.NewMemoryNonceStore(), storage.NewMemoryTxStore())
+	b.RegisterSigner(models.NetworkETH, &mockSigner{})
+	b.RegisterSigner(models.NetworkTRX, &mockSigner{})
+	b.SetTokenRegistry(token.DefaultRegistry())
+	return b
+}
+
+func TestBuilder_SendTokenETH(t *testing.T) {
+	b := newTestTokenBuilder(BuilderConfigFrom(config.Default()))
+
+	tx, err := b.SendToken(context.Background(), TokenSendRequest{
+		SendRequest: SendRequest{
+			IdempotencyKey: "usdt-eth",
+			Network:        models.NetworkETH,
+			From:           "0x9858effd232b4033e47d90003d41ec34ecaeda94",
+			To:             "0x3535353535353535353535353535353535353535",
+			Amount:         big.NewInt(25_000_000), // 25 USDT
+		},
+		Symbol: "USDT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.To != token.USDTEthereum.Contract {
+		t.Errorf("To = %s, want the token contract", tx.To)
+	}
+	if tx.Amount.Sign() != 0 {
+		t.Errorf("native value = %v, want 0", tx.Amount)
+	}
+	wantData, _ := token.EncodeTransfer(models.NetworkETH, "0x3535353535353535353535353535353535353535", big.NewInt(25_000_000))
+	if !bytes.Equal(tx.Data, wantData) {
+		t.Errorf("data = %x, want %x", tx.Data, wantData)
+	}
+	if tx.GasLimit != 100_000 {
+		t.Errorf("gas limit = %d, want token gas limit", tx.GasLimit)
+	}
+	if tx.Type != models.TxTypeDynamicFee {
+		t.Errorf("type = %d, want dynamic fee", tx.Type)
+	}
+	if tx.Token == nil || tx.Token.Symbol != "USDT" || tx.Token.Amount.Int64() != 25_000_000 ||
+		tx.Token.Recipient != "0x3535353535353535353535353535353535353535" {
+		t.Errorf("token = %+v", tx.Token)
+	}
+}
+
+func TestBuilder_SendTokenETHLegacyFee(t *testing.T) {
+	cfg := config.Default()
+	cfg.ETHLondon = false
+	b := newTestTokenBuilder(BuilderConfigFrom(cfg))
+
+	tx, err := b.SendToken(context.Background(), TokenSendRequest{
+		SendRequest: SendRequest{
+			IdempotencyKey: "usdc-eth",
+			Network:        models.NetworkETH,
+			From:           "0x9858effd232b4033e47d90003d41ec34ecaeda94",
+			To:             "0x3535353535353535353535353535353535353535",
+			Amount:         big.NewInt(1),
+		},
+		Symbol: "USDC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The flat fee prices 21000 gas at 20 gwei; a token call keeps the price.
+	if tx.GasPrice == nil || tx.GasPrice.Int64() != 20_000_000_000 {
+		t.Errorf("gas price = %v, want 20 gwei", tx.GasPrice)
+	}
+	if want := big.NewInt(100_000 * 20_000_000_000); tx.Fee.Cmp(want) != 0 {
+		t.Errorf("fee = %v, want %v", tx.Fee, want)
+	}
+}
+
+func TestBuilder_SendTokenTRX(t *testing.T) {
+	b := newTestTokenBuilder(BuilderConfigFrom(config.Default()))
+
+	tx, err := b.SendToken(context.Background(), TokenSendRequest{
+		SendRequest: SendRequest{
+			IdempotencyKey: "usdt-trx",
+			Network:        models.NetworkTRX,
+			From:           "TUEZSdKsoDHQMeZwihtdoBiN46zxhGWYdH",
+			To:             "TSeJkUh4Qv67VNFwY8LaAxERygNdy6NQZK",
+			Amount:         big.NewInt(1_000_000),
+		},
+		Symbol: "USDT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.To != token.USDTTron.Contract {
+		t.Errorf("To = %s, want the token contract", tx.To)
+	}
+	if tx.FeeLimit != 100_000_000 {
+		t.Errorf("fee limit = %d, want 100 TRX", tx.FeeLimit)
+	}
+	if tx.GasLimit != 0 {
+		t.Errorf("gas limit = %d, want none on TRX", tx.GasLimit)
+	}
+}
+
+func TestBuilder_SendTokenErrors(t *testing.T) {
+	base := SendRequest{
+		Network: models.NetworkETH,
+		From:    "0x9858effd232b4033e47d90003d41ec34ecaeda94",
+		To:      "0x3535353535353535353535353535353535353535",
+		Amount:  big.NewInt(1),
+	}
+	withKey := func(key string, mod func(*TokenSendRequest)) TokenSendRequest {
+		req := TokenSendRequest{SendRequest: base, Symbol: "USDT"}
+		req.IdempotencyKey = key
+		mod(&req)
+		return req
+	}
+
+	tests := []struct {
+		name string
+		b    *Builder
+		req  TokenSendRequest
+	}{
+		{"unknown token", newTestTokenBuilder(BuilderConfig{}), withKey("e1", func(r *TokenSendRequest) { r.Symbol = "DOGE" })},
+		{"call data", newTestTokenBuilder(BuilderConfig{}), withKey("e2", func(r *TokenSendRequest) { r.Data = []byte{1} })},
+		{"bad recipient", newTestTokenBuilder(BuilderConfig{}), withKey("e3", func(r *TokenSendRequest) { r.To = "0xto" })},
+		{"UTXO network", newTestTokenBuilder(BuilderConfig{}), withKey("e4", func(r *TokenSendRequest) { r.Network = models.NetworkBTC })},
+		{"no fee limit", newTestTokenBuilder(BuilderConfig{}), withKey("e5", func(r *TokenSendRequest) {
+			r.Network = models.NetworkTRX
+			r.From = "TUEZSdKsoDHQMeZwihtdoBiN46zxhGWYdH"
+			r.To = "TSeJkUh4Qv67VNFwY8LaAxERygNdy6NQZK"
+		})},
+		{"no registry", newTestBuilder(), withKey("e6", func(*TokenSendRequest) {})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.b.SendToken(context.Background(), tt.req); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
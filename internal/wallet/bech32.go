@@ -0,0 +1,205 @@
+package wallet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bech32 (BIP-173) and Bech32m (BIP-350) encoding for native SegWit addresses.
+// Witness v0 addresses use bech32; v1+ (Taproot) use bech32m.
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Checksum constants XORed into the polymod.
+const (
+	bech32Const  uint32 = 1
+	bech32mConst uint32 = 0x2bc830a3
+)
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+func bech32Checksum(hrp string, data []byte, constant uint32) []byte {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := bech32Polymod(values) ^ constant
+	out := make([]byte, 6)
+	for i := range out {
+		out[i] = byte(mod >> (5 * (5 - i)) & 31)
+	}
+	return out
+}
+
+// bech32Encode encodes 5-bit data under hrp with the given checksum constant.
+func bech32Encode(hrp string, data []byte, constant uint32) (string, error) {
+	if len(hrp)+1+len(data)+6 > 90 {
+		return "", fmt.Errorf("bech32: encoded length exceeds 90")
+	}
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range append(data, bech32Checksum(hrp, data, constant)...) {
+		if d >= 32 {
+			return "", fmt.Errorf("bech32: invalid 5-bit value %d", d)
+		}
+		sb.WriteByte(bech32Charset[d])
+	}
+	return sb.String(), nil
+}
+
+// bech32Decode parses a bech32 or bech32m string and returns its lowercase HRP,
+// 5-bit data with the checksum stripped, and the checksum constant that matched.
+func bech32Decode(s string) (hrp string, data []byte, constant uint32, err error) {
+	if len(s) > 90 {
+		return "", nil, 0, fmt.Errorf("bech32: length %d exceeds 90", len(s))
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, fmt.Errorf("bech32: mixed case")
+	}
+	s = strings.ToLower(s)
+	for i := 0; i < len(s); i++ {
+		if s[i] < 33 || s[i] > 126 {
+			return "", nil, 0, fmt.Errorf("bech32: invalid character 0x%02x", s[i])
+		}
+	}
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, 0, fmt.Errorf("bech32: invalid separator position")
+	}
+	hrp = s[:sep]
+	for i := sep + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			return "", nil, 0, fmt.Errorf("bech32: invalid data character %q", s[i])
+		}
+		data = append(data, byte(d))
+	}
+
+	constant = bech32Polymod(append(bech32HRPExpand(hrp), data...))
+	if constant != bech32Const && constant != bech32mConst {
+		return "", nil, 0, fmt.Errorf("bech32: invalid checksum")
+	}
+	return hrp, data[:len(data)-6], constant, nil
+}
+
+// convertBits regroups data from fromBits-wide to toBits-wide values.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	out := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, fmt.Errorf("bech32: invalid value %d for %d-bit group", v, fromBits)
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, fmt.Errorf("bech32: invalid padding")
+	}
+	return out, nil
+}
+
+// segWitConst returns the checksum constant required for a witness version.
+func segWitConst(version byte) uint32 {
+	if version == 0 {
+		return bech32Const
+	}
+	return bech32mConst
+}
+
+// encodeSegWitAddress encodes a witness program as a SegWit address.
+func encodeSegWitAddress(hrp string, version byte, program []byte) (string, error) {
+	if version > 16 {
+		return "", fmt.Errorf("invalid witness version %d", version)
+	}
+	conv, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	addr, err := bech32Encode(hrp, append([]byte{version}, conv...), segWitConst(version))
+	if err != nil {
+		return "", err
+	}
+	if _, _, err := decodeSegWitAddress(hrp, addr); err != nil {
+		return "", err
+	}
+	return addr, nil
+}
+
+// decodeSegWitAddress decodes a SegWit address for the expected HRP into its
+// witness version and program.
+func decodeSegWitAddress(hrp, addr string) (byte, []byte, error) {
+	gotHRP, data, constant, err := bech32Decode(addr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if gotHRP != hrp {
+		return 0, nil, fmt.Errorf("address HRP %q, want %q", gotHRP, hrp)
+	}
+	if len(data) < 1 {
+		return 0, nil, fmt.Errorf("empty witness data")
+	}
+	version := data[0]
+	if version > 16 {
+		return 0, nil, fmt.Errorf("invalid witness version %d", version)
+	}
+	if constant != segWitConst(version) {
+		return 0, nil, fmt.Errorf("wrong checksum variant for witness version %d", version)
+	}
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return 0, nil, fmt.Errorf("invalid witness program length %d", len(program))
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return 0, nil, fmt.Errorf("invalid v0 witness program length %d", len(program))
+	}
+	return version, program, nil
+}
+
+// witnessScript returns the scriptPubKey for a witness program: OP_n <program>.
+func witnessScript(version byte, program []byte) []byte {
+	op := byte(op0)
+	if version > 0 {
+		op = op1 + version - 1
+	}
+	return append([]byte{op, byte(len(program))}, program...)
+}
@@ -5,22 +5,85 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strings"
 
+	"github.com/OKaluzny/wallet-demo/internal/config"
 	"github.com/OKaluzny/wallet-demo/pkg/models"
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil/base58"
 	"golang.org/x/crypto/ripemd160" //nolint:staticcheck // RIPEMD-160 is required by the Bitcoin protocol (Hash160)
 )
 
-// BTCGenerator generates Bitcoin addresses using BIP-44 derivation.
-// Derivation path: m/44'/0'/0'/0/{index}
-// Supports P2PKH (legacy 1...) addresses. Production would also support
-// P2SH-P2WPKH (3...) and native SegWit bech32 (bc1...).
-type BTCGenerator struct{}
+// BTCAddressType selects the output script (and BIP purpose) of generated addresses.
+type BTCAddressType string
+
+// Supported Bitcoin address types.
+const (
+	BTCAddressP2PKH      BTCAddressType = "p2pkh"       // legacy 1..., BIP-44
+	BTCAddressP2SHP2WPKH BTCAddressType = "p2sh-p2wpkh" // nested SegWit 3..., BIP-49
+	BTCAddressP2WPKH     BTCAddressType = "p2wpkh"      // native SegWit bc1q..., BIP-84
+	BTCAddressP2TR       BTCAddressType = "p2tr"        // Taproot bc1p..., BIP-86
+)
+
+// purpose returns the BIP-43 purpose level for the address type.
+func (t BTCAddressType) purpose() (uint32, error) {
+	switch t {
+	case BTCAddressP2PKH:
+		return 44, nil
+	case BTCAddressP2SHP2WPKH:
+		return 49, nil
+	case BTCAddressP2WPKH:
+		return 84, nil
+	case BTCAddressP2TR:
+		return 86, nil
+	default:
+		return 0, fmt.Errorf("unsupported BTC address type %q", t)
+	}
+}
+
+// BTCGenerator generates Bitcoin addresses using BIP-44/49/84/86 derivation.
+// Derivation path: m/{purpose}'/{coin}'/0'/0/{index}, where purpose is 44 for
+// P2PKH (1...), 49 for P2SH-P2WPKH (3...), 84 for native SegWit (bc1q...)
+// and 86 for Taproot (bc1p...), and coin is the network's BIP-44 coin type.
+type BTCGenerator struct {
+	addrType BTCAddressType
+	params   BTCNetParams
+}
+
+// BTCGeneratorOption configures a BTCGenerator.
+type BTCGeneratorOption func(*BTCGenerator)
+
+// WithAddressType selects the address type to generate (default P2PKH).
+func WithAddressType(t BTCAddressType) BTCGeneratorOption {
+	return func(g *BTCGenerator) { g.addrType = t }
+}
+
+// WithNetwork selects the network whose version bytes, HRP and coin type are
+// used (default BTCMainNet).
+func WithNetwork(params BTCNetParams) BTCGeneratorOption {
+	return func(g *BTCGenerator) { g.params = params }
+}
 
 // NewBTCGenerator returns a new Bitcoin address generator.
-func NewBTCGenerator() *BTCGenerator {
-	return &BTCGenerator{}
+func NewBTCGenerator(opts ...BTCGeneratorOption) *BTCGenerator {
+	g := &BTCGenerator{addrType: BTCAddressP2PKH, params: BTCMainNet}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// NewBTCGeneratorFromConfig returns a generator for cfg.BTCNetwork and cfg.BTCAddressType.
+func NewBTCGeneratorFromConfig(cfg config.Config) (*BTCGenerator, error) {
+	params, err := BTCNetParamsByName(cfg.BTCNetwork)
+	if err != nil {
+		return nil, err
+	}
+	addrType := BTCAddressType(cfg.BTCAddressType)
+	if _, err := addrType.purpose(); err != nil {
+		return nil, err
+	}
+	return NewBTCGenerator(WithNetwork(params), WithAddressType(addrType)), nil
 }
 
 // Network returns the Bitcoin network identifier.
@@ -29,21 +92,42 @@ func (g *BTCGenerator) Network() models.Network {
 }
 
 // GenerateFromSeed derives a Bitcoin address from a BIP-39 seed.
-// Uses Hash160 (SHA256 + RIPEMD160) for address generation.
+// Uses Hash160 (SHA256 + RIPEMD160) of the compressed public key.
 func (g *BTCGenerator) GenerateFromSeed(seed []byte, index uint32) (*models.DerivedAddress, error) {
-	path := fmt.Sprintf("m/44'/0'/0'/0/%d", index)
+	purpose, err := g.addrType.purpose()
+	if err != nil {
+		return nil, err
+	}
+	coinType := g.params.CoinType
+	path := fmt.Sprintf("m/%d'/%d'/0'/0/%d", purpose, coinType, index)
 
-	key, err := deriveKey(seed, 0, index)
+	key, err := deriveKeyPath(seed, purpose, coinType, index)
 	if err != nil {
 		return nil, fmt.Errorf("derive key: %w", err)
 	}
 
 	// Get compressed public key via secp256k1
 	pubKey := compressedPubKey(key[:32])
+	pkh := hash160(pubKey)
 
-	// Bitcoin address: Base58Check(0x00 + Hash160(pubKey))
-	hash160 := hash160(pubKey)
-	address := base58CheckEncode(0x00, hash160)
+	var address string
+	switch g.addrType {
+	case BTCAddressP2TR:
+		// bech32m(hrp, witness v1, x-only tweaked output key), no script tree
+		address, err = encodeSegWitAddress(g.params.Bech32HRP, 1, taprootOutputKey(key[:32]))
+	case BTCAddressP2WPKH:
+		// bech32(hrp, witness v0, Hash160(pubKey))
+		address, err = encodeSegWitAddress(g.params.Bech32HRP, 0, pkh)
+	case BTCAddressP2SHP2WPKH:
+		// Base58Check(P2SH version + Hash160(redeemScript)), redeemScript = 0 <Hash160(pubKey)>
+		address = base58CheckEncode(g.params.P2SHVersion, hash160(p2wpkhScript(pkh)))
+	default:
+		// Base58Check(P2PKH version + Hash160(pubKey))
+		address = base58CheckEncode(g.params.P2PKHVersion, pkh)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode address: %w", err)
+	}
 
 	return &models.DerivedAddress{
 		Network:        models.NetworkBTC,
@@ -54,32 +138,153 @@ func (g *BTCGenerator) GenerateFromSeed(seed []byte, index uint32) (*models.Deri
 }
 
 // BTCSigner builds and signs Bitcoin transactions (UTXO model).
-// Production would handle UTXO selection, change addresses, fee estimation.
+// Inputs must be supplied on the transaction; UTXO selection, change and fee
+// computation happen before signing.
 type BTCSigner struct {
-	networkPrefix byte // 0x00 mainnet, 0x6f testnet
+	params BTCNetParams
 }
 
-// NewBTCSigner returns a new Bitcoin transaction signer for mainnet or testnet.
-func NewBTCSigner(mainnet bool) *BTCSigner {
-	prefix := byte(0x00)
-	if !mainnet {
-		prefix = 0x6f
+// NewBTCSigner returns a new Bitcoin transaction signer that pays to addresses
+// of the given network.
+func NewBTCSigner(params BTCNetParams) *BTCSigner {
+	return &BTCSigner{params: params}
+}
+
+// NewBTCSignerFromConfig returns a signer for cfg.BTCNetwork.
+func NewBTCSignerFromConfig(cfg config.Config) (*BTCSigner, error) {
+	params, err := BTCNetParamsByName(cfg.BTCNetwork)
+	if err != nil {
+		return nil, err
 	}
-	return &BTCSigner{networkPrefix: prefix}
+	return NewBTCSigner(params), nil
 }
 
-// Sign signs a Bitcoin transaction using double-SHA256 hashing.
+// btcTxVersion is the version of transactions built by BTCSigner.
+const btcTxVersion = 2
+
+// Sign builds the transaction from tx.Inputs and tx.Outputs (or To/Amount),
+// signs every input with SIGHASH_ALL and sets RawSigned to the wire encoding.
+// TxHash is the txid, which excludes witness data.
 func (s *BTCSigner) Sign(ctx context.Context, tx *models.Transaction, privateKey []byte) (*models.Transaction, error) {
-	rawTx := buildRawBTCTx(tx)
-	txHash := doubleSHA256(rawTx)
+	if len(privateKey) != 32 {
+		return nil, fmt.Errorf("invalid private key length %d, want 32", len(privateKey))
+	}
+
+	btx, err := s.buildTx(tx)
+	if err != nil {
+		return nil, fmt.Errorf("build: %w", err)
+	}
+	for i := range btx.Inputs {
+		if err := btx.SignInput(i, privateKey); err != nil {
+			return nil, fmt.Errorf("sign: %w", err)
+		}
+	}
+
+	raw, err := btx.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("serialize: %w", err)
+	}
+	txid, err := btx.TxID()
+	if err != nil {
+		return nil, fmt.Errorf("txid: %w", err)
+	}
 
-	tx.TxHash = hex.EncodeToString(txHash)
+	tx.TxHash = txid
 	tx.Signed = true
-	tx.RawSigned = rawTx
+	tx.RawSigned = raw
 
 	return tx, nil
 }
 
+// buildTx converts a generic transaction into an unsigned BTCTx.
+func (s *BTCSigner) buildTx(tx *models.Transaction) (*BTCTx, error) {
+	if len(tx.Inputs) == 0 {
+		return nil, fmt.Errorf("transaction has no inputs")
+	}
+	outputs := tx.Outputs
+	if len(outputs) == 0 {
+		outputs = []models.TxOutput{{Address: tx.To, Amount: tx.Amount}}
+	}
+
+	btx := &BTCTx{Version: btcTxVersion}
+	var totalIn, totalOut int64
+	for _, u := range tx.Inputs {
+		if u.Amount == nil || !u.Amount.IsInt64() || u.Amount.Sign() <= 0 {
+			return nil, fmt.Errorf("input %s:%d: invalid amount", u.TxID, u.Vout)
+		}
+		btx.Inputs = append(btx.Inputs, &BTCTxIn{
+			PrevOut:          BTCOutPoint{TxID: u.TxID, Vout: u.Vout},
+			Sequence:         0xffffffff,
+			PrevScriptPubKey: u.ScriptPubKey,
+			PrevValue:        u.Amount.Int64(),
+		})
+		totalIn += u.Amount.Int64()
+	}
+	for _, o := range outputs {
+		if o.Amount == nil || !o.Amount.IsInt64() || o.Amount.Sign() <= 0 {
+			return nil, fmt.Errorf("output %s: invalid amount", o.Address)
+		}
+		script, err := s.addressScript(o.Address)
+		if err != nil {
+			return nil, err
+		}
+		btx.Outputs = append(btx.Outputs, &BTCTxOut{Value: o.Amount.Int64(), ScriptPubKey: script})
+		totalOut += o.Amount.Int64()
+	}
+	if totalOut > totalIn {
+		return nil, fmt.Errorf("outputs (%d) exceed inputs (%d)", totalOut, totalIn)
+	}
+	return btx, nil
+}
+
+// addressScript returns the scriptPubKey paying to a Base58Check or SegWit (v0/v1) address.
+func (s *BTCSigner) addressScript(address string) ([]byte, error) {
+	return addressScript(s.params, address)
+}
+
+// BTCAddressScript returns the scriptPubKey paying to a Base58Check or SegWit
+// (v0/v1) address of any supported Bitcoin network.
+func BTCAddressScript(address string) ([]byte, error) {
+	var firstErr error
+	for _, params := range []BTCNetParams{BTCMainNet, BTCTestNet3, BTCRegTest} {
+		script, err := addressScript(params, address)
+		if err == nil {
+			return script, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+func addressScript(params BTCNetParams, address string) ([]byte, error) {
+	hrp := params.Bech32HRP
+	if strings.HasPrefix(strings.ToLower(address), hrp+"1") {
+		version, program, err := decodeSegWitAddress(hrp, address)
+		if err != nil {
+			return nil, fmt.Errorf("decode address %q: %w", address, err)
+		}
+		return witnessScript(version, program), nil
+	}
+
+	payload, version, err := base58.CheckDecode(address)
+	if err != nil {
+		return nil, fmt.Errorf("decode address %q: %w", address, err)
+	}
+	if len(payload) != 20 {
+		return nil, fmt.Errorf("address %q: invalid payload length %d", address, len(payload))
+	}
+	switch version {
+	case params.P2PKHVersion:
+		return p2pkhScript(payload), nil
+	case params.P2SHVersion:
+		return p2shScript(payload), nil
+	default:
+		return nil, fmt.Errorf("address %q: version 0x%02x not valid for this network", address, version)
+	}
+}
+
 // --- helpers ---
 
 func compressedPubKey(privKeyBytes []byte) []byte {
@@ -116,15 +321,3 @@ func base58CheckEncode(version byte, payload []byte) string {
 func base58Encode(input []byte) string {
 	return base58.Encode(input)
 }
-
-func buildRawBTCTx(tx *models.Transaction) []byte {
-	// Simplified transaction serialization
-	// Production: proper serialization with version, locktime, witness data
-	var raw []byte
-	raw = append(raw, []byte{0x01, 0x00, 0x00, 0x00}...) // version
-	raw = append(raw, []byte(tx.From)...)
-	raw = append(raw, []byte(tx.To)...)
-	raw = append(raw, tx.Amount.Bytes()...)
-	raw = append(raw, []byte{0x00, 0x00, 0x00, 0x00}...) // locktime
-	return raw
-}
@@ -0,0 +1,450 @@
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/internal/config"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// bip143P2WPKHTx returns the unsigned "Native P2WPKH" example transaction from BIP-143.
+func bip143P2WPKHTx(t *testing.T) *BTCTx {
+	t.Helper()
+	return &BTCTx{
+		Version: 1,
+		Inputs: []*BTCTxIn{
+			{
+				PrevOut:          BTCOutPoint{TxID: "9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff", Vout: 0},
+				Sequence:         0xffffffee,
+				PrevScriptPubKey: mustHex(t, "2103c9f4836b9a4f77fc0d81f7bcb01b7f1b35916864b9476c241ce9fc198bd25432ac"),
+				PrevValue:        625_000_000,
+			},
+			{
+				PrevOut:          BTCOutPoint{TxID: "8ac60eb9575db5b2d987e29f301b5b819ea83a5c6579d282d189cc04b8e151ef", Vout: 1},
+				Sequence:         0xffffffff,
+				PrevScriptPubKey: mustHex(t, "00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1"),
+				PrevValue:        600_000_000,
+			},
+		},
+		Outputs: []*BTCTxOut{
+			{Value: 112_340_000, ScriptPubKey: mustHex(t, "76a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac")},
+			{Value: 223_450_000, ScriptPubKey: mustHex(t, "76a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac")},
+		},
+		LockTime: 17,
+	}
+}
+
+func TestBTCTx_BIP143Vector(t *testing.T) {
+	btx := bip143P2WPKHTx(t)
+
+	unsigned, err := btx.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUnsigned := "0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffff" +
+		"ef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff" +
+		"02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac" +
+		"9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000"
+	if got := hex.EncodeToString(unsigned); got != wantUnsigned {
+		t.Fatalf("unsigned tx = %s\nwant         %s", got, wantUnsigned)
+	}
+
+	sigHash, err := btx.WitnessV0SigHash(1, p2pkhScript(mustHex(t, "1d0f172a0ecb48aee1be1f2687d2963ae33f71a1")), 600_000_000, sigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(sigHash); got != "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670" {
+		t.Errorf("BIP-143 sighash = %s", got)
+	}
+
+	if err := btx.SignInput(0, mustHex(t, "bbc27228ddcb9209d7fd6f36b02f7dfa6252af40bb2f1cbc7a557da8027ff866")); err != nil {
+		t.Fatal(err)
+	}
+	if err := btx.SignInput(1, mustHex(t, "619c335025c7f4012e556c2a58b2506e30b8511b53ade95ea316fd8c3286feb9")); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := btx.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSigned := "01000000000102fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f00000000" +
+		"494830450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194ba3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed01eeffffff" +
+		"ef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff" +
+		"02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac" +
+		"9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac" +
+		"000247304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc44a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee" +
+		"0121025476c2e83188368da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeee635711000000"
+	if got := hex.EncodeToString(signed); got != wantSigned {
+		t.Errorf("signed tx = %s\nwant       %s", got, wantSigned)
+	}
+}
+
+// TestBTCTx_TxID checks txid computation against the first Bitcoin transaction
+// between two people (block 170).
+func TestBTCTx_TxID(t *testing.T) {
+	btx := &BTCTx{
+		Version: 1,
+		Inputs: []*BTCTxIn{{
+			PrevOut: BTCOutPoint{TxID: "0437cd7f8525ceed2324359c2d0ba26006d92d856a9c20fa0241106ee5a597c9", Vout: 0},
+			ScriptSig: mustHex(t, "47304402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd41"+
+				"0220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901"),
+			Sequence: 0xffffffff,
+		}},
+		Outputs: []*BTCTxOut{
+			{Value: 1_000_000_000, ScriptPubKey: mustHex(t, "4104ae1a62fe09c5f51b13905f07f06b99a2f7159b2225f374cd378d71302fa28414e7aab37397f554a7df5f142c21c1b7303b8a0626f1baded5c72a704f7e6cd84cac")},
+			{Value: 4_000_000_000, ScriptPubKey: mustHex(t, "410411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3ac")},
+		},
+	}
+
+	txid, err := btx.TxID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txid != "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" {
+		t.Errorf("txid = %s", txid)
+	}
+}
+
+func TestBTCSigner_SignP2PKH(t *testing.T) {
+	key := testPrivateKey(t, 0)
+	pkh := hash160(compressedPubKey(key))
+	from := base58CheckEncode(0x00, pkh)
+
+	tx := &models.Transaction{
+		Network: models.NetworkBTC,
+		From:    from,
+		Outputs: []models.TxOutput{
+			{Address: "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", Amount: big.NewInt(40_000)},
+			{Address: from, Amount: big.NewInt(9_000)},
+		},
+		Inputs: []models.UTXO{{
+			TxID:         "9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff",
+			Amount:       big.NewInt(50_000),
+			ScriptPubKey: p2pkhScript(pkh),
+		}},
+	}
+
+	signed, err := NewBTCSigner(BTCMainNet).Sign(context.Background(), tx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := hex.EncodeToString(signed.RawSigned)
+	if raw[8:12] == "0001" {
+		t.Error("legacy-only transaction must not carry a witness marker")
+	}
+	// P2SH output script for the 3... recipient
+	if want := "17a914b472a266d0bd89c13706a4132ccfb16f7c3b9fcb87"; !containsHex(raw, want) {
+		t.Errorf("missing P2SH output script %s in %s", want, raw)
+	}
+	if len(signed.TxHash) != 64 {
+		t.Errorf("txid should be 64 hex chars, got %q", signed.TxHash)
+	}
+}
+
+func TestBTCSigner_Errors(t *testing.T) {
+	key := testPrivateKey(t, 0)
+	pkh := hash160(compressedPubKey(key))
+	input := models.UTXO{
+		TxID:         "9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff",
+		Amount:       big.NewInt(1_000),
+		ScriptPubKey: p2pkhScript(pkh),
+	}
+	to := base58CheckEncode(0x00, pkh)
+
+	tests := []struct {
+		name string
+		tx   *models.Transaction
+	}{
+		{"no inputs", &models.Transaction{To: to, Amount: big.NewInt(100)}},
+		{"overspend", &models.Transaction{To: to, Amount: big.NewInt(2_000), Inputs: []models.UTXO{input}}},
+		{"testnet address", &models.Transaction{To: base58CheckEncode(0x6f, pkh), Amount: big.NewInt(100), Inputs: []models.UTXO{input}}},
+		{"foreign key", &models.Transaction{To: to, Amount: big.NewInt(100), Inputs: []models.UTXO{{
+			TxID: input.TxID, Amount: input.Amount, ScriptPubKey: p2pkhScript(make([]byte, 20)),
+		}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewBTCSigner(BTCMainNet).Sign(context.Background(), tt.tx, key); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func containsHex(haystack, needle string) bool {
+	for i := 0; i+len(needle) <= len(haystack); i += 2 {
+		if haystack[i:i+len(needle)] == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBech32_BIP173Valid(t *testing.T) {
+	valid := []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"11" + strings.Repeat("q", 82) + "c8247j",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	}
+	for _, s := range valid {
+		hrp, data, constant, err := bech32Decode(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		// Re-encoding must reproduce the (lowercased) input.
+		enc, err := bech32Encode(hrp, data, constant)
+		if err != nil {
+			t.Errorf("%s: re-encode: %v", s, err)
+			continue
+		}
+		if enc != strings.ToLower(s) {
+			t.Errorf("re-encode = %s, want %s", enc, strings.ToLower(s))
+		}
+	}
+}
+
+func TestBech32_BIP173Invalid(t *testing.T) {
+	invalid := []string{
+		"\x201nwldj5", // HRP character out of range
+		"\x7f1axkwrx", // HRP character out of range
+		"\x801eym55h", // HRP character out of range
+		"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx", // overall max length exceeded
+		"pzry9x0s0muk",  // no separator
+		"1pzry9x0s0muk", // empty HRP
+		"x1b4n0q5v",     // invalid data character
+		"li1dgmt3",      // too short checksum
+		"de1lg7wt\xff",  // invalid character in checksum
+		"A1G7SGD8",      // checksum calculated with uppercase HRP
+		"10a06t8",       // empty HRP
+		"1qzzfhee",      // empty HRP
+	}
+	for _, s := range invalid {
+		if _, _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestSegWitAddress_BIP173(t *testing.T) {
+	tests := []struct {
+		hrp, addr, script string
+	}{
+		{"bc", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"tb", "tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", "0020000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+	}
+	for _, tt := range tests {
+		version, program, err := decodeSegWitAddress(tt.hrp, tt.addr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.addr, err)
+			continue
+		}
+		script := hex.EncodeToString(witnessScript(version, program))
+		if script != tt.script {
+			t.Errorf("%s: script = %s, want %s", tt.addr, script, tt.script)
+		}
+		enc, err := encodeSegWitAddress(tt.hrp, version, program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enc != strings.ToLower(tt.addr) {
+			t.Errorf("encode = %s, want %s", enc, strings.ToLower(tt.addr))
+		}
+	}
+
+	invalid := []struct{ hrp, addr string }{
+		{"bc", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7"}, // wrong HRP
+		{"bc", "bc1rw5uspcuh"},                                                   // invalid program length
+		{"bc", "BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P"},                           // invalid v0 program length
+		{"tb", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sL5k7"}, // mixed case
+		{"bc", "bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du"},                          // zero padding of more than 4 bits
+		{"tb", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3pjxtptv"}, // non-zero padding
+	}
+	for _, tt := range invalid {
+		if _, _, err := decodeSegWitAddress(tt.hrp, tt.addr); err == nil {
+			t.Errorf("%s: expected error", tt.addr)
+		}
+	}
+}
+
+func TestBTCGenerator_AddressTypes(t *testing.T) {
+	seed := testSeed(t)
+	tests := []struct {
+		addrType BTCAddressType
+		path     string
+		address  string
+	}{
+		// BIP-44, BIP-49 and BIP-84 reference addresses for "abandon ... about".
+		{BTCAddressP2PKH, "m/44'/0'/0'/0/0", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{BTCAddressP2SHP2WPKH, "m/49'/0'/0'/0/0", "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+		{BTCAddressP2WPKH, "m/84'/0'/0'/0/0", "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.addrType), func(t *testing.T) {
+			addr, err := NewBTCGenerator(WithAddressType(tt.addrType)).GenerateFromSeed(seed, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr.DerivationPath != tt.path {
+				t.Errorf("path = %s, want %s", addr.DerivationPath, tt.path)
+			}
+			if addr.Address != tt.address {
+				t.Errorf("address = %s, want %s", addr.Address, tt.address)
+			}
+		})
+	}
+
+	if _, err := NewBTCGenerator(WithAddressType("p2wsh")).GenerateFromSeed(seed, 0); err == nil {
+		t.Error("expected error for unsupported address type")
+	}
+}
+
+func TestBTCGenerator_Networks(t *testing.T) {
+	seed := testSeed(t)
+	tests := []struct {
+		params   BTCNetParams
+		addrType BTCAddressType
+		path     string
+		address  string
+	}{
+		// Testnet reference addresses for "abandon ... about" (coin type 1).
+		{BTCTestNet3, BTCAddressP2PKH, "m/44'/1'/0'/0/0", "mkpZhYtJu2r87Js3pDiWJDmPte2NRZ8bJV"},
+		{BTCTestNet3, BTCAddressP2SHP2WPKH, "m/49'/1'/0'/0/0", "2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2"},
+		{BTCTestNet3, BTCAddressP2WPKH, "m/84'/1'/0'/0/0", "tb1q6rz28mcfaxtmd6v789l9rrlrusdprr9pqcpvkl"},
+		{BTCSigNet, BTCAddressP2WPKH, "m/84'/1'/0'/0/0", "tb1q6rz28mcfaxtmd6v789l9rrlrusdprr9pqcpvkl"},
+		{BTCRegTest, BTCAddressP2WPKH, "m/84'/1'/0'/0/0", "bcrt1q6rz28mcfaxtmd6v789l9rrlrusdprr9pz3cppk"},
+		{BTCRegTest, BTCAddressP2TR, "m/86'/1'/0'/0/0", "bcrt1p8wpt9v4frpf3tkn0srd97pksgsxc5hs52lafxwru9kgeephvs7rqjeprhg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.params.Name+"/"+string(tt.addrType), func(t *testing.T) {
+			gen := NewBTCGenerator(WithNetwork(tt.params), WithAddressType(tt.addrType))
+			addr, err := gen.GenerateFromSeed(seed, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr.DerivationPath != tt.path {
+				t.Errorf("path = %s, want %s", addr.DerivationPath, tt.path)
+			}
+			if addr.Address != tt.address {
+				t.Errorf("address = %s, want %s", addr.Address, tt.address)
+			}
+		})
+	}
+}
+
+func TestBTCNetParams_FromConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.BTCNetwork = "testnet3"
+	cfg.BTCAddressType = string(BTCAddressP2PKH)
+
+	gen, err := NewBTCGeneratorFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := gen.GenerateFromSeed(testSeed(t), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.Address != "mkpZhYtJu2r87Js3pDiWJDmPte2NRZ8bJV" {
+		t.Errorf("address = %s, want testnet P2PKH", addr.Address)
+	}
+
+	signer, err := NewBTCSignerFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A testnet signer must accept testnet addresses and reject mainnet ones.
+	if _, err := signer.addressScript("2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2"); err != nil {
+		t.Errorf("testnet P2SH: %v", err)
+	}
+	if _, err := signer.addressScript("tb1q6rz28mcfaxtmd6v789l9rrlrusdprr9pqcpvkl"); err != nil {
+		t.Errorf("testnet bech32: %v", err)
+	}
+	for _, mainnet := range []string{"1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"} {
+		if _, err := signer.addressScript(mainnet); err == nil {
+			t.Errorf("%s: expected error on testnet", mainnet)
+		}
+	}
+
+	cfg.BTCNetwork = "litecoin"
+	if _, err := NewBTCGeneratorFromConfig(cfg); err == nil {
+		t.Error("expected error for unknown network")
+	}
+	if _, err := NewBTCSignerFromConfig(cfg); err == nil {
+		t.Error("expected error for unknown network")
+	}
+}
+
+// TestBTCTx_BIP143NestedP2WPKH checks the "P2SH-P2WPKH" example from BIP-143.
+func TestBTCTx_BIP143NestedP2WPKH(t *testing.T) {
+	btx := &BTCTx{
+		Version: 1,
+		Inputs: []*BTCTxIn{{
+			PrevOut:          BTCOutPoint{TxID: "77541aeb3c4dac9260b68f74f44c973081a9d4cb2ebe8038b2d70faa201b6bdb", Vout: 1},
+			Sequence:         0xfffffffe,
+			PrevScriptPubKey: mustHex(t, "a9144733f37cf4db86fbc2efed2500b4f4e49f31202387"),
+			PrevValue:        1_000_000_000,
+		}},
+		Outputs: []*BTCTxOut{
+			{Value: 199_996_600, ScriptPubKey: mustHex(t, "76a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac")},
+			{Value: 800_000_000, ScriptPubKey: mustHex(t, "76a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac")},
+		},
+		LockTime: 1170,
+	}
+
+	if err := btx.SignInput(0, mustHex(t, "eb696a065ef48a2192da5b28b694f87544b30fae8327c4510137a922f32c6dcf")); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := btx.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "01000000000101db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a5477010000001716001479091972186c449eb1ded22b78e40d009bdf0089feffffff" +
+		"02b8b4eb0b000000001976a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac0008af2f000000001976a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac" +
+		"02473044022047ac8e878352d3ebbde1c94ce3a10d057c24175747116f8288e5d794d12d482f0220217f36a485cae903c713331d877c1f64677e3622ad4010726870540656fe9dcb01" +
+		"2103ad1d8e89212f0b92c74d23bb710c00662ad1470198ac48c43f7d6f93a2a2687392040000"
+	if got := hex.EncodeToString(signed); got != want {
+		t.Errorf("signed tx = %s\nwant       %s", got, want)
+	}
+}
+
+func TestBTCSigner_Bech32Output(t *testing.T) {
+	key := testPrivateKey(t, 0)
+	pkh := hash160(compressedPubKey(key))
+	tx := &models.Transaction{
+		To:     "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Amount: big.NewInt(40_000),
+		Inputs: []models.UTXO{{
+			TxID:         "9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff",
+			Amount:       big.NewInt(50_000),
+			ScriptPubKey: p2wpkhScript(pkh),
+		}},
+	}
+	signed, err := NewBTCSigner(BTCMainNet).Sign(context.Background(), tx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := hex.EncodeToString(signed.RawSigned)
+	if raw[8:12] != "0001" {
+		t.Error("P2WPKH spend must carry the BIP-144 witness marker")
+	}
+	if !containsHex(raw, "160014751e76e8199196d454941c45d1b3a323f1433bd6") {
+		t.Errorf("missing P2WPKH output script in %s", raw)
+	}
+
+	tx.To = "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"
+	if _, err := NewBTCSigner(BTCMainNet).Sign(context.Background(), tx, key); err == nil {
+		t.Error("expected error for testnet address on mainnet signer")
+	}
+}
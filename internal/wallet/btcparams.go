@@ -0,0 +1,38 @@
+package wallet
+
+import "fmt"
+
+// BTCNetParams holds the per-network constants used to derive keys and encode
+// Bitcoin addresses.
+type BTCNetParams struct {
+	Name         string
+	P2PKHVersion byte   // Base58Check version of pay-to-pubkey-hash addresses
+	P2SHVersion  byte   // Base58Check version of pay-to-script-hash addresses
+	Bech32HRP    string // human-readable part of SegWit addresses
+	CoinType     uint32 // BIP-44 coin type: 0 on mainnet, 1 on all test networks
+}
+
+// Supported Bitcoin networks.
+var (
+	BTCMainNet  = BTCNetParams{Name: "mainnet", P2PKHVersion: 0x00, P2SHVersion: 0x05, Bech32HRP: "bc", CoinType: 0}
+	BTCTestNet3 = BTCNetParams{Name: "testnet3", P2PKHVersion: 0x6f, P2SHVersion: 0xc4, Bech32HRP: "tb", CoinType: 1}
+	BTCSigNet   = BTCNetParams{Name: "signet", P2PKHVersion: 0x6f, P2SHVersion: 0xc4, Bech32HRP: "tb", CoinType: 1}
+	BTCRegTest  = BTCNetParams{Name: "regtest", P2PKHVersion: 0x6f, P2SHVersion: 0xc4, Bech32HRP: "bcrt", CoinType: 1}
+)
+
+// BTCNetParamsByName returns the parameters for a network name as used in
+// config.Config.BTCNetwork: "mainnet", "testnet3" (or "testnet"), "signet" or "regtest".
+func BTCNetParamsByName(name string) (BTCNetParams, error) {
+	switch name {
+	case "mainnet", "":
+		return BTCMainNet, nil
+	case "testnet3", "testnet":
+		return BTCTestNet3, nil
+	case "signet":
+		return BTCSigNet, nil
+	case "regtest":
+		return BTCRegTest, nil
+	default:
+		return BTCNetParams{}, fmt.Errorf("unknown BTC network %q", name)
+	}
+}
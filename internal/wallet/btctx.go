@@ -0,0 +1,383 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// sigHashAll is the only signature hash type produced by BTCSigner.
+const sigHashAll uint32 = 0x01
+
+// Script opcodes used by the standard output templates.
+const (
+	opDup         = 0x76
+	opHash160     = 0xa9
+	opEqual       = 0x87
+	opEqualVerify = 0x88
+	opCheckSig    = 0xac
+	op0           = 0x00
+	op1           = 0x51
+)
+
+// BTCOutPoint references an output of a previous transaction.
+type BTCOutPoint struct {
+	TxID string // display (big-endian) hex, as shown by explorers and RPC
+	Vout uint32
+}
+
+// BTCTxIn is a transaction input together with the data needed to sign it.
+type BTCTxIn struct {
+	PrevOut   BTCOutPoint
+	ScriptSig []byte
+	Witness   [][]byte
+	Sequence  uint32
+
+	// Spent output, required for signing (BIP-143 commits to the value).
+	PrevScriptPubKey []byte
+	PrevValue        int64
+}
+
+// BTCTxOut is a transaction output.
+type BTCTxOut struct {
+	Value        int64
+	ScriptPubKey []byte
+}
+
+// BTCTx is a Bitcoin transaction in wire format terms.
+type BTCTx struct {
+	Version  int32
+	Inputs   []*BTCTxIn
+	Outputs  []*BTCTxOut
+	LockTime uint32
+}
+
+// HasWitness reports whether any input carries witness data.
+func (t *BTCTx) HasWitness() bool {
+	for _, in := range t.Inputs {
+		if len(in.Witness) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Serialize returns the canonical wire encoding, including the BIP-144
+// marker, flag and witness stacks when any input has witness data.
+func (t *BTCTx) Serialize() ([]byte, error) {
+	return t.serialize(t.HasWitness())
+}
+
+// SerializeNoWitness returns the legacy encoding used for txid computation.
+func (t *BTCTx) SerializeNoWitness() ([]byte, error) {
+	return t.serialize(false)
+}
+
+// TxID returns the transaction id: double-SHA256 of the non-witness
+// serialization, byte-reversed to display order.
+func (t *BTCTx) TxID() (string, error) {
+	raw, err := t.SerializeNoWitness()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(reverseBytes(doubleSHA256(raw))), nil
+}
+
+func (t *BTCTx) serialize(witness bool) ([]byte, error) {
+	var buf bytes.Buffer
+	writeUint32(&buf, uint32(t.Version))
+	if witness {
+		buf.Write([]byte{0x00, 0x01}) // BIP-144 marker and flag
+	}
+
+	writeVarInt(&buf, uint64(len(t.Inputs)))
+	for _, in := range t.Inputs {
+		if err := writeOutPoint(&buf, in.PrevOut); err != nil {
+			return nil, err
+		}
+		writeVarBytes(&buf, in.ScriptSig)
+		writeUint32(&buf, in.Sequence)
+	}
+
+	writeVarInt(&buf, uint64(len(t.Outputs)))
+	for _, out := range t.Outputs {
+		writeTxOut(&buf, out)
+	}
+
+	if witness {
+		for _, in := range t.Inputs {
+			writeVarInt(&buf, uint64(len(in.Witness)))
+			for _, item := range in.Witness {
+				writeVarBytes(&buf, item)
+			}
+		}
+	}
+
+	writeUint32(&buf, t.LockTime)
+	return buf.Bytes(), nil
+}
+
+// LegacySigHash computes the pre-SegWit signature hash for input idx,
+// with subScript standing in for that input's scriptSig.
+func (t *BTCTx) LegacySigHash(idx int, subScript []byte, hashType uint32) ([]byte, error) {
+	if idx < 0 || idx >= len(t.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	if hashType != sigHashAll {
+		return nil, fmt.Errorf("unsupported sighash type 0x%x", hashType)
+	}
+
+	cp := &BTCTx{Version: t.Version, Outputs: t.Outputs, LockTime: t.LockTime}
+	for i, in := range t.Inputs {
+		c := &BTCTxIn{PrevOut: in.PrevOut, Sequence: in.Sequence}
+		if i == idx {
+			c.ScriptSig = subScript
+		}
+		cp.Inputs = append(cp.Inputs, c)
+	}
+
+	raw, err := cp.SerializeNoWitness()
+	if err != nil {
+		return nil, err
+	}
+	raw = binary.LittleEndian.AppendUint32(raw, hashType)
+	return doubleSHA256(raw), nil
+}
+
+// WitnessV0SigHash computes the BIP-143 signature hash for SegWit v0 input idx.
+func (t *BTCTx) WitnessV0SigHash(idx int, scriptCode []byte, value int64, hashType uint32) ([]byte, error) {
+	if idx < 0 || idx >= len(t.Inputs) {
+		return nil, fmt.Errorf("input index %d out of range", idx)
+	}
+	if hashType != sigHashAll {
+		return nil, fmt.Errorf("unsupported sighash type 0x%x", hashType)
+	}
+
+	var prevouts, sequences, outputs bytes.Buffer
+	for _, in := range t.Inputs {
+		if err := writeOutPoint(&prevouts, in.PrevOut); err != nil {
+			return nil, err
+		}
+		writeUint32(&sequences, in.Sequence)
+	}
+	for _, out := range t.Outputs {
+		writeTxOut(&outputs, out)
+	}
+
+	in := t.Inputs[idx]
+	var buf bytes.Buffer
+	writeUint32(&buf, uint32(t.Version))
+	buf.Write(doubleSHA256(prevouts.Bytes()))
+	buf.Write(doubleSHA256(sequences.Bytes()))
+	if err := writeOutPoint(&buf, in.PrevOut); err != nil {
+		return nil, err
+	}
+	writeVarBytes(&buf, scriptCode)
+	writeUint64(&buf, uint64(value))
+	writeUint32(&buf, in.Sequence)
+	buf.Write(doubleSHA256(outputs.Bytes()))
+	writeUint32(&buf, t.LockTime)
+	writeUint32(&buf, hashType)
+
+	return doubleSHA256(buf.Bytes()), nil
+}
+
+// SignInput signs input idx with SIGHASH_ALL, choosing legacy or BIP-143
+// hashing from the spent output's script type, and fills in ScriptSig/Witness.
+// Supported spent outputs: P2PK, P2PKH, P2WPKH, P2SH-P2WPKH and BIP-86 P2TR
+// (key path, BIP-341 hashing with SIGHASH_DEFAULT).
+func (t *BTCTx) SignInput(idx int, privateKey []byte) error {
+	if idx < 0 || idx >= len(t.Inputs) {
+		return fmt.Errorf("input index %d out of range", idx)
+	}
+	in := t.Inputs[idx]
+	key, pub := btcec.PrivKeyFromBytes(privateKey)
+	pubKey := pub.SerializeCompressed()
+	script := in.PrevScriptPubKey
+
+	switch {
+	case isP2TR(script):
+		tweaked := taprootTweakPrivKey(privateKey)
+		if !bytes.Equal(script[2:34], taprootOutputKey(privateKey)) {
+			return fmt.Errorf("input %d: key does not match P2TR output", idx)
+		}
+		hash, err := t.TaprootSigHash(idx, sigHashDefault)
+		if err != nil {
+			return err
+		}
+		sig, err := schnorrSign(tweaked, hash)
+		if err != nil {
+			return err
+		}
+		in.ScriptSig = nil
+		in.Witness = [][]byte{sig}
+
+	case isP2WPKH(script):
+		if !bytes.Equal(script[2:22], hash160(pubKey)) {
+			return fmt.Errorf("input %d: key does not match P2WPKH output", idx)
+		}
+		hash, err := t.WitnessV0SigHash(idx, p2pkhScript(script[2:22]), in.PrevValue, sigHashAll)
+		if err != nil {
+			return err
+		}
+		in.ScriptSig = nil
+		in.Witness = [][]byte{derSignature(key, hash), pubKey}
+
+	case isP2SH(script):
+		// Only nested P2WPKH is supported: redeemScript = 0 <Hash160(pubKey)>.
+		redeem := p2wpkhScript(hash160(pubKey))
+		if !bytes.Equal(script[2:22], hash160(redeem)) {
+			return fmt.Errorf("input %d: key does not match P2SH-P2WPKH output", idx)
+		}
+		hash, err := t.WitnessV0SigHash(idx, p2pkhScript(redeem[2:]), in.PrevValue, sigHashAll)
+		if err != nil {
+			return err
+		}
+		in.ScriptSig = pushData(redeem)
+		in.Witness = [][]byte{derSignature(key, hash), pubKey}
+
+	case isP2PKH(script):
+		if !bytes.Equal(script[3:23], hash160(pubKey)) {
+			return fmt.Errorf("input %d: key does not match P2PKH output", idx)
+		}
+		hash, err := t.LegacySigHash(idx, script, sigHashAll)
+		if err != nil {
+			return err
+		}
+		in.ScriptSig = pushData(derSignature(key, hash), pubKey)
+
+	case isP2PK(script):
+		if !bytes.Equal(script[1:len(script)-1], pubKey) &&
+			!bytes.Equal(script[1:len(script)-1], pub.SerializeUncompressed()) {
+			return fmt.Errorf("input %d: key does not match P2PK output", idx)
+		}
+		hash, err := t.LegacySigHash(idx, script, sigHashAll)
+		if err != nil {
+			return err
+		}
+		in.ScriptSig = pushData(derSignature(key, hash))
+
+	default:
+		return fmt.Errorf("input %d: unsupported script %x", idx, script)
+	}
+	return nil
+}
+
+// --- scripts ---
+
+func p2pkhScript(pubKeyHash []byte) []byte {
+	s := []byte{opDup, opHash160, 20}
+	s = append(s, pubKeyHash...)
+	return append(s, opEqualVerify, opCheckSig)
+}
+
+func p2shScript(scriptHash []byte) []byte {
+	s := []byte{opHash160, 20}
+	s = append(s, scriptHash...)
+	return append(s, opEqual)
+}
+
+func p2wpkhScript(pubKeyHash []byte) []byte {
+	return append([]byte{op0, 20}, pubKeyHash...)
+}
+
+func isP2PKH(s []byte) bool {
+	return len(s) == 25 && s[0] == opDup && s[1] == opHash160 && s[2] == 20 &&
+		s[23] == opEqualVerify && s[24] == opCheckSig
+}
+
+func isP2SH(s []byte) bool {
+	return len(s) == 23 && s[0] == opHash160 && s[1] == 20 && s[22] == opEqual
+}
+
+func isP2WPKH(s []byte) bool {
+	return len(s) == 22 && s[0] == op0 && s[1] == 20
+}
+
+func isP2TR(s []byte) bool {
+	return len(s) == 34 && s[0] == op1 && s[1] == 32
+}
+
+func isP2PK(s []byte) bool {
+	return (len(s) == 35 && s[0] == 33 || len(s) == 67 && s[0] == 65) && s[len(s)-1] == opCheckSig
+}
+
+// pushData builds a script pushing each item (items must be under 76 bytes).
+func pushData(items ...[]byte) []byte {
+	var s []byte
+	for _, item := range items {
+		s = append(s, byte(len(item)))
+		s = append(s, item...)
+	}
+	return s
+}
+
+// derSignature signs hash and returns the DER signature with the SIGHASH_ALL byte appended.
+func derSignature(key *btcec.PrivateKey, hash []byte) []byte {
+	return append(ecdsa.Sign(key, hash).Serialize(), byte(sigHashAll))
+}
+
+// --- wire encoding ---
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
+
+// writeVarInt writes a Bitcoin CompactSize integer.
+func writeVarInt(buf *bytes.Buffer, v uint64) {
+	switch {
+	case v < 0xfd:
+		buf.WriteByte(byte(v))
+	case v <= 0xffff:
+		buf.WriteByte(0xfd)
+		var b [2]byte
+		binary.LittleEndian.PutUint16(b[:], uint16(v))
+		buf.Write(b[:])
+	case v <= 0xffffffff:
+		buf.WriteByte(0xfe)
+		writeUint32(buf, uint32(v))
+	default:
+		buf.WriteByte(0xff)
+		writeUint64(buf, v)
+	}
+}
+
+func writeVarBytes(buf *bytes.Buffer, b []byte) {
+	writeVarInt(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+func writeOutPoint(buf *bytes.Buffer, op BTCOutPoint) error {
+	txid, err := hex.DecodeString(op.TxID)
+	if err != nil || len(txid) != 32 {
+		return fmt.Errorf("invalid outpoint txid %q", op.TxID)
+	}
+	buf.Write(reverseBytes(txid))
+	writeUint32(buf, op.Vout)
+	return nil
+}
+
+func writeTxOut(buf *bytes.Buffer, out *BTCTxOut) {
+	writeUint64(buf, uint64(out.Value))
+	writeVarBytes(buf, out.ScriptPubKey)
+}
+
+func reverseBytes(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[i] = b[len(b)-1-i]
+	}
+	return r
+}
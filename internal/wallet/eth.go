@@ -5,9 +5,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/OKaluzny/wallet-demo/pkg/models"
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
 	"github.com/tyler-smith/go-bip32"
 	"golang.org/x/crypto/sha3"
 )
@@ -63,55 +65,144 @@ func NewETHSigner(chainID int64) *ETHSigner {
 	return &ETHSigner{chainID: big.NewInt(chainID)}
 }
 
-// Sign signs an Ethereum transaction with EIP-155 replay protection.
+// ethDefaultGasLimit is the intrinsic gas of a plain value transfer.
+const ethDefaultGasLimit = 21_000
+
+// Sign signs an Ethereum transaction. Legacy transactions use EIP-155 replay
+// protection; TxTypeDynamicFee transactions use the EIP-1559 typed envelope.
+// RawSigned holds the payload accepted by eth_sendRawTransaction, and TxHash
+// is keccak256 of that payload.
 func (s *ETHSigner) Sign(ctx context.Context, tx *models.Transaction, privateKey []byte) (*models.Transaction, error) {
-	// Build RLP-encoded transaction (simplified)
-	// In production: use go-ethereum types.NewTransaction + types.SignTx
-	txData := encodeTxForSigning(tx, s.chainID)
-	txHash := keccak256(txData)
+	if len(privateKey) != 32 {
+		return nil, fmt.Errorf("invalid private key length %d, want 32", len(privateKey))
+	}
+	to, err := decodeETHAddress(tx.To)
+	if err != nil {
+		return nil, fmt.Errorf("decode to: %w", err)
+	}
+
+	var raw []byte
+	switch tx.Type {
+	case models.TxTypeLegacy:
+		raw = s.signLegacy(tx, to, privateKey)
+	case models.TxTypeDynamicFee:
+		raw, err = s.signDynamicFee(tx, to, privateKey)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported transaction type %d", tx.Type)
+	}
 
-	tx.TxHash = fmt.Sprintf("0x%s", hex.EncodeToString(txHash))
+	tx.TxHash = fmt.Sprintf("0x%s", hex.EncodeToString(keccak256(raw)))
 	tx.Signed = true
-	tx.RawSigned = txData // simplified; would be actual signed RLP
+	tx.RawSigned = raw
 
 	return tx, nil
 }
 
+// signLegacy returns the signed RLP of an EIP-155 legacy transaction.
+func (s *ETHSigner) signLegacy(tx *models.Transaction, to, privateKey []byte) []byte {
+	gasLimit, gasPrice := ethGasParams(tx)
+	tx.GasLimit = gasLimit
+	tx.GasPrice = gasPrice
+
+	fields := [][]byte{
+		rlpUint(tx.Nonce),
+		rlpBigInt(gasPrice),
+		rlpUint(gasLimit),
+		rlpBytes(to),
+		rlpBigInt(tx.Amount),
+		rlpBytes(tx.Data),
+	}
+
+	// EIP-155 signing payload: the six fields followed by (chainId, 0, 0)
+	sigHash := keccak256(rlpList(append(fields, rlpBigInt(s.chainID), rlpUint(0), rlpUint(0))...))
+	recID, r, sv := signRecoverable(privateKey, sigHash)
+
+	// v = recID + chainId*2 + 35
+	v := new(big.Int).Mul(s.chainID, big.NewInt(2))
+	v.Add(v, big.NewInt(int64(recID)+35))
+
+	return rlpList(append(fields, rlpBigInt(v), rlpBytes(r), rlpBytes(sv))...)
+}
+
+// signDynamicFee returns the signed EIP-1559 envelope:
+// 0x02 || rlp([chainId, nonce, maxPriorityFeePerGas, maxFeePerGas, gasLimit, to, value, data, accessList, yParity, r, s]).
+func (s *ETHSigner) signDynamicFee(tx *models.Transaction, to, privateKey []byte) ([]byte, error) {
+	if tx.MaxFeePerGas == nil || tx.MaxPriorityFeePerGas == nil {
+		return nil, fmt.Errorf("dynamic fee transaction requires max fee and max priority fee")
+	}
+	if tx.MaxPriorityFeePerGas.Cmp(tx.MaxFeePerGas) > 0 {
+		return nil, fmt.Errorf("max priority fee %s exceeds max fee %s", tx.MaxPriorityFeePerGas, tx.MaxFeePerGas)
+	}
+	accessList, err := rlpAccessList(tx.AccessList)
+	if err != nil {
+		return nil, fmt.Errorf("access list: %w", err)
+	}
+	if tx.GasLimit == 0 {
+		tx.GasLimit = ethDefaultGasLimit
+	}
+
+	fields := [][]byte{
+		rlpBigInt(s.chainID),
+		rlpUint(tx.Nonce),
+		rlpBigInt(tx.MaxPriorityFeePerGas),
+		rlpBigInt(tx.MaxFeePerGas),
+		rlpUint(tx.GasLimit),
+		rlpBytes(to),
+		rlpBigInt(tx.Amount),
+		rlpBytes(tx.Data),
+		accessList,
+	}
+
+	sigHash := keccak256(typedEnvelope(models.TxTypeDynamicFee, rlpList(fields...)))
+	recID, r, sv := signRecoverable(privateKey, sigHash)
+
+	return typedEnvelope(models.TxTypeDynamicFee, rlpList(append(fields, rlpUint(uint64(recID)), rlpBytes(r), rlpBytes(sv))...)), nil
+}
+
 // --- helpers ---
 
 // deriveKey derives a child private key from a BIP-39 seed using BIP-32/BIP-44.
 // Path: m/44'/{coinType}'/0'/0/{index}
 func deriveKey(seed []byte, coinType uint32, index uint32) ([]byte, error) {
+	return deriveKeyPath(seed, 44, coinType, index)
+}
+
+// deriveKeyPath derives a child private key for any BIP-44-shaped purpose
+// (44, 49, 84, 86). Path: m/{purpose}'/{coinType}'/0'/0/{index}
+func deriveKeyPath(seed []byte, purpose, coinType, index uint32) ([]byte, error) {
 	masterKey, err := bip32.NewMasterKey(seed)
 	if err != nil {
 		return nil, fmt.Errorf("master key: %w", err)
 	}
 
-	// m/44'
-	purpose, err := masterKey.NewChildKey(bip32.FirstHardenedChild + 44)
+	// m/{purpose}'
+	purposeKey, err := masterKey.NewChildKey(bip32.FirstHardenedChild + purpose)
 	if err != nil {
 		return nil, fmt.Errorf("derive purpose: %w", err)
 	}
 
-	// m/44'/{coinType}'
-	coin, err := purpose.NewChildKey(bip32.FirstHardenedChild + coinType)
+	// m/{purpose}'/{coinType}'
+	coin, err := purposeKey.NewChildKey(bip32.FirstHardenedChild + coinType)
 	if err != nil {
 		return nil, fmt.Errorf("derive coin: %w", err)
 	}
 
-	// m/44'/{coinType}'/0'
+	// m/{purpose}'/{coinType}'/0'
 	account, err := coin.NewChildKey(bip32.FirstHardenedChild + 0)
 	if err != nil {
 		return nil, fmt.Errorf("derive account: %w", err)
 	}
 
-	// m/44'/{coinType}'/0'/0
+	// m/{purpose}'/{coinType}'/0'/0
 	change, err := account.NewChildKey(0)
 	if err != nil {
 		return nil, fmt.Errorf("derive change: %w", err)
 	}
 
-	// m/44'/{coinType}'/0'/0/{index}
+	// m/{purpose}'/{coinType}'/0'/0/{index}
 	child, err := change.NewChildKey(index)
 	if err != nil {
 		return nil, fmt.Errorf("derive child: %w", err)
@@ -126,13 +217,80 @@ func keccak256(data []byte) []byte {
 	return h.Sum(nil)
 }
 
-func encodeTxForSigning(tx *models.Transaction, chainID *big.Int) []byte {
-	// Simplified RLP encoding for demo
-	// Production: use go-ethereum/rlp package
-	var data []byte
-	data = append(data, byte(tx.Nonce))
-	data = append(data, tx.Amount.Bytes()...)
-	data = append(data, []byte(tx.To)...)
-	data = append(data, chainID.Bytes()...)
-	return data
+// ethGasParams resolves the gas limit and gas price for a transaction,
+// deriving the price from the flat Fee when no explicit price is set.
+func ethGasParams(tx *models.Transaction) (uint64, *big.Int) {
+	gasLimit := tx.GasLimit
+	if gasLimit == 0 {
+		gasLimit = ethDefaultGasLimit
+	}
+	if tx.GasPrice != nil {
+		return gasLimit, tx.GasPrice
+	}
+	if tx.Fee == nil {
+		return gasLimit, big.NewInt(0)
+	}
+	return gasLimit, new(big.Int).Div(tx.Fee, new(big.Int).SetUint64(gasLimit))
+}
+
+// typedEnvelope prefixes an RLP payload with its EIP-2718 transaction type byte.
+func typedEnvelope(txType models.TxType, payload []byte) []byte {
+	return append([]byte{byte(txType)}, payload...)
+}
+
+// rlpAccessList encodes an EIP-2930 access list: [[address, [storageKey, ...]], ...].
+func rlpAccessList(list []models.AccessTuple) ([]byte, error) {
+	tuples := make([][]byte, 0, len(list))
+	for _, t := range list {
+		addr, err := decodeETHAddress(t.Address)
+		if err != nil {
+			return nil, err
+		}
+		if addr == nil {
+			return nil, fmt.Errorf("empty access list address")
+		}
+		keys := make([][]byte, 0, len(t.StorageKeys))
+		for _, k := range t.StorageKeys {
+			key, err := hex.DecodeString(strings.TrimPrefix(k, "0x"))
+			if err != nil || len(key) != 32 {
+				return nil, fmt.Errorf("invalid storage key %q", k)
+			}
+			keys = append(keys, rlpBytes(key))
+		}
+		tuples = append(tuples, rlpList(rlpBytes(addr), rlpList(keys...)))
+	}
+	return rlpList(tuples...), nil
+}
+
+// decodeETHAddress parses a 0x-prefixed hex address. An empty string yields
+// an empty recipient (contract creation).
+func decodeETHAddress(addr string) ([]byte, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(addr, "0x"), "0X"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if len(b) != 20 {
+		return nil, fmt.Errorf("invalid address %q: %d bytes, want 20", addr, len(b))
+	}
+	return b, nil
+}
+
+// signRecoverable produces a secp256k1 signature over a 32-byte hash and returns
+// the recovery id (0 or 1) with the big-endian r and s values (leading zeros trimmed).
+// The private key length must be validated by the caller.
+func signRecoverable(privateKey, hash []byte) (recID byte, r, s []byte) {
+	key, _ := btcec.PrivKeyFromBytes(privateKey)
+	// Compact format: [27 + recID] || R(32) || S(32), uncompressed-key variant.
+	sig := ecdsa.SignCompact(key, hash, false)
+	return sig[0] - 27, trimLeadingZeros(sig[1:33]), trimLeadingZeros(sig[33:65])
+}
+
+func trimLeadingZeros(b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
 }
@@ -0,0 +1,237 @@
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRLP_Vectors(t *testing.T) {
+	lorem := "Lorem ipsum dolor sit amet, consectetur adipisicing elit"
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"empty string", rlpBytes(nil), "80"},
+		{"single byte", rlpBytes([]byte{0x0f}), "0f"},
+		{"dog", rlpBytes([]byte("dog")), "83646f67"},
+		{"zero", rlpUint(0), "80"},
+		{"fifteen", rlpUint(15), "0f"},
+		{"1024", rlpUint(1024), "820400"},
+		{"big int", rlpBigInt(new(big.Int).Lsh(big.NewInt(1), 64)), "89010000000000000000"},
+		{"empty list", rlpList(), "c0"},
+		{"cat dog", rlpList(rlpBytes([]byte("cat")), rlpBytes([]byte("dog"))), "c88363617483646f67"},
+		{"long string", rlpBytes([]byte(lorem)), "b838" + hex.EncodeToString([]byte(lorem))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(tt.got); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestETHSigner_EIP155Vector checks the example transaction from the EIP-155 specification.
+func TestETHSigner_EIP155Vector(t *testing.T) {
+	amount, _ := new(big.Int).SetString("1000000000000000000", 10)
+	tx := &models.Transaction{
+		Network:  models.NetworkETH,
+		To:       "0x3535353535353535353535353535353535353535",
+		Amount:   amount,
+		Nonce:    9,
+		GasPrice: big.NewInt(20_000_000_000),
+		GasLimit: 21_000,
+	}
+	key := mustHex(t, "4646464646464646464646464646464646464646464646464646464646464646")
+
+	signed, err := NewETHSigner(1).Sign(context.Background(), tx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantRaw := "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a7640000" +
+		"8025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+	if got := hex.EncodeToString(signed.RawSigned); got != wantRaw {
+		t.Errorf("RawSigned = %s\nwant       %s", got, wantRaw)
+	}
+	wantHash := "0x" + hex.EncodeToString(keccak256(mustHex(t, wantRaw)))
+	if signed.TxHash != wantHash {
+		t.Errorf("TxHash = %s, want %s", signed.TxHash, wantHash)
+	}
+}
+
+func TestETHSigner_RecoversSender(t *testing.T) {
+	key := mustHex(t, "4646464646464646464646464646464646464646464646464646464646464646")
+	hash := mustHex(t, "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53")
+
+	recID, r, s := signRecoverable(key, hash)
+
+	compact := make([]byte, 65)
+	compact[0] = 27 + recID
+	copy(compact[33-len(r):33], r)
+	copy(compact[65-len(s):], s)
+	pub, _, err := ecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := hex.EncodeToString(keccak256(pub.SerializeUncompressed()[1:])[12:])
+	if addr != "9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f" {
+		t.Errorf("recovered sender 0x%s, want 0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f", addr)
+	}
+}
+
+func TestETHSigner_InvalidInput(t *testing.T) {
+	key := mustHex(t, "4646464646464646464646464646464646464646464646464646464646464646")
+	s := NewETHSigner(1)
+
+	if _, err := s.Sign(context.Background(), &models.Transaction{To: "0x35", Amount: big.NewInt(1)}, key); err == nil {
+		t.Error("expected error for short address")
+	}
+	if _, err := s.Sign(context.Background(), &models.Transaction{To: "0x3535353535353535353535353535353535353535", Amount: big.NewInt(1)}, []byte("short")); err == nil {
+		t.Error("expected error for invalid private key")
+	}
+}
+
+// rlpSplit decodes the top-level items of an RLP list, returning each item's
+// payload (strings) or full encoding (nested lists).
+func rlpSplit(t *testing.T, b []byte) [][]byte {
+	t.Helper()
+	readLen := func(b []byte, short, long byte) (hdr, n int) {
+		switch p := b[0]; {
+		case p < short+56:
+			return 1, int(p - short)
+		default:
+			ll := int(p - long)
+			return 1 + ll, int(new(big.Int).SetBytes(b[1 : 1+ll]).Int64())
+		}
+	}
+	if b[0] < 0xc0 {
+		t.Fatalf("not an RLP list: %x", b[0])
+	}
+	hdr, n := readLen(b, 0xc0, 0xf7)
+	body := b[hdr : hdr+n]
+
+	var items [][]byte
+	for len(body) > 0 {
+		switch p := body[0]; {
+		case p < 0x80:
+			items = append(items, body[:1])
+			body = body[1:]
+		case p < 0xc0:
+			h, l := readLen(body, 0x80, 0xb7)
+			items = append(items, body[h:h+l])
+			body = body[h+l:]
+		default:
+			h, l := readLen(body, 0xc0, 0xf7)
+			items = append(items, body[:h+l])
+			body = body[h+l:]
+		}
+	}
+	return items
+}
+
+func TestETHSigner_DynamicFee(t *testing.T) {
+	key := mustHex(t, "4646464646464646464646464646464646464646464646464646464646464646")
+	tx := &models.Transaction{
+		Type:                 models.TxTypeDynamicFee,
+		To:                   "0x3535353535353535353535353535353535353535",
+		Amount:               big.NewInt(1),
+		MaxPriorityFeePerGas: big.NewInt(1),
+		MaxFeePerGas:         big.NewInt(2),
+	}
+
+	signed, err := NewETHSigner(1).Sign(context.Background(), tx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := signed.RawSigned
+	if raw[0] != 0x02 {
+		t.Fatalf("envelope type = 0x%02x, want 0x02", raw[0])
+	}
+	if want := "0x" + hex.EncodeToString(keccak256(raw)); signed.TxHash != want {
+		t.Errorf("TxHash = %s, want %s", signed.TxHash, want)
+	}
+
+	items := rlpSplit(t, raw[1:])
+	if len(items) != 12 {
+		t.Fatalf("expected 12 fields, got %d", len(items))
+	}
+
+	// Unsigned payload for these fields, built by hand:
+	// [chainId=1, nonce=0, tip=1, maxFee=2, gas=21000, to, value=1, data="", accessList=[]]
+	unsigned := "02df018001028252089435353535353535353535353535353535353535350180c0"
+	sigHash := keccak256(mustHex(t, unsigned))
+
+	var yParity byte
+	if len(items[9]) == 1 {
+		yParity = items[9][0]
+	}
+	compact := make([]byte, 65)
+	compact[0] = 27 + yParity
+	copy(compact[33-len(items[10]):33], items[10])
+	copy(compact[65-len(items[11]):], items[11])
+	pub, _, err := ecdsa.RecoverCompact(compact, sigHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := hex.EncodeToString(keccak256(pub.SerializeUncompressed()[1:])[12:])
+	if addr != "9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f" {
+		t.Errorf("recovered sender 0x%s, want 0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f", addr)
+	}
+}
+
+func TestETHSigner_AccessList(t *testing.T) {
+	got, err := rlpAccessList([]models.AccessTuple{{
+		Address:     "0x3535353535353535353535353535353535353535",
+		StorageKeys: []string{"0x0000000000000000000000000000000000000000000000000000000000000001"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "f838f7943535353535353535353535353535353535353535e1a0" +
+		"0000000000000000000000000000000000000000000000000000000000000001"
+	if hex.EncodeToString(got) != want {
+		t.Errorf("access list = %x, want %s", got, want)
+	}
+
+	if _, err := rlpAccessList([]models.AccessTuple{{Address: "0x3535353535353535353535353535353535353535", StorageKeys: []string{"0x01"}}}); err == nil {
+		t.Error("expected error for short storage key")
+	}
+}
+
+func TestETHSigner_DynamicFeeValidation(t *testing.T) {
+	key := mustHex(t, "4646464646464646464646464646464646464646464646464646464646464646")
+	s := NewETHSigner(1)
+
+	tx := &models.Transaction{
+		Type:   models.TxTypeDynamicFee,
+		To:     "0x3535353535353535353535353535353535353535",
+		Amount: big.NewInt(1),
+	}
+	if _, err := s.Sign(context.Background(), tx, key); err == nil {
+		t.Error("expected error without fee caps")
+	}
+
+	tx.MaxFeePerGas = big.NewInt(1)
+	tx.MaxPriorityFeePerGas = big.NewInt(2)
+	if _, err := s.Sign(context.Background(), tx, key); err == nil {
+		t.Error("expected error when priority fee exceeds max fee")
+	}
+}
@@ -0,0 +1,44 @@
+package wallet
+
+import "encoding/binary"
+
+// Minimal protobuf (proto3) encoder used for TRON transaction serialization.
+// Fields holding their default value are omitted, matching the canonical
+// encoding produced by java-tron, so the txID computed here equals the node's.
+
+// Protobuf wire types.
+const (
+	pbWireVarint = 0
+	pbWireBytes  = 2
+)
+
+// pbTag encodes a field key: (field number << 3) | wire type.
+func pbTag(field int, wireType int) []byte {
+	return binary.AppendUvarint(nil, uint64(field)<<3|uint64(wireType))
+}
+
+// pbVarint encodes an int64/uint64/enum field. Zero values are omitted.
+func pbVarint(field int, v uint64) []byte {
+	if v == 0 {
+		return nil
+	}
+	return binary.AppendUvarint(pbTag(field, pbWireVarint), v)
+}
+
+// pbBytes encodes a bytes, string or embedded message field. Empty values are omitted.
+func pbBytes(field int, b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	out := binary.AppendUvarint(pbTag(field, pbWireBytes), uint64(len(b)))
+	return append(out, b...)
+}
+
+// pbMessage concatenates already-encoded fields into a message body.
+func pbMessage(fields ...[]byte) []byte {
+	var out []byte
+	for _, f := range fields {
+		out = append(out, f...)
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package wallet
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// Minimal RLP (Recursive Length Prefix) encoder used for Ethereum transaction
+// serialization. Only encoding is needed: signers produce payloads, they never
+// parse them.
+
+// rlpBytes encodes a byte string.
+func rlpBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(rlpHeader(0x80, len(b)), b...)
+}
+
+// rlpUint encodes an unsigned integer as a big-endian byte string without leading zeros.
+func rlpUint(n uint64) []byte {
+	if n == 0 {
+		return rlpBytes(nil)
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	i := 0
+	for buf[i] == 0 {
+		i++
+	}
+	return rlpBytes(buf[i:])
+}
+
+// rlpBigInt encodes a non-negative big integer. A nil value encodes as zero.
+func rlpBigInt(n *big.Int) []byte {
+	if n == nil {
+		return rlpBytes(nil)
+	}
+	return rlpBytes(n.Bytes())
+}
+
+// rlpList encodes already-encoded items as an RLP list.
+func rlpList(items ...[]byte) []byte {
+	size := 0
+	for _, item := range items {
+		size += len(item)
+	}
+	out := make([]byte, 0, size+9)
+	out = append(out, rlpHeader(0xc0, size)...)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// rlpHeader returns the prefix for a string (offset 0x80) or list (offset 0xc0) of the given length.
+func rlpHeader(offset byte, length int) []byte {
+	if length < 56 {
+		return []byte{offset + byte(length)}
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(length))
+	i := 0
+	for buf[i] == 0 {
+		i++
+	}
+	header := []byte{offset + 55 + byte(8-i)}
+	return append(header, buf[i:]...)
+}
@@ -0,0 +1,194 @@
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+func TestBech32m_BIP350Valid(t *testing.T) {
+	valid := []string{
+		"A1LQFN3A",
+		"a1lqfn3a",
+		"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6",
+		"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx",
+		"11" + strings.Repeat("l", 82) + "ludsr8",
+		"split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+		"?1v759aa",
+	}
+	for _, s := range valid {
+		_, _, constant, err := bech32Decode(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if constant != bech32mConst {
+			t.Errorf("%s: decoded as bech32, want bech32m", s)
+		}
+	}
+}
+
+func TestSegWitAddress_BIP350(t *testing.T) {
+	tests := []struct {
+		hrp, addr, script string
+	}{
+		{"bc", "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"bc", "BC1SW50QGDZ25J", "6002751e"},
+		{"bc", "bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", "5210751e76e8199196d454941c45d1b3a323"},
+		{"tb", "tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", "5120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+	for _, tt := range tests {
+		version, program, err := decodeSegWitAddress(tt.hrp, tt.addr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.addr, err)
+			continue
+		}
+		if script := hex.EncodeToString(witnessScript(version, program)); script != tt.script {
+			t.Errorf("%s: script = %s, want %s", tt.addr, script, tt.script)
+		}
+		enc, err := encodeSegWitAddress(tt.hrp, version, program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enc != strings.ToLower(tt.addr) {
+			t.Errorf("encode = %s, want %s", enc, strings.ToLower(tt.addr))
+		}
+	}
+
+	invalid := []struct{ hrp, addr string }{
+		{"bc", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd"}, // v1 with bech32 checksum
+		{"tb", "tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf"}, // v2 with bech32 checksum
+		{"bc", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh"},                     // v0 with bech32m checksum
+		{"bc", "bc1pw5dgrnzv"}, // program too short
+		{"bc", "bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4"}, // invalid data character
+	}
+	for _, tt := range invalid {
+		if _, _, err := decodeSegWitAddress(tt.hrp, tt.addr); err == nil {
+			t.Errorf("%s: expected error", tt.addr)
+		}
+	}
+}
+
+func TestBTCGenerator_BIP86Vectors(t *testing.T) {
+	seed := testSeed(t)
+	gen := NewBTCGenerator(WithAddressType(BTCAddressP2TR))
+
+	tests := []struct {
+		index   uint32
+		path    string
+		address string
+	}{
+		{0, "m/86'/0'/0'/0/0", "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		{1, "m/86'/0'/0'/0/1", "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh"},
+	}
+	for _, tt := range tests {
+		addr, err := gen.GenerateFromSeed(seed, tt.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.DerivationPath != tt.path {
+			t.Errorf("path = %s, want %s", addr.DerivationPath, tt.path)
+		}
+		if addr.Address != tt.address {
+			t.Errorf("address = %s, want %s", addr.Address, tt.address)
+		}
+	}
+
+	key, err := deriveKeyPath(seed, 86, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(taprootOutputKey(key)); got != "a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c" {
+		t.Errorf("output key = %s", got)
+	}
+}
+
+// TestSchnorrSign_BIP340Vector checks test vector 0 from BIP-340 (zero auxiliary randomness).
+func TestSchnorrSign_BIP340Vector(t *testing.T) {
+	key, _ := btcec.PrivKeyFromBytes(mustHex(t, "0000000000000000000000000000000000000000000000000000000000000003"))
+	sig, err := schnorrSign(key, make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca8215" +
+		"25f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0"
+	if got := hex.EncodeToString(sig); got != want {
+		t.Errorf("sig = %s\nwant  %s", got, want)
+	}
+}
+
+func TestBTCSigner_TaprootKeyPath(t *testing.T) {
+	key, err := deriveKeyPath(testSeed(t), 86, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputKey := taprootOutputKey(key)
+	from := "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"
+
+	tx := &models.Transaction{
+		From: from,
+		Outputs: []models.TxOutput{
+			{Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", Amount: big.NewInt(30_000)},
+			{Address: from, Amount: big.NewInt(19_000)},
+		},
+		Inputs: []models.UTXO{{
+			TxID:         "9f96ade4b41d5433f4eda31e1738ec2b36f6e7d1420d94a6af99801a88f7f7ff",
+			Vout:         2,
+			Amount:       big.NewInt(50_000),
+			ScriptPubKey: witnessScript(1, outputKey),
+		}},
+	}
+
+	btx, err := NewBTCSigner(BTCMainNet).buildTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := btx.SignInput(0, key); err != nil {
+		t.Fatal(err)
+	}
+	witness := btx.Inputs[0].Witness
+	if len(witness) != 1 || len(witness[0]) != 64 {
+		t.Fatalf("key-path witness should be one 64-byte signature, got %x", witness)
+	}
+
+	sigHash, err := btx.TaprootSigHash(0, sigHashDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := schnorr.ParseSignature(witness[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := schnorr.ParsePubKey(outputKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(sigHash, pub) {
+		t.Error("signature does not verify against the tweaked output key")
+	}
+
+	// The full signer must produce a witness transaction whose txid excludes the witness.
+	signed, err := NewBTCSigner(BTCMainNet).Sign(context.Background(), tx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw := hex.EncodeToString(signed.RawSigned); raw[8:12] != "0001" {
+		t.Error("taproot spend must carry the BIP-144 witness marker")
+	}
+	txid, _ := btx.TxID()
+	if signed.TxHash != txid {
+		t.Errorf("TxHash = %s, want %s", signed.TxHash, txid)
+	}
+
+	// A key that does not own the output is rejected.
+	if err := btx.SignInput(0, testPrivateKey(t, 0)); err == nil {
+		t.Error("expected error signing with a foreign key")
+	}
+}
@@ -2,13 +2,22 @@ package wallet
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/OKaluzny/wallet-demo/pkg/models"
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil/base58"
 )
 
+// trxAddressVersion is the leading byte of every TRON address.
+const trxAddressVersion = 0x41
+
 // TRXGenerator generates TRON addresses using BIP-44 derivation.
 // Derivation path: m/44'/195'/0'/0/{index}
 // TRON uses the same ECDSA secp256k1 as Ethereum but with Base58Check encoding.
@@ -43,7 +52,7 @@ func (g *TRXGenerator) GenerateFromSeed(seed []byte, index uint32) (*models.Deri
 	addrBytes := hash[12:]
 
 	// TRON uses 0x41 prefix + Base58Check (unlike ETH's hex encoding)
-	address := base58CheckEncode(0x41, addrBytes)
+	address := base58CheckEncode(trxAddressVersion, addrBytes)
 
 	return &models.DerivedAddress{
 		Network:        models.NetworkTRX,
@@ -53,23 +62,176 @@ func (g *TRXGenerator) GenerateFromSeed(seed []byte, index uint32) (*models.Deri
 	}, nil
 }
 
+// TRON contract types (protocol.Transaction.Contract.ContractType).
+const (
+	trxTransferContract     = 1
+	trxTriggerSmartContract = 31
+)
+
+// trxTypeURLPrefix prefixes contract names in the google.protobuf.Any parameter.
+const trxTypeURLPrefix = "type.googleapis.com/protocol."
+
+// trxDefaultExpiration is how long a transaction stays valid when Expiration is unset.
+const trxDefaultExpiration = 60 * time.Second
+
 // TRXSigner signs TRON transactions.
 // TRON uses protobuf for transaction serialization.
-type TRXSigner struct{}
+type TRXSigner struct {
+	now func() time.Time
+}
 
 // NewTRXSigner returns a new TRON transaction signer.
 func NewTRXSigner() *TRXSigner {
-	return &TRXSigner{}
+	return &TRXSigner{now: time.Now}
 }
 
-// Sign signs a TRON transaction using Keccak256 hashing.
+// Sign builds the protobuf raw_data of a TransferContract (or, when tx.Data is
+// set, a TriggerSmartContract calling tx.To) and signs it. TxHash is the txID,
+// sha256(raw_data), and RawSigned is the serialized protocol.Transaction
+// accepted by wallet/broadcasthex.
+//
+// RefBlockNumber and RefBlockHash must reference a recent block. Timestamp
+// defaults to now and Expiration to Timestamp plus 60 seconds.
 func (s *TRXSigner) Sign(ctx context.Context, tx *models.Transaction, privateKey []byte) (*models.Transaction, error) {
-	rawData := []byte(fmt.Sprintf("%s:%s:%s", tx.From, tx.To, tx.Amount.String()))
-	txHash := keccak256(rawData)
+	if len(privateKey) != 32 {
+		return nil, fmt.Errorf("invalid private key length %d, want 32", len(privateKey))
+	}
+
+	raw, err := s.buildRawData(tx)
+	if err != nil {
+		return nil, fmt.Errorf("build: %w", err)
+	}
+	txID := sha256.Sum256(raw)
 
-	tx.TxHash = hex.EncodeToString(txHash)
+	// protocol.Transaction: raw_data = 1, signature = 2
+	signed := pbMessage(
+		pbBytes(1, raw),
+		pbBytes(2, trxSignature(privateKey, txID[:])),
+	)
+
+	tx.TxHash = hex.EncodeToString(txID[:])
 	tx.Signed = true
-	tx.RawSigned = rawData
+	tx.RawSigned = signed
 
 	return tx, nil
 }
+
+// buildRawData encodes protocol.Transaction.raw:
+// ref_block_bytes = 1, ref_block_hash = 4, expiration = 8, contract = 11,
+// timestamp = 14, fee_limit = 18.
+func (s *TRXSigner) buildRawData(tx *models.Transaction) ([]byte, error) {
+	owner, err := decodeTRXAddress(tx.From)
+	if err != nil {
+		return nil, fmt.Errorf("decode from: %w", err)
+	}
+	to, err := decodeTRXAddress(tx.To)
+	if err != nil {
+		return nil, fmt.Errorf("decode to: %w", err)
+	}
+	refHash, err := hex.DecodeString(strings.TrimPrefix(tx.RefBlockHash, "0x"))
+	if err != nil || len(refHash) != 32 {
+		return nil, fmt.Errorf("invalid ref block hash %q", tx.RefBlockHash)
+	}
+	if tx.FeeLimit < 0 {
+		return nil, fmt.Errorf("negative fee limit %d", tx.FeeLimit)
+	}
+	contract, err := trxContract(tx, owner, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if tx.Timestamp == 0 {
+		tx.Timestamp = s.now().UnixMilli()
+	}
+	if tx.Expiration == 0 {
+		tx.Expiration = tx.Timestamp + trxDefaultExpiration.Milliseconds()
+	}
+
+	// TaPoS: bytes 6..8 of the big-endian block number and bytes 8..16 of the block hash
+	var refNum [8]byte
+	binary.BigEndian.PutUint64(refNum[:], tx.RefBlockNumber)
+
+	return pbMessage(
+		pbBytes(1, refNum[6:8]),
+		pbBytes(4, refHash[8:16]),
+		pbVarint(8, uint64(tx.Expiration)),
+		pbBytes(11, contract),
+		pbVarint(14, uint64(tx.Timestamp)),
+		pbVarint(18, uint64(tx.FeeLimit)),
+	), nil
+}
+
+// trxContract encodes protocol.Transaction.Contract{type = 1, parameter = 2}
+// wrapping a TransferContract or TriggerSmartContract in a google.protobuf.Any.
+func trxContract(tx *models.Transaction, owner, to []byte) ([]byte, error) {
+	var amount int64
+	if tx.Amount != nil {
+		if !tx.Amount.IsInt64() || tx.Amount.Sign() < 0 {
+			return nil, fmt.Errorf("invalid amount %s", tx.Amount)
+		}
+		amount = tx.Amount.Int64()
+	}
+
+	var (
+		contractType uint64
+		name         string
+		param        []byte
+	)
+	if len(tx.Data) == 0 {
+		if amount == 0 {
+			return nil, fmt.Errorf("transfer amount must be positive")
+		}
+		// TransferContract: owner_address = 1, to_address = 2, amount = 3
+		contractType, name = trxTransferContract, "TransferContract"
+		param = pbMessage(
+			pbBytes(1, owner),
+			pbBytes(2, to),
+			pbVarint(3, uint64(amount)),
+		)
+	} else {
+		// TriggerSmartContract: owner_address = 1, contract_address = 2, call_value = 3, data = 4
+		contractType, name = trxTriggerSmartContract, "TriggerSmartContract"
+		param = pbMessage(
+			pbBytes(1, owner),
+			pbBytes(2, to),
+			pbVarint(3, uint64(amount)),
+			pbBytes(4, tx.Data),
+		)
+	}
+
+	// google.protobuf.Any: type_url = 1, value = 2
+	anyParam := pbMessage(
+		pbBytes(1, []byte(trxTypeURLPrefix+name)),
+		pbBytes(2, param),
+	)
+	return pbMessage(pbVarint(1, contractType), pbBytes(2, anyParam)), nil
+}
+
+// trxSignature returns the 65-byte r || s || v signature TRON expects, with v = 27 + recovery id.
+// The private key length must be validated by the caller.
+func trxSignature(privateKey, hash []byte) []byte {
+	key, _ := btcec.PrivKeyFromBytes(privateKey)
+	// Compact format: [27 + recID] || R(32) || S(32)
+	sig := ecdsa.SignCompact(key, hash, false)
+	return append(sig[1:65:65], sig[0])
+}
+
+// decodeTRXAddress returns the 21-byte (0x41-prefixed) form of a Base58Check
+// T... address or a 41... hex address.
+func decodeTRXAddress(addr string) ([]byte, error) {
+	if len(addr) == 42 && strings.HasPrefix(addr, "41") {
+		b, err := hex.DecodeString(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+		}
+		return b, nil
+	}
+	payload, version, err := base58.CheckDecode(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if version != trxAddressVersion || len(payload) != 20 {
+		return nil, fmt.Errorf("invalid address %q: not a TRON address", addr)
+	}
+	return append([]byte{version}, payload...), nil
+}
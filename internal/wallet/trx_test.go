@@ -0,0 +1,220 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+const (
+	trxTestFrom = "TUEZSdKsoDHQMeZwihtdoBiN46zxhGWYdH" // m/44'/195'/0'/0/0 for "abandon ... about"
+	trxTestTo   = "TSeJkUh4Qv67VNFwY8LaAxERygNdy6NQZK" // m/44'/195'/0'/0/1
+	trxTestUSDT = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+)
+
+// Block 63000123 (0x3c14e3b); only hash bytes 8..16 end up in the transaction.
+const trxTestRefBlockHash = "0000000003c14e3ba1b2c3d4e5f6071800000000000000000000000000000000"
+
+func TestProtobuf_Encoding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		// Examples from the protobuf encoding guide
+		{"varint 150", pbVarint(1, 150), "089601"},
+		{"string", pbBytes(2, []byte("testing")), "120774657374696e67"},
+		{"zero omitted", pbVarint(3, 0), ""},
+		{"empty omitted", pbBytes(4, nil), ""},
+		{"field 18", pbVarint(18, 1), "900101"},
+		{"message", pbMessage(pbVarint(1, 1), pbBytes(2, []byte{0xff})), "08011201ff"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(tt.got); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeTRXAddress(t *testing.T) {
+	tests := []struct {
+		addr, want string
+	}{
+		{trxTestFrom, "41c8599111f29c1e1e061265b4af93ea1f274ad78a"},
+		{trxTestUSDT, "41a614f803b6fd780986a42c78ec9c7f77e6ded13c"},
+		{"41a614f803b6fd780986a42c78ec9c7f77e6ded13c", "41a614f803b6fd780986a42c78ec9c7f77e6ded13c"},
+	}
+	for _, tt := range tests {
+		got, err := decodeTRXAddress(tt.addr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.addr, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("%s: got %x, want %s", tt.addr, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "0x3535353535353535353535353535353535353535", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", "41zz"} {
+		if _, err := decodeTRXAddress(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func trxTestTx(to string, amount int64, data []byte) *models.Transaction {
+	return &models.Transaction{
+		Network:        models.NetworkTRX,
+		From:           trxTestFrom,
+		To:             to,
+		Amount:         big.NewInt(amount),
+		Data:           data,
+		RefBlockNumber: 63_000_123,
+		RefBlockHash:   trxTestRefBlockHash,
+		Timestamp:      1_700_000_000_000,
+	}
+}
+
+// trxRecoverSigner checks a signed transaction's layout and returns the
+// address recovered from its signature.
+func trxRecoverSigner(t *testing.T, signed *models.Transaction, raw []byte) string {
+	t.Helper()
+	txID := sha256.Sum256(raw)
+	if signed.TxHash != hex.EncodeToString(txID[:]) {
+		t.Errorf("TxHash = %s, want sha256(raw_data) %x", signed.TxHash, txID)
+	}
+
+	// protocol.Transaction{raw_data = 1, signature = 2}
+	rawField := pbBytes(1, raw)
+	if !bytes.HasPrefix(signed.RawSigned, rawField) {
+		t.Fatalf("RawSigned does not start with raw_data: %x", signed.RawSigned)
+	}
+	sigField := signed.RawSigned[len(rawField):]
+	if len(sigField) != 67 || sigField[0] != 0x12 || sigField[1] != 65 {
+		t.Fatalf("signature field = %x, want 65-byte bytes field 2", sigField)
+	}
+	sig := sigField[2:]
+	if sig[64] != 27 && sig[64] != 28 {
+		t.Errorf("v = %d, want 27 or 28", sig[64])
+	}
+
+	compact := append([]byte{sig[64]}, sig[:64]...)
+	pub, _, err := ecdsa.RecoverCompact(compact, txID[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := keccak256(pub.SerializeUncompressed()[1:])
+	return base58CheckEncode(trxAddressVersion, hash[12:])
+}
+
+func TestTRXSigner_TransferContract(t *testing.T) {
+	tx := trxTestTx(trxTestTo, 1_000_000, nil)
+	signed, err := NewTRXSigner().Sign(context.Background(), tx, testPrivateKey(t, 195))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// raw_data cross-checked with an independent protobuf encoder
+	want := "0a024e3b2208a1b2c3d4e5f6071840e0a499ffbc315a67080112630a2d747970652e676f6f676c65617069732e636f6d" +
+		"2f70726f746f636f6c2e5472616e73666572436f6e747261637412320a1541c8599111f29c1e1e061265b4af93ea1f27" +
+		"4ad78a121541b6e708a39781c96bd399c7657780ff9fe9f052a818c0843d7080d095ffbc31"
+	raw, err := NewTRXSigner().buildRawData(trxTestTx(trxTestTo, 1_000_000, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(raw); got != want {
+		t.Fatalf("raw_data = %s\nwant       %s", got, want)
+	}
+
+	if signer := trxRecoverSigner(t, signed, raw); signer != trxTestFrom {
+		t.Errorf("recovered signer = %s, want %s", signer, trxTestFrom)
+	}
+	if signed.Expiration != tx.Timestamp+60_000 {
+		t.Errorf("expiration = %d, want timestamp + 60s", signed.Expiration)
+	}
+}
+
+func TestTRXSigner_TriggerSmartContract(t *testing.T) {
+	// transfer(address,uint256) to the sender for 1000 units
+	data := mustHex(t, "a9059cbb000000000000000000000000c8599111f29c1e1e061265b4af93ea1f274ad78a"+
+		"00000000000000000000000000000000000000000000000000000000000003e8")
+	tx := trxTestTx(trxTestUSDT, 0, data)
+	tx.FeeLimit = 30_000_000
+
+	signed, err := NewTRXSigner().Sign(context.Background(), tx, testPrivateKey(t, 195))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "0a024e3b2208a1b2c3d4e5f6071840e0a499ffbc315aae01081f12a9010a31747970652e676f6f676c65617069732e636f" +
+		"6d2f70726f746f636f6c2e54726967676572536d617274436f6e747261637412740a1541c8599111f29c1e1e061265b4af" +
+		"93ea1f274ad78a121541a614f803b6fd780986a42c78ec9c7f77e6ded13c2244a9059cbb000000000000000000000000c8" +
+		"599111f29c1e1e061265b4af93ea1f274ad78a00000000000000000000000000000000000000000000000000000000000003" +
+		"e87080d095ffbc3190018087a70e"
+	tx2 := trxTestTx(trxTestUSDT, 0, data)
+	tx2.FeeLimit = 30_000_000
+	raw, err := NewTRXSigner().buildRawData(tx2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(raw); got != want {
+		t.Fatalf("raw_data = %s\nwant       %s", got, want)
+	}
+
+	if signer := trxRecoverSigner(t, signed, raw); signer != trxTestFrom {
+		t.Errorf("recovered signer = %s, want %s", signer, trxTestFrom)
+	}
+}
+
+func TestTRXSigner_DefaultTimestamp(t *testing.T) {
+	now := time.UnixMilli(1_700_000_123_456)
+	s := &TRXSigner{now: func() time.Time { return now }}
+
+	tx := trxTestTx(trxTestTo, 1, nil)
+	tx.Timestamp = 0
+	if _, err := s.Sign(context.Background(), tx, testPrivateKey(t, 195)); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Timestamp != now.UnixMilli() || tx.Expiration != now.UnixMilli()+60_000 {
+		t.Errorf("timestamp = %d, expiration = %d", tx.Timestamp, tx.Expiration)
+	}
+}
+
+func TestTRXSigner_Errors(t *testing.T) {
+	key := testPrivateKey(t, 195)
+	tests := []struct {
+		name string
+		tx   *models.Transaction
+		key  []byte
+	}{
+		{"short key", trxTestTx(trxTestTo, 1, nil), key[:31]},
+		{"bad recipient", trxTestTx("0x3535353535353535353535353535353535353535", 1, nil), key},
+		{"zero transfer", trxTestTx(trxTestTo, 0, nil), key},
+		{"negative amount", trxTestTx(trxTestTo, -1, nil), key},
+		{"missing ref block", func() *models.Transaction {
+			tx := trxTestTx(trxTestTo, 1, nil)
+			tx.RefBlockHash = ""
+			return tx
+		}(), key},
+		{"short ref block hash", func() *models.Transaction {
+			tx := trxTestTx(trxTestTo, 1, nil)
+			tx.RefBlockHash = strings.Repeat("ab", 16)
+			return tx
+		}(), key},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTRXSigner().Sign(context.Background(), tt.tx, tt.key); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
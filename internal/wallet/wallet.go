@@ -2,6 +2,8 @@ package wallet
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
 
 	"github.com/OKaluzny/wallet-demo/pkg/models"
 )
@@ -29,3 +31,43 @@ type HSMSigner interface {
 	// SignWithHSM signs using a key reference (never exposing the private key)
 	SignWithHSM(ctx context.Context, tx *models.Transaction, keyID string) (*models.Transaction, error)
 }
+
+// DecodeAccountAddress returns the 20-byte account identifier of an ETH (0x...)
+// or TRON (T... or 41...) address, the form used in ABI-encoded contract calls.
+func DecodeAccountAddress(network models.Network, address string) ([]byte, error) {
+	switch network {
+	case models.NetworkETH:
+		b, err := decodeETHAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			return nil, fmt.Errorf("empty address")
+		}
+		return b, nil
+	case models.NetworkTRX:
+		b, err := decodeTRXAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		return b[1:], nil
+	default:
+		return nil, fmt.Errorf("network %s has no account addresses", network)
+	}
+}
+
+// EncodeAccountAddress formats a 20-byte account identifier as an address of
+// network: lowercase 0x-hex for ETH, Base58Check T... for TRON.
+func EncodeAccountAddress(network models.Network, account []byte) (string, error) {
+	if len(account) != 20 {
+		return "", fmt.Errorf("invalid account length %d, want 20", len(account))
+	}
+	switch network {
+	case models.NetworkETH:
+		return "0x" + hex.EncodeToString(account), nil
+	case models.NetworkTRX:
+		return base58CheckEncode(trxAddressVersion, account), nil
+	default:
+		return "", fmt.Errorf("network %s has no account addresses", network)
+	}
+}
@@ -199,26 +199,51 @@ func TestBTCGenerator_PublicKeyFormat(t *testing.T) {
 	}
 }
 
+func testPrivateKey(t *testing.T, coinType uint32) []byte {
+	t.Helper()
+	key, err := deriveKey(testSeed(t), coinType, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key[:32]
+}
+
 func TestSigners_Sign(t *testing.T) {
 	signers := []struct {
 		name   string
 		signer Signer
+		tx     *models.Transaction
+		key    []byte
 	}{
-		{"ETH", NewETHSigner(1)},
-		{"BTC", NewBTCSigner(true)},
-		{"TRX", NewTRXSigner()},
+		{"ETH", NewETHSigner(1), &models.Transaction{
+			Network: models.NetworkETH,
+			From:    "0x9858effd232b4033e47d90003d41ec34ecaeda94",
+			To:      "0x3535353535353535353535353535353535353535",
+			Amount:  big.NewInt(1000),
+		}, testPrivateKey(t, 60)},
+		{"BTC", NewBTCSigner(BTCMainNet), &models.Transaction{
+			Network: models.NetworkBTC,
+			From:    "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA",
+			To:      "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA",
+			Amount:  big.NewInt(1000),
+			Inputs: []models.UTXO{{
+				TxID:         strings.Repeat("ab", 32),
+				Amount:       big.NewInt(2000),
+				ScriptPubKey: p2pkhScript(hash160(compressedPubKey(testPrivateKey(t, 0)))),
+			}},
+		}, testPrivateKey(t, 0)},
+		{"TRX", NewTRXSigner(), &models.Transaction{
+			Network:      models.NetworkTRX,
+			From:         "TUEZSdKsoDHQMeZwihtdoBiN46zxhGWYdH",
+			To:           "TSeJkUh4Qv67VNFwY8LaAxERygNdy6NQZK",
+			Amount:       big.NewInt(1000),
+			RefBlockHash: strings.Repeat("ab", 32),
+		}, testPrivateKey(t, 195)},
 	}
 
 	for _, tt := range signers {
 		t.Run(tt.name, func(t *testing.T) {
-			tx := &models.Transaction{
-				Network: models.NetworkETH,
-				From:    "0xfrom",
-				To:      "0xto",
-				Amount:  big.NewInt(1000),
-				Nonce:   0,
-			}
-			signed, err := tt.signer.Sign(context.Background(), tx, []byte("fake-private-key"))
+			signed, err := tt.signer.Sign(context.Background(), tt.tx, tt.key)
 			if err != nil {
 				t.Fatal(err)
 			}
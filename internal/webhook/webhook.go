@@ -0,0 +1,412 @@
+// Package webhook delivers listener events to subscriber URLs as signed JSON
+// POST requests.
+//
+// Each request carries the event ID, a Unix timestamp and an HMAC-SHA256
+// signature of "<timestamp>.<body>" keyed with the subscription secret:
+//
+//	X-Webhook-Id:        <BlockEvent.ID>
+//	X-Webhook-Timestamp: 1700000000
+//	X-Webhook-Signature: sha256=<hex>
+//
+// Receivers check the signature and timestamp with Verify and deduplicate
+// by event ID, as an event may be delivered more than once.
+//
+// Each Handle call makes up to Config.MaxAttempts requests per subscription,
+// with a short backoff between them, to ride out brief outages. A delivery
+// still failing after that fails the call; behind listener.Manager the event
+// is retried from its outbox with the Manager's longer backoff, so a
+// subscription gets at most MaxAttempts × DeliveryConfig.MaxAttempts
+// requests per event. Subscriptions that already received the event are not
+// sent it again.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/config"
+	"github.com/OKaluzny/wallet-demo/internal/listener"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+// Request headers set on every delivery.
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBackoff     = time.Second
+	defaultTimeout     = 10 * time.Second
+	defaultHistorySize = 10_000
+)
+
+// Config holds the notifier settings.
+type Config struct {
+	// MaxAttempts is the number of requests per subscription and event in
+	// one Handle call (default 3). Retries wait attempt² × Backoff: 1s, 4s...
+	MaxAttempts int
+	Backoff     time.Duration
+	// Timeout bounds a single request (default 10s).
+	Timeout time.Duration
+	// HistorySize is the number of recent events whose delivery records are
+	// kept (default 10000).
+	HistorySize int
+}
+
+// ConfigFrom maps the application config onto notifier settings.
+func ConfigFrom(cfg config.Config) Config {
+	return Config{
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		Timeout:     cfg.WebhookTimeout,
+	}
+}
+
+// Subscription routes events to a URL.
+type Subscription struct {
+	ID  string
+	URL string
+	// Secret keys the HMAC-SHA256 signature of each request.
+	Secret  string
+	Network models.Network
+	// Address limits the subscription to events to or from one address;
+	// empty subscribes to every event on Network, including alerts.
+	Address string
+}
+
+// matches reports whether the subscription wants ev.
+func (s Subscription) matches(ev models.BlockEvent) bool {
+	if s.Network != ev.Network {
+		return false
+	}
+	if s.Address == "" {
+		return true
+	}
+	if ev.Network == models.NetworkETH {
+		// ETH addresses are case-insensitive (EIP-55 checksums use case).
+		return strings.EqualFold(s.Address, ev.To) || strings.EqualFold(s.Address, ev.From)
+	}
+	return s.Address == ev.To || s.Address == ev.From
+}
+
+// Delivery records the attempts to deliver one event to one subscription.
+type Delivery struct {
+	EventID        string
+	SubscriptionID string
+	URL            string
+	Attempts       int
+	// LastStatus is the HTTP status of the latest response, 0 if none.
+	LastStatus int
+	LastError  string
+	Delivered  bool
+	// Rejected is set when the receiver answered with a 4xx status other
+	// than 429; the event is not sent to it again.
+	Rejected  bool
+	UpdatedAt time.Time
+}
+
+// Notifier POSTs events to the matching subscriptions. Its Handle method is a
+// listener.EventHandler.
+type Notifier struct {
+	cfg    Config
+	client *http.Client
+
+	mu            sync.Mutex
+	subscriptions map[string]Subscription
+	// deliveries holds delivery records by event ID, then subscription ID;
+	// history lists the event IDs oldest first for eviction.
+	deliveries map[string]map[string]*Delivery
+	history    []string
+
+	logger *slog.Logger
+}
+
+// NewNotifier creates a notifier with no subscriptions.
+func NewNotifier(cfg Config) *Notifier {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = defaultHistorySize
+	}
+	return &Notifier{
+		cfg:           cfg,
+		client:        &http.Client{Timeout: cfg.Timeout},
+		subscriptions: make(map[string]Subscription),
+		deliveries:    make(map[string]map[string]*Delivery),
+		logger:        slog.Default().With("component", "webhook"),
+	}
+}
+
+// Subscribe adds a subscription, replacing any with the same ID.
+func (n *Notifier) Subscribe(sub Subscription) error {
+	if sub.ID == "" {
+		return fmt.Errorf("subscription ID is required")
+	}
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("subscription %s: invalid URL %q", sub.ID, sub.URL)
+	}
+	if sub.Secret == "" {
+		return fmt.Errorf("subscription %s: secret is required", sub.ID)
+	}
+	if sub.Network == "" {
+		return fmt.Errorf("subscription %s: network is required", sub.ID)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.subscriptions[sub.ID] = sub
+	return nil
+}
+
+// Unsubscribe removes a subscription.
+func (n *Notifier) Unsubscribe(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.subscriptions, id)
+}
+
+// Deliveries returns the delivery records of an event, by subscription ID.
+func (n *Notifier) Deliveries(eventID string) []Delivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var result []Delivery
+	for _, d := range n.deliveries[eventID] {
+		result = append(result, *d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].SubscriptionID < result[j].SubscriptionID })
+	return result
+}
+
+// Handle delivers ev to every matching subscription. It is a
+// listener.EventHandler; see HandleContext.
+func (n *Notifier) Handle(ev models.BlockEvent) error {
+	return n.HandleContext(context.Background(), ev)
+}
+
+// HandleContext delivers ev to every matching subscription concurrently,
+// retrying each up to MaxAttempts times; cancelling ctx stops the retries.
+// Subscriptions that already received the event are skipped, so a caller
+// retrying a failed event, like listener.Manager, only resends to the failed
+// ones. It returns an error if any delivery failed and may succeed on retry;
+// rejected deliveries are only recorded.
+func (n *Notifier) HandleContext(ctx context.Context, ev models.BlockEvent) error {
+	if ev.ID == "" {
+		ev.ID = listener.EventID(ev)
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	subs := n.matching(ev)
+	errs := make([]error, len(subs))
+	var wg sync.WaitGroup
+	for i, sub := range subs {
+		wg.Add(1)
+		go func(i int, sub Subscription) {
+			defer wg.Done()
+			if err := n.deliver(ctx, sub, ev.ID, body); err != nil {
+				errs[i] = fmt.Errorf("webhook %s: %w", sub.ID, err)
+			}
+		}(i, sub)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// matching returns the subscriptions for ev, ordered by ID.
+func (n *Notifier) matching(ev models.BlockEvent) []Subscription {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var subs []Subscription
+	for _, sub := range n.subscriptions {
+		if sub.matches(ev) {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs
+}
+
+// deliver POSTs body to sub unless it already received or rejected the
+// event, retrying with backoff on network errors, 429 and 5xx responses.
+// Other 4xx responses are recorded in Deliveries and not retried.
+func (n *Notifier) deliver(ctx context.Context, sub Subscription, eventID string, body []byte) error {
+	if d := n.record(sub, eventID); d.Delivered || d.Rejected {
+		return nil
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= n.cfg.MaxAttempts; attempt++ {
+		status, err := n.post(ctx, sub, eventID, body)
+		attempts := n.update(sub, eventID, status, err)
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			n.logger.Error("webhook rejected, not retrying",
+				"subscription", sub.ID,
+				"event", eventID,
+				"status", perm.status,
+			)
+			return nil
+		}
+		if err == nil {
+			n.logger.Info("webhook delivered",
+				"subscription", sub.ID,
+				"event", eventID,
+				"attempt", attempts,
+			)
+			return nil
+		}
+
+		lastErr = err
+		n.logger.Warn("webhook attempt failed",
+			"subscription", sub.ID,
+			"event", eventID,
+			"attempt", attempts,
+			"error", err,
+		)
+		if attempt == n.cfg.MaxAttempts {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt*attempt) * n.cfg.Backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("all %d attempts failed: %w", n.cfg.MaxAttempts, lastErr)
+}
+
+// permanentError is a response that retrying will not fix, such as 400 or 404.
+type permanentError struct {
+	status int
+}
+
+func (e *permanentError) Error() string {
+	return fmt.Sprintf("rejected with status %d", e.status)
+}
+
+// post sends one signed request and returns the response status.
+func (n *Notifier) post(ctx context.Context, sub Subscription, eventID string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, eventID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // allow connection reuse
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return resp.StatusCode, &permanentError{status: resp.StatusCode}
+	}
+}
+
+// record returns the delivery record of eventID for sub, creating it and
+// evicting the oldest event's records beyond HistorySize.
+func (n *Notifier) record(sub Subscription, eventID string) Delivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	records, ok := n.deliveries[eventID]
+	if !ok {
+		records = make(map[string]*Delivery)
+		n.deliveries[eventID] = records
+		n.history = append(n.history, eventID)
+		if len(n.history) > n.cfg.HistorySize {
+			delete(n.deliveries, n.history[0])
+			n.history = n.history[1:]
+		}
+	}
+	d, ok := records[sub.ID]
+	if !ok {
+		d = &Delivery{EventID: eventID, SubscriptionID: sub.ID, URL: sub.URL, UpdatedAt: time.Now()}
+		records[sub.ID] = d
+	}
+	return *d
+}
+
+// update records the outcome of one attempt and returns the attempt count.
+func (n *Notifier) update(sub Subscription, eventID string, status int, err error) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	d, ok := n.deliveries[eventID][sub.ID]
+	if !ok {
+		return 0 // evicted meanwhile
+	}
+	d.Attempts++
+	d.LastStatus = status
+	d.LastError = ""
+	if err != nil {
+		d.LastError = err.Error()
+	}
+	d.Delivered = err == nil
+	var perm *permanentError
+	d.Rejected = errors.As(err, &perm)
+	d.UpdatedAt = time.Now()
+	return d.Attempts
+}
+
+// Sign returns the signature header value for body sent at timestamp (Unix
+// seconds): "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a received request against body.
+// Requests whose timestamp is more than tolerance away from now are rejected
+// to limit replays.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header", HeaderTimestamp)
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("timestamp outside tolerance: %s", age.Round(time.Second))
+	}
+	want := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(want)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
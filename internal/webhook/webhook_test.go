@@ -0,0 +1,271 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OKaluzny/wallet-demo/internal/listener"
+	"github.com/OKaluzny/wallet-demo/pkg/models"
+)
+
+const testSecret = "whsec_test"
+
+// receiver is an httptest webhook endpoint that verifies signatures and
+// answers with the queued statuses, then 200.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	events   []models.BlockEvent
+	errs     []error
+	server   *httptest.Server
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err := Verify(testSecret, req.Header, body, time.Minute); err != nil {
+			r.errs = append(r.errs, err)
+		}
+		var ev models.BlockEvent
+		if err := json.Unmarshal(body, &ev); err != nil || ev.ID != req.Header.Get(HeaderID) {
+			r.errs = append(r.errs, err)
+		}
+		r.events = append(r.events, ev)
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) received(t *testing.T) []models.BlockEvent {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errs) > 0 {
+		t.Fatalf("invalid request: %v", r.errs[0])
+	}
+	return append([]models.BlockEvent(nil), r.events...)
+}
+
+func deposit(to string) models.BlockEvent {
+	ev := models.BlockEvent{
+		Network:     models.NetworkETH,
+		BlockNumber: 100,
+		TxHash:      "0xtx" + to,
+		From:        "0xsender",
+		To:          to,
+		Amount:      big.NewInt(1_000),
+	}
+	ev.ID = listener.EventID(ev)
+	return ev
+}
+
+func TestNotifier_RetriesAndTracksAttempts(t *testing.T) {
+	r := newReceiver(t, http.StatusServiceUnavailable)
+	n := NewNotifier(Config{Backoff: time.Millisecond})
+	if err := n.Subscribe(Subscription{ID: "shop", URL: r.server.URL, Secret: testSecret, Network: models.NetworkETH}); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := deposit("0xAbC")
+	if err := n.Handle(ev); err != nil {
+		t.Fatal(err)
+	}
+	got := r.received(t)
+	if len(got) != 2 || got[1].ID != ev.ID || got[1].Amount.Cmp(ev.Amount) != 0 {
+		t.Fatalf("received %+v, want the event twice", got)
+	}
+	d := n.Deliveries(ev.ID)
+	if len(d) != 1 || d[0].Attempts != 2 || !d[0].Delivered || d[0].LastStatus != http.StatusOK || d[0].LastError != "" {
+		t.Errorf("deliveries = %+v", d)
+	}
+
+	// Handling the event again, as after a redelivery, does not resend it.
+	if err := n.Handle(ev); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.received(t); len(got) != 2 {
+		t.Errorf("event resent, %d requests", len(got))
+	}
+}
+
+func TestNotifier_FailedDelivery(t *testing.T) {
+	r := newReceiver(t, 500, 500, http.StatusBadRequest)
+	n := NewNotifier(Config{MaxAttempts: 2, Backoff: time.Millisecond})
+	if err := n.Subscribe(Subscription{ID: "shop", URL: r.server.URL, Secret: testSecret, Network: models.NetworkETH}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Out of attempts: the error is returned for the Manager to retry.
+	ev := deposit("0xabc")
+	if err := n.Handle(ev); err == nil {
+		t.Fatal("expected error after two 500 responses")
+	}
+	if d := n.Deliveries(ev.ID); d[0].Attempts != 2 || d[0].Delivered || d[0].LastStatus != 500 {
+		t.Errorf("deliveries = %+v", d)
+	}
+
+	// A 4xx response is recorded, not retried or returned to the Manager.
+	if err := n.Handle(ev); err != nil {
+		t.Fatalf("rejected request should not fail the event: %v", err)
+	}
+	if d := n.Deliveries(ev.ID); d[0].Attempts != 3 || d[0].LastStatus != http.StatusBadRequest || !d[0].Rejected || d[0].Delivered {
+		t.Errorf("deliveries after 400 = %+v", d)
+	}
+	if err := n.Handle(ev); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.received(t); len(got) != 3 {
+		t.Errorf("received %d requests, want 3", len(got))
+	}
+}
+
+func TestNotifier_BackoffStopsWithContext(t *testing.T) {
+	r := newReceiver(t, 500, 500, 500)
+	n := NewNotifier(Config{Backoff: time.Hour})
+	if err := n.Subscribe(Subscription{ID: "shop", URL: r.server.URL, Secret: testSecret, Network: models.NetworkETH}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := n.HandleContext(ctx, deposit("0xabc")); err == nil {
+		t.Fatal("expected error when the context ends during backoff")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("HandleContext slept %s past its context", elapsed)
+	}
+	if got := r.received(t); len(got) != 1 {
+		t.Errorf("received %d requests, want 1", len(got))
+	}
+}
+
+func TestNotifier_SlowEndpointDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+	fast := newReceiver(t)
+
+	n := NewNotifier(Config{Timeout: time.Minute})
+	for _, sub := range []Subscription{
+		{ID: "fast", URL: fast.server.URL, Secret: testSecret, Network: models.NetworkETH},
+		{ID: "slow", URL: slow.URL, Secret: testSecret, Network: models.NetworkETH},
+	} {
+		if err := n.Subscribe(sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := n.HandleContext(ctx, deposit("0xabc")); err == nil {
+		t.Fatal("expected error for the cancelled slow delivery")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("HandleContext took %s after its context ended", elapsed)
+	}
+	if got := fast.received(t); len(got) != 1 {
+		t.Errorf("fast endpoint received %d events, want 1", len(got))
+	}
+}
+
+func TestNotifier_Routing(t *testing.T) {
+	all := newReceiver(t)
+	merchant := newReceiver(t)
+	n := NewNotifier(Config{})
+	for _, sub := range []Subscription{
+		{ID: "all", URL: all.server.URL, Secret: testSecret, Network: models.NetworkETH},
+		{ID: "merchant", URL: merchant.server.URL, Secret: testSecret, Network: models.NetworkETH, Address: "0xABC"},
+		{ID: "btc", URL: merchant.server.URL, Secret: testSecret, Network: models.NetworkBTC},
+	} {
+		if err := n.Subscribe(sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, ev := range []models.BlockEvent{deposit("0xabc"), deposit("0xother")} {
+		if err := n.Handle(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := all.received(t); len(got) != 2 {
+		t.Errorf("network subscription received %d events, want 2", len(got))
+	}
+	if got := merchant.received(t); len(got) != 1 || got[0].To != "0xabc" {
+		t.Errorf("address subscription received %+v", got)
+	}
+
+	n.Unsubscribe("all")
+	if err := n.Handle(deposit("0xnew")); err != nil {
+		t.Fatal(err)
+	}
+	if got := all.received(t); len(got) != 2 {
+		t.Error("unsubscribed endpoint still receives events")
+	}
+}
+
+func TestSubscribe_Validation(t *testing.T) {
+	n := NewNotifier(Config{})
+	for name, sub := range map[string]Subscription{
+		"no ID":      {URL: "https://example.com", Secret: "s", Network: models.NetworkETH},
+		"bad URL":    {ID: "a", URL: "example.com/hook", Secret: "s", Network: models.NetworkETH},
+		"no secret":  {ID: "a", URL: "https://example.com", Network: models.NetworkETH},
+		"no network": {ID: "a", URL: "https://example.com", Secret: "s"},
+	} {
+		if err := n.Subscribe(sub); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"abc"}`)
+	now := time.Now().Unix()
+	header := func(timestamp int64, signature string) http.Header {
+		h := http.Header{}
+		h.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		h.Set(HeaderSignature, signature)
+		return h
+	}
+
+	if err := Verify(testSecret, header(now, Sign(testSecret, now, body)), body, time.Minute); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	cases := map[string]struct {
+		header http.Header
+		body   []byte
+	}{
+		"tampered body": {header(now, Sign(testSecret, now, body)), []byte(`{"id":"abd"}`)},
+		"wrong secret":  {header(now, Sign("other", now, body)), body},
+		"stale":         {header(now-600, Sign(testSecret, now-600, body)), body},
+		"no timestamp":  {http.Header{}, body},
+	}
+	for name, tc := range cases {
+		if err := Verify(testSecret, tc.header, tc.body, time.Minute); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -12,6 +12,11 @@ const (
 	NetworkTRX Network = "TRX"
 )
 
+// IsUTXO reports whether the network uses the UTXO model rather than accounts.
+func (n Network) IsUTXO() bool {
+	return n == NetworkBTC
+}
+
 // DerivedAddress holds a generated address with its derivation path
 type DerivedAddress struct {
 	Network        Network `json:"network"`
@@ -20,6 +25,36 @@ type DerivedAddress struct {
 	PublicKey      string  `json:"public_key"`
 }
 
+// TxType identifies the envelope type of an account-model transaction.
+type TxType uint8
+
+// Supported Ethereum transaction envelope types.
+const (
+	TxTypeLegacy     TxType = 0x00 // pre-EIP-2718 transaction with EIP-155 replay protection
+	TxTypeDynamicFee TxType = 0x02 // EIP-1559 dynamic-fee transaction
+)
+
+// AccessTuple is an EIP-2930 access list entry: a contract address and the storage slots it touches.
+type AccessTuple struct {
+	Address     string   `json:"address"`
+	StorageKeys []string `json:"storage_keys"`
+}
+
+// UTXO is an unspent transaction output on a UTXO-model chain (BTC).
+type UTXO struct {
+	TxID         string   `json:"txid"`
+	Vout         uint32   `json:"vout"`
+	Amount       *big.Int `json:"amount"`
+	ScriptPubKey []byte   `json:"script_pub_key"`
+	Address      string   `json:"address,omitempty"`
+}
+
+// TxOutput is a payment output of a UTXO-model transaction.
+type TxOutput struct {
+	Address string   `json:"address"`
+	Amount  *big.Int `json:"amount"`
+}
+
 // Transaction represents a generic blockchain transaction
 type Transaction struct {
 	Network   Network  `json:"network"`
@@ -32,16 +67,102 @@ type Transaction struct {
 	Signed    bool     `json:"signed"`
 	TxHash    string   `json:"tx_hash,omitempty"`
 	RawSigned []byte   `json:"-"`
+
+	// Account-model gas parameters (ETH). When GasPrice is nil, signers
+	// derive it from Fee / GasLimit.
+	GasPrice *big.Int `json:"gas_price,omitempty"`
+	GasLimit uint64   `json:"gas_limit,omitempty"`
+
+	// EIP-1559 fields, used when Type is TxTypeDynamicFee.
+	Type                 TxType        `json:"type,omitempty"`
+	MaxFeePerGas         *big.Int      `json:"max_fee_per_gas,omitempty"`
+	MaxPriorityFeePerGas *big.Int      `json:"max_priority_fee_per_gas,omitempty"`
+	AccessList           []AccessTuple `json:"access_list,omitempty"`
+
+	// UTXO-model fields (BTC). Inputs are the coins being spent. Outputs
+	// lists every output; when empty, a single output pays Amount to To.
+	Inputs  []UTXO     `json:"inputs,omitempty"`
+	Outputs []TxOutput `json:"outputs,omitempty"`
+
+	// TRON fields. RefBlockNumber and RefBlockHash identify a recent block
+	// the transaction is anchored to (TaPoS). Expiration and Timestamp are
+	// Unix milliseconds. FeeLimit caps the energy spent by smart-contract
+	// calls, in sun.
+	RefBlockNumber uint64 `json:"ref_block_number,omitempty"`
+	RefBlockHash   string `json:"ref_block_hash,omitempty"`
+	Expiration     int64  `json:"expiration,omitempty"`
+	Timestamp      int64  `json:"timestamp,omitempty"`
+	FeeLimit       int64  `json:"fee_limit,omitempty"`
+
+	// Token is set when the transaction calls transfer(address,uint256) on a
+	// token contract; To is then the contract and Amount is zero.
+	Token *TokenTransfer `json:"token,omitempty"`
+}
+
+// TokenTransfer describes an ERC-20/TRC-20 transfer carried by a transaction.
+type TokenTransfer struct {
+	Contract  string   `json:"contract"`
+	Symbol    string   `json:"symbol"`
+	Decimals  uint8    `json:"decimals"`
+	Recipient string   `json:"recipient"`
+	Amount    *big.Int `json:"amount"` // in the token's smallest unit
 }
 
 // BlockEvent represents an event detected by a block listener
 type BlockEvent struct {
+	// ID identifies the event for deduplication: deliveries are
+	// at-least-once, and a re-emitted event keeps its ID. Set by
+	// listener.Manager; see listener.EventID.
+	ID string `json:"id,omitempty"`
+
 	Network     Network  `json:"network"`
 	BlockNumber uint64   `json:"block_number"`
+	BlockHash   string   `json:"block_hash,omitempty"` // empty for mempool events and alerts
 	TxHash      string   `json:"tx_hash"`
 	From        string   `json:"from"`
 	To          string   `json:"to"`
 	Amount      *big.Int `json:"amount"`
 	Confirmed   bool     `json:"confirmed"`
 	Reorged     bool     `json:"reorged,omitempty"`
+
+	// Pending marks a transaction seen in the mempool, not yet mined;
+	// BlockNumber is zero. Once mined, the regular event follows with the
+	// same TxHash. A pending transaction that leaves the mempool unmined is
+	// reported again with Dropped set, and ReplacedBy names the transaction
+	// that took its place (same nonce or a conflicting spend), if any.
+	Pending    bool   `json:"pending,omitempty"`
+	Dropped    bool   `json:"dropped,omitempty"`
+	ReplacedBy string `json:"replaced_by,omitempty"`
+
+	// Confirmations is the number of blocks on top of BlockNumber when the
+	// event was emitted; an event is confirmed at the confirmation depth.
+	// With progress events enabled, the unconfirmed event is re-emitted
+	// with a higher count as the depth grows.
+	Confirmations uint64 `json:"confirmations"`
+
+	// Alert is set on listener alerts that carry no transfer, such as
+	// AlertDeepReorg; handlers must not treat them as transactions.
+	Alert string `json:"alert,omitempty"`
+
+	// Vout is the output index of a UTXO-chain (BTC) transfer. A transaction
+	// paying several watched outputs yields one event per output.
+	Vout uint32 `json:"vout,omitempty"`
+
+	// Token transfer fields. TokenContract is empty for native coin transfers;
+	// otherwise From, To and Amount come from the Transfer event at LogIndex.
+	TokenContract string `json:"token_contract,omitempty"`
+	TokenSymbol   string `json:"token_symbol,omitempty"`
+	LogIndex      uint   `json:"log_index,omitempty"`
+}
+
+// Listener alert kinds for BlockEvent.Alert.
+const (
+	// AlertDeepReorg reports a reorg deeper than the listener's max reorg
+	// depth at BlockNumber; the listener stops advancing until it resolves.
+	AlertDeepReorg = "deep_reorg"
+)
+
+// IsToken reports whether the event is a token transfer rather than a native one.
+func (e BlockEvent) IsToken() bool {
+	return e.TokenContract != ""
 }